@@ -0,0 +1,152 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/trace"
+)
+
+// RequestIdFilter takes the X-Request-Id and the W3C traceparent of the request, or generates them.
+// the request id is sent back in X-Request-Id and carried by the request context,
+// so it's in the access logs, the problem+json errors, the ORM debug logs and the requests of httplib.
+// usage:
+//	beego.InsertFilter("*", beego.BeforeStatic, beego.RequestIdFilter)
+//
+//	// in the controller
+//	trace.RequestId(this.RequestContext())
+//	httplib.Get("http://api/user").WithContext(this.RequestContext())
+func RequestIdFilter(ctx *context.Context) {
+	if trace.FromContext(ctx.Request.Context()) != nil {
+		return
+	}
+	span := trace.FromHeader(ctx.Request.Header)
+	ctx.Request = ctx.Request.WithContext(trace.NewContext(ctx.Request.Context(), span))
+	ctx.Input.Request = ctx.Request
+	ctx.Output.Header(trace.HeaderRequestId, span.RequestId)
+}
+
+// AccessLogRecord is the access log of a request.
+type AccessLogRecord struct {
+	Time       time.Time `json:"time"`
+	RequestId  string    `json:"request_id,omitempty"`
+	TraceId    string    `json:"trace_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Uri        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Elapsed    float64   `json:"elapsed_ms"`
+	Route      string    `json:"route,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// Json returns the record as a line of JSON.
+func (r *AccessLogRecord) Json() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+// Combined returns the record in the Apache combined log format,
+// the request id and the seconds elapsed are appended.
+func (r *AccessLogRecord) Combined() string {
+	bytes := "-"
+	if r.Bytes > 0 {
+		bytes = strconv.FormatInt(r.Bytes, 10)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s" %s %.3f`,
+		r.RemoteAddr, dash(r.User), r.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.Uri, r.Proto, r.Status, bytes,
+		dash(quote(r.Referer)), dash(quote(r.UserAgent)), dash(r.RequestId), r.Elapsed/1000)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quote escapes the quotes of the header values in the combined format
+func quote(s string) string {
+	return strings.Replace(s, `"`, `\"`, -1)
+}
+
+// newAccessLogRecord builds the record of the request served by w.
+func newAccessLogRecord(ctx *context.Context, w *responseWriter, start time.Time, elapsed time.Duration, route string) *AccessLogRecord {
+	r := ctx.Request
+	rec := &AccessLogRecord{
+		Time:       start,
+		RemoteAddr: ctx.Input.IP(),
+		Method:     r.Method,
+		Uri:        r.RequestURI,
+		Proto:      r.Proto,
+		Bytes:      w.size,
+		Elapsed:    float64(elapsed) / float64(time.Millisecond),
+		Route:      route,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	}
+	if rec.Uri == "" {
+		rec.Uri = r.URL.RequestURI()
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		rec.User = user
+	}
+	if span := trace.FromContext(r.Context()); span != nil {
+		rec.RequestId, rec.TraceId = span.RequestId, span.TraceId
+	} else {
+		rec.RequestId = r.Header.Get(trace.HeaderRequestId)
+	}
+	rec.Status = responseStatus(ctx, w)
+	return rec
+}
+
+// responseStatus returns the status code of the response written by w,
+// or set by Output.SetStatus to be written after ServeHTTP.
+func responseStatus(ctx *context.Context, w *responseWriter) int {
+	switch {
+	case w.status != 0:
+		return w.status
+	case ctx.Output.Status != 0:
+		return ctx.Output.Status
+	}
+	return http.StatusOK
+}
+
+// writeAccessLog writes the record to AccessLogger in the format.
+func writeAccessLog(rec *AccessLogRecord, format string) {
+	var line string
+	if format == "json" {
+		line = rec.Json()
+	} else {
+		line = rec.Combined()
+	}
+	logger := AccessLogger
+	if logger == nil {
+		logger = BeeLogger
+	}
+	logger.Informational("%s", line)
+}
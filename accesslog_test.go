@@ -0,0 +1,106 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/logs"
+	"github.com/astaxie/beego/trace"
+)
+
+func TestRequestIdFilter(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.InsertFilter("*", BeforeStatic, RequestIdFilter)
+	handler.Get("/rid", func(ctx *context.Context) {
+		ctx.Output.Body([]byte(trace.RequestId(ctx.RequestContext())))
+	})
+
+	r, _ := http.NewRequest("GET", "/rid", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if id := w.Header().Get("X-Request-Id"); len(id) != 32 || w.Body.String() != id {
+		t.Errorf("the generated request id %q, the handler get %q", id, w.Body.String())
+	}
+
+	r, _ = http.NewRequest("GET", "/rid", nil)
+	r.Header.Set("X-Request-Id", "client-id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("X-Request-Id") != "client-id" || w.Body.String() != "client-id" {
+		t.Errorf("the request id of the client isn't kept: %q", w.Body.String())
+	}
+}
+
+func TestAccessLogsFormat(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "beego-accesslog")
+	defer os.RemoveAll(dir)
+	logfile := filepath.Join(dir, "access.log")
+
+	oldLogs, oldFormat, oldLogger := AccessLogs, AccessLogsFormat, AccessLogger
+	defer func() {
+		AccessLogs, AccessLogsFormat, AccessLogger = oldLogs, oldFormat, oldLogger
+	}()
+	AccessLogs, AccessLogger = true, logs.NewLogger(100)
+	if err := SetAccessLogger("file", `{"filename":"`+logfile+`"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewControllerRegister()
+	handler.InsertFilter("*", BeforeStatic, RequestIdFilter)
+	handler.Get("/user/:id", func(ctx *context.Context) {
+		ctx.Output.SetStatus(201)
+		ctx.Output.Body([]byte("created"))
+	})
+	serve := func() {
+		r, _ := http.NewRequest("GET", "/user/1?x=1", nil)
+		r.RequestURI = "/user/1?x=1"
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Request-Id", "rid-1")
+		r.Header.Set("User-Agent", `agent "quoted"`)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	AccessLogsFormat = "json"
+	serve()
+	AccessLogsFormat = "combined"
+	serve()
+	AccessLogger.Close()
+
+	b, _ := ioutil.ReadFile(logfile)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("get %d access logs: %s", len(lines), b)
+	}
+	var rec AccessLogRecord
+	if err := json.Unmarshal([]byte(lines[0][strings.Index(lines[0], "{"):]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.RequestId != "rid-1" || rec.Status != 201 || rec.Bytes != 7 || rec.Route != "/user/:id" ||
+		rec.Uri != "/user/1?x=1" || rec.RemoteAddr != "10.0.0.1" || len(rec.TraceId) != 32 {
+		t.Errorf("bad json access log %+v", rec)
+	}
+	if !strings.Contains(lines[1], `10.0.0.1 - - [`) || !strings.Contains(lines[1], `] "GET /user/1?x=1 HTTP/1.1" 201 7 "-" "agent \"quoted\"" rid-1 `) {
+		t.Errorf("bad combined access log %s", lines[1])
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/astaxie/beego/grace"
+	"github.com/astaxie/beego/metrics"
 	"github.com/astaxie/beego/toolbox"
 	"github.com/astaxie/beego/utils"
 )
@@ -59,6 +60,7 @@ func init() {
 	beeAdminApp.Route("/healthcheck", healthcheck)
 	beeAdminApp.Route("/task", taskStatus)
 	beeAdminApp.Route("/listconf", listConf)
+	beeAdminApp.Route("/metrics", metrics.DefaultRegistry.ServeHTTP)
 	FilterMonitorFunc = func(string, string, time.Duration) bool { return true }
 }
 
@@ -74,12 +76,39 @@ func adminIndex(rw http.ResponseWriter, r *http.Request) {
 
 // QpsIndex is the http.Handler for writing qbs statistics map result info in http.ResponseWriter.
 // it's registered with url pattern "/qbs" in admin module.
+// the statistics are of the requests in the last window such as "?window=5m", or since the start without window.
+// "?format=json" writes the statistics of the routes in json.
 func qpsIndex(rw http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	var window time.Duration
+	if w := r.Form.Get("window"); w != "" {
+		var err error
+		if window, err = time.ParseDuration(w); err != nil || window < 0 {
+			http.Error(rw, "bad window "+w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.Form.Get("format") == "json" {
+		dataJson, err := json.Marshal(map[string]interface{}{
+			"window": window.String(),
+			"routes": toolbox.StatisticsMap.Snapshot(window),
+		})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(dataJson)
+		return
+	}
+
 	tmpl := template.Must(template.New("dashboard").Parse(dashboardTpl))
 	tmpl = template.Must(tmpl.Parse(qpsTpl))
 	tmpl = template.Must(tmpl.Parse(defaultScriptsTpl))
 	data := make(map[interface{}]interface{})
-	data["Content"] = toolbox.StatisticsMap.GetMap()
+	data["Content"] = toolbox.StatisticsMap.GetWindowMap(window)
 
 	tmpl.Execute(rw, data)
 
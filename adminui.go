@@ -63,6 +63,13 @@ var gcAjaxTpl = `
 
 var qpsTpl = `{{define "content"}}
 <h1>Requests statistics</h1>
+<ul class="nav nav-pills">
+	<li><a href="/qps">All</a></li>
+	<li><a href="/qps?window=1m">Last 1m</a></li>
+	<li><a href="/qps?window=5m">Last 5m</a></li>
+	<li><a href="/qps?window=1h">Last 1h</a></li>
+	<li><a href="/qps?format=json">JSON</a></li>
+</ul>
 <table class="table table-striped table-hover ">
 	<thead>
 	<tr>
@@ -15,11 +15,14 @@
 package beego
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/fcgi"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/astaxie/beego/grace"
@@ -32,6 +35,20 @@ type App struct {
 	// ServeHTTP(ResponseWriter, *Request)
 	Handlers *ControllerRegistor
 	Server   *http.Server
+	Settings *Settings // settings of the app, nil for the global variables
+
+	mu            sync.Mutex
+	running       bool
+	servers       []shutdowner   // http servers started by Start
+	listeners     []net.Listener // the bound listeners, closed by Shutdown for fcgi
+	done          chan error     // the first error of the servers, nil after Shutdown
+	startHooks    []hookfunc
+	shutdownHooks []hookfunc
+}
+
+// shutdowner is the server which can drain the in-flight requests, *http.Server and the grace server.
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
 }
 
 // NewApp returns a new beego application.
@@ -43,156 +60,405 @@ func NewApp() *App {
 	return app
 }
 
-// Run beego application.
+// NewAppWithSettings returns a new beego application served by cfg instead of the global variables,
+// several apps with different settings can run in one process.
+// usage:
+//	cfg := beego.NewSettings()
+//	cfg.HttpPort = 8089
+//	cfg.SessionOn = true
+//	cfg.Sessions, _ = session.NewManager("memory", `{"cookieName":"adminsessionid","gclifetime":3600}`)
+//	admin := beego.NewAppWithSettings(cfg)
+//	admin.Handlers.Add("/users", &AdminController{})
+//	admin.Start()
+func NewAppWithSettings(cfg *Settings) *App {
+	app := NewApp()
+	app.Settings = cfg
+	app.Handlers.cfg = cfg
+	return app
+}
+
+// OnStart registers a hook run by Start after the listeners are bound,
+// Start fails if a hook returns error.
+func (app *App) OnStart(hf hookfunc) {
+	app.startHooks = append(app.startHooks, hf)
+}
+
+// OnShutdown registers a hook run by Shutdown after the requests are drained,
+// such as closing the database pools or flushing the logs.
+// the hooks run in the reverse order of registration.
+func (app *App) OnShutdown(hf hookfunc) {
+	app.shutdownHooks = append(app.shutdownHooks, hf)
+}
+
+// Run beego application, it blocks until the servers stop.
 func (app *App) Run() {
-	addr := HttpAddr
+	if err := app.Start(); err != nil {
+		BeeLogger.Critical("Start: ", err, fmt.Sprintf("%d", os.Getpid()))
+		return
+	}
+	app.Wait()
+}
 
-	if HttpPort != 0 {
-		addr = fmt.Sprintf("%s:%d", HttpAddr, HttpPort)
+// Wait blocks until a server fails or the app is shut down,
+// the error of the failed server is returned.
+func (app *App) Wait() error {
+	app.mu.Lock()
+	done := app.done
+	app.mu.Unlock()
+	if done == nil {
+		return nil
 	}
+	return <-done
+}
 
+// Addrs returns the addresses of the bound listeners.
+func (app *App) Addrs() []net.Addr {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	addrs := make([]net.Addr, 0, len(app.listeners))
+	for _, l := range app.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+// Start binds the listeners by HttpAddr, HttpPort, EnableHttpTLS, UseFcgi and Graceful of the app Settings,
+// then serves the requests in background and returns.
+// usage:
+//	app := beego.NewApp()
+//	app.Handlers.Get("/", hello)
+//	if err := app.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer app.Shutdown(context.Background())
+func (app *App) Start() error {
+	app.mu.Lock()
+	if app.running {
+		app.mu.Unlock()
+		return fmt.Errorf("beego: app is running")
+	}
+	if app.Settings != nil {
+		if err := app.Settings.BuildTemplate(); err != nil {
+			app.mu.Unlock()
+			return err
+		}
+	}
+	cfg := app.Handlers.conf()
+	if cfg.SessionOn && cfg.Sessions == nil {
+		app.mu.Unlock()
+		return fmt.Errorf("beego: SessionOn without the session manager")
+	}
+
+	addr := cfg.HttpAddr
+	if cfg.HttpPort != 0 {
+		addr = fmt.Sprintf("%s:%d", cfg.HttpAddr, cfg.HttpPort)
+	}
+	app.done = make(chan error, 1)
+	app.servers = nil
+	app.listeners = nil
+
+	var err error
+	if cfg.UseFcgi {
+		err = app.startFcgi(cfg, addr)
+	} else {
+		app.Server.Addr = addr
+		app.Server.Handler = app.Handlers // ServeHTTP(ResponseWriter, *Request)
+		if cfg.HttpsCertManager != nil {
+			// answers the ACME challenges
+			app.Server.Handler = cfg.HttpsCertManager.HTTPHandler(app.Handlers)
+		}
+		app.Server.ReadTimeout = time.Duration(cfg.HttpServerTimeOut) * time.Second
+		app.Server.WriteTimeout = time.Duration(cfg.HttpServerTimeOut) * time.Second
+		if cfg.Graceful {
+			err = app.startGrace(cfg, addr)
+		} else {
+			err = app.startHttp(cfg, addr)
+		}
+	}
+	if err != nil {
+		(&stopping{servers: app.servers, listeners: app.listeners}).closeServers()
+		app.mu.Unlock()
+		return err
+	}
+	app.running = true
+	hooks := append([]hookfunc(nil), app.startHooks...)
+	app.mu.Unlock()
+
+	// the hooks run without the lock, they may call Addrs or Shutdown
+	for _, hk := range hooks {
+		if err = hk(); err != nil {
+			if st := app.stop(); st != nil {
+				st.closeServers()
+				// Wait returns the error of the hook
+				st.notify(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the servers gracefully: the listeners are closed and
+// the in-flight requests are drained until ctx is done, then the shutdown hooks run.
+// the requests served through grace are drained too.
+func (app *App) Shutdown(ctx context.Context) error {
+	st := app.stop()
+	if st == nil {
+		return nil
+	}
+
+	// the servers drain and the hooks run without the lock, they may call Addrs or Shutdown
+	var err error
+	for _, srv := range st.servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	if app.Handlers.conf().UseFcgi {
+		for _, l := range st.listeners {
+			l.Close()
+		}
+	}
+	if e := st.finish(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// stopped is called after the grace servers are stopped by a signal or an upgrade,
+// the shutdown hooks run and Wait returns.
+func (app *App) stopped() {
+	st := app.stop()
+	if st == nil {
+		return
+	}
+	if err := st.finish(); err != nil {
+		BeeLogger.Error("shutdown hook: %v", err)
+	}
+}
+
+// stopping is the state of the app being stopped, it's copied by stop
+// so that the servers drain and the hooks run without the lock.
+type stopping struct {
+	servers   []shutdowner
+	listeners []net.Listener
+	hooks     []hookfunc
+	done      chan error
+}
+
+// stop marks the app not running and returns its state, nil if it isn't running.
+func (app *App) stop() *stopping {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if !app.running {
+		return nil
+	}
+	app.running = false
+	return &stopping{
+		servers:   append([]shutdowner(nil), app.servers...),
+		listeners: append([]net.Listener(nil), app.listeners...),
+		hooks:     append([]hookfunc(nil), app.shutdownHooks...),
+		done:      app.done,
+	}
+}
+
+// finish runs the shutdown hooks and stops Wait.
+func (st *stopping) finish() error {
+	var err error
+	for i := len(st.hooks) - 1; i >= 0; i-- {
+		if e := st.hooks[i](); e != nil && err == nil {
+			err = e
+		}
+	}
+	// Wait返回
+	st.notify(nil)
+	return err
+}
+
+// notify stops Wait with err.
+func (st *stopping) notify(err error) {
+	select {
+	case st.done <- err:
+	default:
+	}
+}
+
+// closeServers closes the servers started by a failed Start.
+func (st *stopping) closeServers() {
+	for _, srv := range st.servers {
+		srv.Shutdown(context.Background())
+	}
+	for _, l := range st.listeners {
+		l.Close()
+	}
+}
+
+// serve runs the server in background, the failure stops the app.
+func (app *App) serve(name string, fn func() error) {
+	go func() {
+		err := fn()
+		if err == nil || err == http.ErrServerClosed {
+			return
+		}
+		BeeLogger.Critical(name+": ", err, fmt.Sprintf("%d", os.Getpid()))
+		select {
+		case app.done <- err:
+		default:
+		}
+	}()
+}
+
+func (app *App) startFcgi(cfg *Settings, addr string) error {
+	if cfg.UseStdIo {
+		BeeLogger.Info("Use FCGI via standard I/O")
+		app.serve("FCGI", func() error {
+			return fcgi.Serve(nil, app.Handlers) // standard I/O
+		})
+		return nil
+	}
 	var (
-		err error
 		l   net.Listener
+		err error
 	)
-	endRunning := make(chan bool, 1)
-
-	if UseFcgi {
-		// 暂时不用管
-		if UseStdIo {
-			err = fcgi.Serve(nil, app.Handlers) // standard I/O
-			if err == nil {
-				BeeLogger.Info("Use FCGI via standard I/O")
-			} else {
-				BeeLogger.Info("Cannot use FCGI via standard I/O", err)
-			}
-		} else {
-			if HttpPort == 0 {
-				// remove the Socket file before start
-				if utils.FileExists(addr) {
-					os.Remove(addr)
-				}
-				l, err = net.Listen("unix", addr)
-			} else {
-				l, err = net.Listen("tcp", addr)
-			}
-			if err != nil {
-				BeeLogger.Critical("Listen: ", err)
-			}
-			err = fcgi.Serve(l, app.Handlers)
+	if cfg.HttpPort == 0 {
+		// remove the Socket file before start
+		if utils.FileExists(addr) {
+			os.Remove(addr)
 		}
+		l, err = net.Listen("unix", addr)
 	} else {
-		if Graceful {
-			// http://beego.me/docs/module/grace.md
-			// http://grisha.org/blog/2014/06/03/graceful-restart-in-golang/
-			app.Server.Addr = addr
-			app.Server.Handler = app.Handlers
-			app.Server.ReadTimeout = time.Duration(HttpServerTimeOut) * time.Second
-			app.Server.WriteTimeout = time.Duration(HttpServerTimeOut) * time.Second
-			// 多个不同的Server在: Go/Java等环境中好理解，但是在: Python的单线程中如何理解呢?
-			// Python + Gevent似乎也可以理解, 至少有异步，并发的概念
-			//
-			if EnableHttpTLS {
-				go func() {
-					time.Sleep(20 * time.Microsecond)
-					if HttpsPort != 0 {
-						addr = fmt.Sprintf("%s:%d", HttpAddr, HttpsPort)
-						app.Server.Addr = addr
-					}
-
-					//
-					// 同时创建多个不同的Server
-					//
-					server := grace.NewServer(addr, app.Handlers)
-					server.Server = app.Server
-					err := server.ListenAndServeTLS(HttpCertFile, HttpKeyFile)
-					if err != nil {
-						BeeLogger.Critical("ListenAndServeTLS: ", err, fmt.Sprintf("%d", os.Getpid()))
-						time.Sleep(100 * time.Microsecond)
-						endRunning <- true
-					}
-				}()
-			}
-			if EnableHttpListen {
-				go func() {
-					//
-					// 通过grace Server来管理app.Server呢?
-					//
-					server := grace.NewServer(addr, app.Handlers)
-					server.Server = app.Server
-					if ListenTCP4 && HttpAddr == "" {
-						server.Network = "tcp4"
-					}
-					err := server.ListenAndServe()
-					if err != nil {
-						BeeLogger.Critical("ListenAndServe: ", err, fmt.Sprintf("%d", os.Getpid()))
-						time.Sleep(100 * time.Microsecond)
-						endRunning <- true
-					}
-				}()
-			}
-		} else {
-			// 最简单的模式:
-			// 配置Server: Addr, Handler, Timeout
-			app.Server.Addr = addr
-			app.Server.Handler = app.Handlers // ServeHTTP(ResponseWriter, *Request)
-			app.Server.ReadTimeout = time.Duration(HttpServerTimeOut) * time.Second
-			app.Server.WriteTimeout = time.Duration(HttpServerTimeOut) * time.Second
-
-			// TLS如何工作呢?
-			// 设置证书？ 然后呢?
-			if EnableHttpTLS {
-				go func() {
-					time.Sleep(20 * time.Microsecond)
-					if HttpsPort != 0 {
-						app.Server.Addr = fmt.Sprintf("%s:%d", HttpAddr, HttpsPort)
-					}
-					BeeLogger.Info("https server Running on %s", app.Server.Addr)
-					err := app.Server.ListenAndServeTLS(HttpCertFile, HttpKeyFile)
-					if err != nil {
-						BeeLogger.Critical("ListenAndServeTLS: ", err)
-						time.Sleep(100 * time.Microsecond)
-						endRunning <- true
-					}
-				}()
-			}
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	app.listeners = append(app.listeners, l)
+	app.serve("FCGI", func() error {
+		return fcgi.Serve(l, app.Handlers)
+	})
+	return nil
+}
 
-			if EnableHttpListen {
-				go func() {
-					app.Server.Addr = addr
-					BeeLogger.Info("http server Running on %s", app.Server.Addr)
-					if ListenTCP4 && HttpAddr == "" {
-						// HttpAddr == "", 什么情况下会这样呢?
-						ln, err := net.Listen("tcp4", app.Server.Addr)
-						if err != nil {
-							BeeLogger.Critical("ListenAndServe: ", err)
-							time.Sleep(100 * time.Microsecond)
-							endRunning <- true
-							return
-						}
-						// 核心: 代码会在这里一直运行着
-						err = app.Server.Serve(ln)
-						if err != nil {
-							BeeLogger.Critical("ListenAndServe: ", err)
-							time.Sleep(100 * time.Microsecond)
-							endRunning <- true
-							return
-						}
-					} else {
-						// 和上面的区别是什么呢?
-						// 集成度更高?
-						//
-						err := app.Server.ListenAndServe()
-						if err != nil {
-							BeeLogger.Critical("ListenAndServe: ", err)
-							time.Sleep(100 * time.Microsecond)
-							endRunning <- true
-						}
-					}
-				}()
-			}
+// http://beego.me/docs/module/grace.md
+// http://grisha.org/blog/2014/06/03/graceful-restart-in-golang/
+func (app *App) startGrace(cfg *Settings, addr string) error {
+	// the grace servers stop by SIGTERM or after the upgraded child is ready
+	var serving sync.WaitGroup
+	defer func() {
+		go func() {
+			serving.Wait()
+			app.stopped()
+		}()
+	}()
+	if cfg.EnableHttpTLS {
+		tlsAddr := addr
+		if cfg.HttpsPort != 0 {
+			tlsAddr = fmt.Sprintf("%s:%d", cfg.HttpAddr, cfg.HttpsPort)
+		}
+		server := grace.NewServer(tlsAddr, app.Handlers)
+		server.Server = app.tlsServer(cfg, tlsAddr)
+		if err := server.ListenTLS(cfg.tlsFiles()); err != nil {
+			return err
+		}
+		app.servers = append(app.servers, server)
+		app.listeners = append(app.listeners, server.GraceListener)
+		serving.Add(1)
+		app.serve("ListenAndServeTLS", func() error {
+			defer serving.Done()
+			return server.Serve()
+		})
+	}
+	if cfg.EnableHttpListen {
+		//
+		// 通过grace Server来管理app.Server
+		//
+		server := grace.NewServer(addr, app.Handlers)
+		server.Server = app.Server
+		if cfg.ListenTCP4 && cfg.HttpAddr == "" {
+			server.Network = "tcp4"
+		}
+		if err := server.Listen(); err != nil {
+			return err
+		}
+		app.servers = append(app.servers, server)
+		app.listeners = append(app.listeners, server.GraceListener)
+		serving.Add(1)
+		app.serve("ListenAndServe", func() error {
+			defer serving.Done()
+			return server.Serve()
+		})
+	}
+	return nil
+}
+
+func (app *App) startHttp(cfg *Settings, addr string) error {
+	if cfg.EnableHttpTLS {
+		tlsAddr := addr
+		if cfg.HttpsPort != 0 {
+			tlsAddr = fmt.Sprintf("%s:%d", cfg.HttpAddr, cfg.HttpsPort)
 		}
+		server := app.tlsServer(cfg, tlsAddr)
+		l, err := net.Listen("tcp", tlsAddr)
+		if err != nil {
+			return err
+		}
+		BeeLogger.Info("https server Running on %s", tlsAddr)
+		app.servers = append(app.servers, server)
+		app.listeners = append(app.listeners, l)
+		app.serve("ListenAndServeTLS", func() error {
+			certFile, keyFile := cfg.tlsFiles()
+			return server.ServeTLS(l, certFile, keyFile)
+		})
+	}
+	if cfg.EnableHttpListen {
+		network := "tcp"
+		if cfg.ListenTCP4 && cfg.HttpAddr == "" {
+			network = "tcp4"
+		}
+		if addr == "" {
+			addr = ":http"
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		BeeLogger.Info("http server Running on %s", addr)
+		app.servers = append(app.servers, app.Server)
+		app.listeners = append(app.listeners, l)
+		app.serve("ListenAndServe", func() error {
+			return app.Server.Serve(l)
+		})
+	}
+	return nil
+}
+
+// tlsServer returns the https server sharing the settings of app.Server,
+// the certificates are selected by HttpsCertManager if it's set.
+func (app *App) tlsServer(cfg *Settings, addr string) *http.Server {
+	server := &http.Server{
+		Addr:           addr,
+		Handler:        app.Handlers,
+		ReadTimeout:    app.Server.ReadTimeout,
+		WriteTimeout:   app.Server.WriteTimeout,
+		MaxHeaderBytes: app.Server.MaxHeaderBytes,
+		TLSConfig:      app.Server.TLSConfig,
+		ErrorLog:       app.Server.ErrorLog,
+	}
+	if cfg.HttpsCertManager != nil {
+		if server.TLSConfig != nil {
+			server.TLSConfig = server.TLSConfig.Clone()
+		} else {
+			server.TLSConfig = &tls.Config{}
+		}
+		server.TLSConfig.GetCertificate = cfg.HttpsCertManager.GetCertificate
+	}
+	return server
+}
 
+// tlsFiles returns the certificate files, they are empty if HttpsCertManager is set.
+func (cfg *Settings) tlsFiles() (string, string) {
+	if cfg.HttpsCertManager != nil {
+		return "", ""
 	}
-	<-endRunning
+	return cfg.HttpCertFile, cfg.HttpKeyFile
 }
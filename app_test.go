@@ -0,0 +1,227 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	gocontext "context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/context"
+)
+
+func TestAppStartShutdown(t *testing.T) {
+	addr, port := HttpAddr, HttpPort
+	HttpAddr, HttpPort = "127.0.0.1:0", 0
+	defer func() { HttpAddr, HttpPort = addr, port }()
+
+	app := NewApp()
+	started := make(chan bool, 1)
+	app.Handlers.Get("/slow", func(ctx *context.Context) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		ctx.WriteString("done")
+	})
+	var hooks []string
+	app.OnStart(func() error {
+		hooks = append(hooks, "start")
+		return nil
+	})
+	app.OnShutdown(func() error {
+		hooks = append(hooks, "shutdown")
+		return nil
+	})
+
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addrs := app.Addrs()
+	if len(addrs) != 1 || len(hooks) != 1 {
+		t.Fatalf("Start get the addrs %v and hooks %v", addrs, hooks)
+	}
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addrs[0].String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	if err := app.Shutdown(gocontext.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b := <-body; b != "done" {
+		t.Errorf("Shutdown didn't drain the request, get %q", b)
+	}
+	if len(hooks) != 2 || hooks[1] != "shutdown" {
+		t.Errorf("Shutdown get the hooks %v", hooks)
+	}
+	if err := app.Wait(); err != nil {
+		t.Errorf("Wait get %v after Shutdown", err)
+	}
+	if _, err := http.Get("http://" + addrs[0].String() + "/slow"); err == nil {
+		t.Errorf("the server is still running after Shutdown")
+	}
+}
+
+func TestAppStartHookAddrs(t *testing.T) {
+	addr, port := HttpAddr, HttpPort
+	HttpAddr, HttpPort = "127.0.0.1:0", 0
+	defer func() { HttpAddr, HttpPort = addr, port }()
+
+	app := NewApp()
+	var addrs []net.Addr
+	app.OnStart(func() error {
+		addrs = app.Addrs()
+		return nil
+	})
+	app.OnStart(func() error {
+		return errors.New("failed")
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Start() }()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "failed" {
+			t.Errorf("Start get %v, want the error of the hook", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hook calling Addrs deadlocks")
+	}
+	if len(addrs) != 1 {
+		t.Fatalf("the hook get the addrs %v", addrs)
+	}
+	if _, err := http.Get("http://" + addrs[0].String() + "/"); err == nil {
+		t.Errorf("the server is still running after the hook failed")
+	}
+}
+
+func TestAppStartHookWait(t *testing.T) {
+	addr, port := HttpAddr, HttpPort
+	HttpAddr, HttpPort = "127.0.0.1:0", 0
+	defer func() { HttpAddr, HttpPort = addr, port }()
+
+	app := NewApp()
+	app.OnStart(func() error {
+		return errors.New("failed")
+	})
+	if err := app.Start(); err == nil {
+		t.Fatal("Start doesn't fail with the hook")
+	}
+	done := make(chan error, 1)
+	go func() { done <- app.Wait() }()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "failed" {
+			t.Errorf("Wait get %v, want the error of the hook", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait blocks after the failed Start")
+	}
+}
+
+func TestAppShutdownHookAddrs(t *testing.T) {
+	addr, port := HttpAddr, HttpPort
+	HttpAddr, HttpPort = "127.0.0.1:0", 0
+	defer func() { HttpAddr, HttpPort = addr, port }()
+
+	app := NewApp()
+	var addrs []net.Addr
+	app.OnShutdown(func() error {
+		addrs = app.Addrs()
+		return app.Shutdown(gocontext.Background())
+	})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- app.Shutdown(gocontext.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shutdown hook calling Addrs deadlocks")
+	}
+	if len(addrs) != 1 {
+		t.Errorf("the hook get the addrs %v", addrs)
+	}
+	if err := app.Wait(); err != nil {
+		t.Errorf("Wait get %v after Shutdown", err)
+	}
+}
+
+func TestAppWithSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beego-settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("admin"), 0644)
+
+	cfg := NewSettings()
+	cfg.ErrorsProblemJson = true
+	cfg.StaticDir = map[string]string{"/assets": dir}
+	admin := NewAppWithSettings(cfg)
+	admin.Handlers.Get("/panic", func(ctx *context.Context) {
+		panic("admin")
+	})
+	public := NewApp()
+	public.Handlers.Get("/panic", func(ctx *context.Context) {
+		panic("public")
+	})
+
+	r, _ := http.NewRequest("GET", "/panic", nil)
+	w := httptest.NewRecorder()
+	admin.Handlers.ServeHTTP(w, r)
+	if w.Code != 500 || w.HeaderMap.Get("Content-Type") != problemJson {
+		t.Errorf("the admin app get %d %q, want problem+json", w.Code, w.HeaderMap.Get("Content-Type"))
+	}
+	w = httptest.NewRecorder()
+	public.Handlers.ServeHTTP(w, r)
+	if w.HeaderMap.Get("Content-Type") == problemJson {
+		t.Errorf("the public app uses the settings of the admin app")
+	}
+
+	r, _ = http.NewRequest("GET", "/assets/app.js", nil)
+	w = httptest.NewRecorder()
+	admin.Handlers.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "admin" {
+		t.Errorf("the admin app get the static file %d %q", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	public.Handlers.ServeHTTP(w, r)
+	if w.Code != 404 {
+		t.Errorf("the public app serves the static dir of the admin app, get %d", w.Code)
+	}
+	if _, ok := StaticDir["/assets"]; ok {
+		t.Errorf("NewSettings shares StaticDir with the global variables")
+	}
+}
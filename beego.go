@@ -37,6 +37,8 @@ import (
 	"strings"
 
 	"github.com/astaxie/beego/session"
+	"github.com/astaxie/beego/toolbox"
+	"github.com/astaxie/beego/websocket"
 )
 
 // beego web framework version.
@@ -135,6 +137,16 @@ func Get(rootpath string, f FilterFunc) *App {
 	return BeeApp
 }
 
+// register websocket router
+// usage:
+//    beego.WebSocket("/ws", func(ctx *context.Context, conn *websocket.Conn){
+//          conn.WriteMessage(websocket.TextMessage, []byte("hello world"))
+//    })
+func WebSocket(rootpath string, h WebSocketHandler, upgrader ...*websocket.Upgrader) *App {
+	BeeApp.Handlers.WebSocket(rootpath, h, upgrader...)
+	return BeeApp
+}
+
 // register router for Post method
 // usage:
 //    beego.Post("/api", func(ctx *context.Context){
@@ -215,6 +227,15 @@ func Handler(rootpath string, h http.Handler, options ...interface{}) *App {
 	return BeeApp
 }
 
+// Host returns the router of the host pattern in BeeApp.
+// usage:
+//    beego.Host(":tenant.example.com").Get("/", func(ctx *context.Context){
+//          ctx.Output.Body([]byte(ctx.Input.Param(":tenant")))
+//    })
+func Host(pattern string) *ControllerRegistor {
+	return BeeApp.Handlers.Host(pattern)
+}
+
 // SetViewsPath sets view directory path in beego application.
 func SetViewsPath(path string) *App {
 	ViewsPath = path
@@ -239,9 +260,55 @@ func DelStaticPath(url string) *App {
 	}
 	url = strings.TrimRight(url, "/")
 	delete(StaticDir, url)
+	delete(StaticFileSystem, url)
+	delete(StaticFallback, url)
+	return BeeApp
+}
+
+// SetStaticCacheControl sets the Cache-Control header of the static files in this url prefix,
+// the longest matched prefix is used.
+// usage:
+//	beego.SetStaticCacheControl("/static", "no-cache")
+//	beego.SetStaticCacheControl("/static/assets", "public, max-age=31536000, immutable")
+func SetStaticCacheControl(url string, cacheControl string) *App {
+	StaticCacheControl[staticCacheURL(url)] = cacheControl
+	return BeeApp
+}
+
+// SetStaticFallback sets the file served for the unknown paths without extension in this static url prefix,
+// so the routes of a single page app are served by its index.html.
+// usage:
+//	beego.SetStaticPath("/app", "dist")
+//	beego.SetStaticFallback("/app", "index.html")
+func SetStaticFallback(url string, file string) *App {
+	StaticFallback[staticURL(url)] = file
+	return BeeApp
+}
+
+// SetStaticFileSystem serves the static files in this url prefix from the http.FileSystem,
+// such as the assets embedded in the binary.
+// usage:
+//	beego.SetStaticFileSystem("/static", http.FS(assets))
+func SetStaticFileSystem(url string, fs http.FileSystem) *App {
+	StaticFileSystem[staticURL(url)] = fs
 	return BeeApp
 }
 
+func staticURL(url string) string {
+	if !strings.HasPrefix(url, "/") {
+		url = "/" + url
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// staticCacheURL is the prefix of StaticCacheControl, the root is "/" which matches all the static files.
+func staticCacheURL(url string) string {
+	if url = staticURL(url); url == "" {
+		return "/"
+	}
+	return url
+}
+
 // InsertFilter adds a FilterFunc with pattern condition and action constant.
 // The pos means action constant including
 // beego.BeforeStatic, beego.BeforeRouter, beego.BeforeExec, beego.AfterExec and beego.FinishRouter.
@@ -257,6 +324,12 @@ func AddAPPStartHook(hf hookfunc) {
 	hooks = append(hooks, hf)
 }
 
+// AddAPPShutdownHook registers the hookfunc run by BeeApp.Shutdown after the requests are drained,
+// such as closing the database pools.
+func AddAPPShutdownHook(hf hookfunc) {
+	BeeApp.OnShutdown(hf)
+}
+
 // Run beego application.
 // beego.Run() default run on HttpPort
 // beego.Run(":8089")
@@ -282,7 +355,17 @@ func Run(params ...string) {
 	// C. 启动Admin和BeeApp
 	if EnableAdmin {
 		go beeAdminApp.Run()
+		if len(toolbox.AdminTaskList) > 0 {
+			BeeApp.OnShutdown(func() error {
+				toolbox.StopTask()
+				return nil
+			})
+		}
 	}
+	BeeApp.OnShutdown(func() error {
+		BeeLogger.Flush()
+		return nil
+	})
 
 	// 在config.go中定义
 	BeeApp.Run()
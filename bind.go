@@ -0,0 +1,166 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/validation"
+)
+
+// BodyDecoder decodes the request body into obj.
+type BodyDecoder func(ctx *context.Context, obj interface{}) error
+
+var (
+	// ErrUnsupportedContentType is returned by BindBody when no decoder is registered for the Content-Type.
+	ErrUnsupportedContentType = errors.New("beego: unsupported content type")
+	// ErrBodyTooLarge is the error of the request body exceeding MaxMemory,
+	// BindBody doesn't return it, the request is aborted with 413 instead.
+	ErrBodyTooLarge = errors.New("beego: request body too large")
+
+	bodyDecoders = map[string]BodyDecoder{
+		"application/json":                  decodeJson,
+		"text/json":                         decodeJson,
+		"application/xml":                   decodeXml,
+		"text/xml":                          decodeXml,
+		"application/x-www-form-urlencoded": decodeForm,
+		"multipart/form-data":               decodeForm,
+	}
+)
+
+// AddBodyDecoder registers the decoder used by BindBody for the Content-Type.
+// usage:
+//	beego.AddBodyDecoder("application/msgpack", func(ctx *context.Context, obj interface{}) error {
+//		return msgpack.Unmarshal(ctx.Input.CopyBody(), obj)
+//	})
+func AddBodyDecoder(contentType string, d BodyDecoder) {
+	bodyDecoders[strings.ToLower(contentType)] = d
+}
+
+// BindError is returned by BindBody when the decoded object fails the validation.
+type BindError struct {
+	Errors []*validation.ValidationError
+}
+
+func (e *BindError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Key+": "+err.Message)
+	}
+	return "beego: invalid request body, " + strings.Join(msgs, "; ")
+}
+
+// BindBody decodes the request body into obj by the Content-Type,
+// then validates obj with the `valid` tags.
+// a request without Content-Type is decoded as form.
+// the request is answered 413 and stopped if the body exceeds MaxMemory.
+// *BindError is returned if the validation fails.
+// usage:
+//	var u User
+//	if err := c.BindBody(&u); err != nil {
+//		if berr, ok := err.(*beego.BindError); ok {
+//			c.Data["json"] = berr.Errors
+//		}
+//	}
+func (c *Controller) BindBody(obj interface{}) error {
+	if err := bindBody(c.Ctx, obj); err != nil {
+		if err == ErrBodyTooLarge {
+			c.CustomAbort(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return err
+	}
+	valid := validation.Validation{}
+	ok, err := valid.Valid(obj)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &BindError{Errors: valid.Errors}
+	}
+	return nil
+}
+
+func bindBody(ctx *context.Context, obj interface{}) error {
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(ctx.Input.Header("Content-Type"), ";", 2)[0]))
+	if ct == "" {
+		return decodeForm(ctx, obj)
+	}
+	if d, ok := bodyDecoders[ct]; ok {
+		return d(ctx, obj)
+	}
+	// application/vnd.api+json, application/atom+xml
+	switch {
+	case strings.HasSuffix(ct, "+json"):
+		return decodeJson(ctx, obj)
+	case strings.HasSuffix(ct, "+xml"):
+		return decodeXml(ctx, obj)
+	}
+	return ErrUnsupportedContentType
+}
+
+// requestBody returns the copied request body, it's read at the first call.
+// the body is limited by MaxMemory, ErrBodyTooLarge is returned if it exceeds.
+func requestBody(ctx *context.Context) ([]byte, error) {
+	max := appSettings(ctx).MaxMemory
+	if ctx.Input.RequestBody == nil {
+		body := http.MaxBytesReader(ctx.ResponseWriter, ctx.Request.Body, max)
+		b, err := ioutil.ReadAll(body)
+		body.Close()
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if err != nil {
+			if int64(len(b)) >= max {
+				return nil, ErrBodyTooLarge
+			}
+			return nil, err
+		}
+		ctx.Input.RequestBody = b
+	}
+	if int64(len(ctx.Input.RequestBody)) > max {
+		return nil, ErrBodyTooLarge
+	}
+	return ctx.Input.RequestBody, nil
+}
+
+func decodeJson(ctx *context.Context, obj interface{}) error {
+	b, err := requestBody(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, obj)
+}
+
+func decodeXml(ctx *context.Context, obj interface{}) error {
+	b, err := requestBody(ctx)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, obj)
+}
+
+func decodeForm(ctx *context.Context, obj interface{}) error {
+	if ctx.Request.Form == nil {
+		if err := ctx.Input.ParseFormOrMulitForm(appSettings(ctx).MaxMemory); err != nil {
+			return err
+		}
+	}
+	return ParseForm(ctx.Request.Form, obj)
+}
@@ -15,9 +15,13 @@
 package cache
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/astaxie/beego/metrics"
 )
 
 func TestCache(t *testing.T) {
@@ -164,3 +168,23 @@ func TestFileCache(t *testing.T) {
 
 	os.RemoveAll("cache")
 }
+
+func TestMetricsCache(t *testing.T) {
+	bm := NewMetricsCache("test", NewMemoryCache())
+	bm.Put("astaxie", "author", 10)
+	bm.Get("astaxie")
+	bm.Get("nobody")
+	bm.GetMulti([]string{"astaxie", "nobody"})
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	for _, want := range []string{
+		`beego_cache_gets_total{cache="test",result="hit"} 2`,
+		`beego_cache_gets_total{cache="test",result="miss"} 2`,
+		`beego_cache_hit_ratio{cache="test"} 0.5`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Error("the metrics don't contain", want)
+		}
+	}
+}
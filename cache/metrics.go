@@ -0,0 +1,78 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+
+	"github.com/astaxie/beego/metrics"
+)
+
+var (
+	cacheGets     = metrics.NewCounter("beego_cache_gets_total", "The gets of the caches by result.", "cache", "result")
+	cacheHitRatio = metrics.NewGauge("beego_cache_hit_ratio", "The ratio of the gets hitting the caches.", "cache")
+)
+
+// MetricsCache records the hits and the misses of the cache in beego/metrics.
+type MetricsCache struct {
+	Cache
+	name string
+
+	mu     sync.Mutex
+	hits   int64
+	misses int64
+}
+
+// NewMetricsCache wraps the cache, its gets are recorded with the name.
+// usage:
+//	bm, _ := cache.NewCache("redis", `{"conn":"127.0.0.1:6379"}`)
+//	bm = cache.NewMetricsCache("redis", bm)
+func NewMetricsCache(name string, c Cache) *MetricsCache {
+	return &MetricsCache{Cache: c, name: name}
+}
+
+// Get gets the cached value and records if it's a hit.
+func (mc *MetricsCache) Get(key string) interface{} {
+	v := mc.Cache.Get(key)
+	mc.record(v != nil)
+	return v
+}
+
+// GetMulti gets the cached values and records the hits.
+func (mc *MetricsCache) GetMulti(keys []string) []interface{} {
+	vs := mc.Cache.GetMulti(keys)
+	for _, v := range vs {
+		mc.record(v != nil)
+	}
+	return vs
+}
+
+func (mc *MetricsCache) record(hit bool) {
+	mc.mu.Lock()
+	if hit {
+		mc.hits++
+	} else {
+		mc.misses++
+	}
+	ratio := float64(mc.hits) / float64(mc.hits+mc.misses)
+	mc.mu.Unlock()
+
+	if hit {
+		cacheGets.Inc(mc.name, "hit")
+	} else {
+		cacheGets.Inc(mc.name, "miss")
+	}
+	cacheHitRatio.Set(ratio, mc.name)
+}
@@ -0,0 +1,598 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/cache"
+)
+
+// LetsEncryptURL is the directory url of Let's Encrypt.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+const (
+	accountKeyName  = "acme_account.key"
+	accountKeyTTL   = 86400 * 365 * 10 // the account key is kept for ten years in Cache
+	challengePrefix = "/.well-known/acme-challenge/"
+)
+
+// ACME obtains and renews the certificates by the ACME protocol (RFC 8555) with the http-01 challenge,
+// the challenges are answered by HTTPHandler which must serve the port 80.
+// it can be tested with a local ACME server such as pebble by DirectoryURL and Client.
+// usage:
+//
+//	c, _ := cache.NewCache("file", `{"CachePath":"./certs","FileSuffix":".pem","DirectoryLevel":1,"EmbedExpiry":0}`)
+//	m := certs.NewManager()
+//	m.ACME = &certs.ACME{
+//		Email: "admin@example.com",
+//		Hosts: []string{"example.com", "www.example.com"},
+//		Cache: c,
+//	}
+type ACME struct {
+	DirectoryURL string        // directory of the CA, LetsEncryptURL by default
+	Email        string        // contact of the account
+	Hosts        []string      // the names allowed to get a certificate, no certificate is issued if it's empty
+	Cache        cache.Cache   // stores the account key and the certificates, they are kept in memory only if it's nil
+	Client       *http.Client  // http client talking to the CA
+	RenewBefore  time.Duration // renew the certificate before it expires, 30 days by default
+
+	mu       sync.Mutex
+	regMu    sync.Mutex // serializes register
+	nonceMu  sync.Mutex
+	dir      *acmeDirectory
+	key      *ecdsa.PrivateKey // account key
+	kid      string            // account url
+	nonces   []string
+	certs    map[string]*tls.Certificate
+	pending  map[string]*acmeCall // the names being obtained
+	tokens   map[string]string    // http-01 token -> key authorization
+	renewing map[string]bool
+}
+
+type acmeCall struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	url            string
+}
+
+type acmeAuthz struct {
+	Status     string          `json:"status"`
+	Challenges []acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type   string     `json:"type"`
+	Url    string     `json:"url"`
+	Token  string     `json:"token"`
+	Status string     `json:"status"`
+	Error  *AcmeError `json:"error"`
+}
+
+// AcmeError is the problem document returned by the CA.
+type AcmeError struct {
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (e *AcmeError) Error() string {
+	return fmt.Sprintf("acme: %d %s: %s", e.Status, e.Type, e.Detail)
+}
+
+// GetCertificate returns the certificate of the server name,
+// it's loaded from Cache or obtained from the CA at the first handshake of the name,
+// then it's renewed in background before it expires.
+func (a *ACME) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" || strings.Contains(name, "/") {
+		return nil, ErrNoCertificate
+	}
+	if !a.allowed(name) {
+		return nil, fmt.Errorf("certs: host %q is not allowed", name)
+	}
+
+	a.mu.Lock()
+	if a.certs == nil {
+		a.certs = make(map[string]*tls.Certificate)
+	}
+	cert, ok := a.certs[name]
+	a.mu.Unlock()
+	if !ok {
+		if cert, ok = a.cached(name); ok {
+			a.mu.Lock()
+			a.certs[name] = cert
+			a.mu.Unlock()
+		}
+	}
+	if ok {
+		if time.Now().Add(a.renewBefore()).After(cert.Leaf.NotAfter) {
+			a.renew(name)
+		}
+		if time.Now().Before(cert.Leaf.NotAfter) {
+			return cert, nil
+		}
+	}
+	return a.obtain(name)
+}
+
+// HTTPHandler answers the http-01 challenges, other requests are served by fallback,
+// the requests are redirected to https if fallback is nil.
+func (a *ACME) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePrefix) {
+			if fallback != nil {
+				fallback.ServeHTTP(w, r)
+			} else {
+				http.Redirect(w, r, "https://"+strings.Split(r.Host, ":")[0]+r.URL.RequestURI(), http.StatusFound)
+			}
+			return
+		}
+		a.mu.Lock()
+		keyAuth, ok := a.tokens[strings.TrimPrefix(r.URL.Path, challengePrefix)]
+		a.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// allowed checks the name is in Hosts, any name sent by the clients would order a certificate without it.
+func (a *ACME) allowed(name string) bool {
+	for _, h := range a.Hosts {
+		if strings.ToLower(h) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ACME) renewBefore() time.Duration {
+	if a.RenewBefore > 0 {
+		return a.RenewBefore
+	}
+	return 30 * 24 * time.Hour
+}
+
+// renew obtains the new certificate in background, the old one is served until it's done.
+func (a *ACME) renew(name string) {
+	a.mu.Lock()
+	if a.renewing == nil {
+		a.renewing = make(map[string]bool)
+	}
+	if a.renewing[name] {
+		a.mu.Unlock()
+		return
+	}
+	a.renewing[name] = true
+	a.mu.Unlock()
+	go func() {
+		a.obtain(name)
+		a.mu.Lock()
+		delete(a.renewing, name)
+		a.mu.Unlock()
+	}()
+}
+
+// obtain gets the certificate from the CA, the concurrent calls of a name share one order.
+func (a *ACME) obtain(name string) (*tls.Certificate, error) {
+	a.mu.Lock()
+	if a.pending == nil {
+		a.pending = make(map[string]*acmeCall)
+	}
+	if c, ok := a.pending[name]; ok {
+		a.mu.Unlock()
+		<-c.done
+		return c.cert, c.err
+	}
+	c := &acmeCall{done: make(chan struct{})}
+	a.pending[name] = c
+	a.mu.Unlock()
+
+	c.cert, c.err = a.order(name)
+
+	a.mu.Lock()
+	if c.err == nil {
+		a.certs[name] = c.cert
+	}
+	delete(a.pending, name)
+	a.mu.Unlock()
+	close(c.done)
+	return c.cert, c.err
+}
+
+// order runs the ACME flow: account, new order, http-01 challenges, finalize and download.
+func (a *ACME) order(name string) (*tls.Certificate, error) {
+	if err := a.register(); err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": name}},
+	}
+	o := &acmeOrder{}
+	resp, err := a.post(a.dir.NewOrder, payload, o)
+	if err != nil {
+		return nil, err
+	}
+	o.url = resp.Header.Get("Location")
+
+	for _, u := range o.Authorizations {
+		if err := a.authorize(u); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: name},
+		DNSNames: []string{name},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.post(o.Finalize, map[string]string{"csr": b64(csr)}, o); err != nil {
+		return nil, err
+	}
+	for i := 0; o.Status != "valid"; i++ {
+		if o.Status == "invalid" || i > 30 {
+			return nil, fmt.Errorf("certs: order of %s is %s", name, o.Status)
+		}
+		time.Sleep(time.Second)
+		if _, err := a.post(o.url, nil, o); err != nil {
+			return nil, err
+		}
+	}
+
+	var chain []byte
+	if _, err = a.post(o.Certificate, nil, &chain); err != nil {
+		return nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	cert, err := tls.X509KeyPair(chain, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	if a.Cache != nil {
+		a.Cache.Put(name, append(keyPem, chain...), int64(cert.Leaf.NotAfter.Sub(time.Now())/time.Second))
+	}
+	return &cert, nil
+}
+
+// authorize answers the http-01 challenge of the authorization and waits for the result.
+func (a *ACME) authorize(u string) error {
+	authz := &acmeAuthz{}
+	if _, err := a.post(u, nil, authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	var ch *acmeChallenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "http-01" {
+			ch = &authz.Challenges[i]
+		}
+	}
+	if ch == nil {
+		return errors.New("certs: no http-01 challenge is offered")
+	}
+
+	thumb, err := thumbprint(&a.key.PublicKey)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	if a.tokens == nil {
+		a.tokens = make(map[string]string)
+	}
+	a.tokens[ch.Token] = ch.Token + "." + thumb
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.tokens, ch.Token)
+		a.mu.Unlock()
+	}()
+
+	if _, err := a.post(ch.Url, struct{}{}, nil); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if _, err := a.post(u, nil, authz); err != nil {
+			return err
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+			if i > 30 {
+				return errors.New("certs: authorization timeout")
+			}
+			time.Sleep(time.Second)
+		default:
+			for _, c := range authz.Challenges {
+				if c.Error != nil {
+					return c.Error
+				}
+			}
+			return fmt.Errorf("certs: authorization is %s", authz.Status)
+		}
+	}
+}
+
+// register loads the directory and creates or finds the account.
+func (a *ACME) register() error {
+	a.regMu.Lock()
+	defer a.regMu.Unlock()
+	if a.kid != "" {
+		return nil
+	}
+	url := a.DirectoryURL
+	if url == "" {
+		url = LetsEncryptURL
+	}
+	resp, err := a.client().Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dir := &acmeDirectory{}
+	if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+		return err
+	}
+	a.dir = dir
+
+	if a.key, err = a.accountKey(); err != nil {
+		return err
+	}
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if a.Email != "" {
+		account["contact"] = []string{"mailto:" + a.Email}
+	}
+	resp, err = a.post(a.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	a.kid = resp.Header.Get("Location")
+	return nil
+}
+
+// accountKey loads the account key from Cache, it's generated at the first time.
+func (a *ACME) accountKey() (*ecdsa.PrivateKey, error) {
+	if a.Cache != nil {
+		if data, ok := a.Cache.Get(accountKeyName).([]byte); ok {
+			if block, _ := pem.Decode(data); block != nil {
+				return x509.ParseECPrivateKey(block.Bytes)
+			}
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if a.Cache != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		a.Cache.Put(accountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), accountKeyTTL)
+	}
+	return key, nil
+}
+
+// cached loads the certificate of the name from Cache.
+func (a *ACME) cached(name string) (*tls.Certificate, bool) {
+	if a.Cache == nil {
+		return nil, false
+	}
+	data, ok := a.Cache.Get(name).([]byte)
+	if !ok {
+		return nil, false
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil || parseLeaf(&cert) != nil {
+		return nil, false
+	}
+	return &cert, true
+}
+
+func (a *ACME) client() *http.Client {
+	if a.Client != nil {
+		return a.Client
+	}
+	return http.DefaultClient
+}
+
+// post sends the JWS signed request, the nil payload is a POST-as-GET.
+// the response is decoded into result, or read into it if it's *[]byte, the body is closed when it returns.
+// the request is retried once if the nonce is rejected.
+func (a *ACME) post(url string, payload, result interface{}) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		body, err := a.sign(url, payload)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := a.client().Post(url, "application/jose+json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+			a.nonceMu.Lock()
+			a.nonces = append(a.nonces, nonce)
+			a.nonceMu.Unlock()
+		}
+		if resp.StatusCode >= 400 {
+			e := &AcmeError{Status: resp.StatusCode}
+			json.NewDecoder(resp.Body).Decode(e)
+			resp.Body.Close()
+			if e.Type == "urn:ietf:params:acme:error:badNonce" && retry == 0 {
+				continue
+			}
+			return nil, e
+		}
+		defer resp.Body.Close()
+		switch v := result.(type) {
+		case nil:
+			io.Copy(ioutil.Discard, resp.Body)
+		case *[]byte:
+			if *v, err = ioutil.ReadAll(resp.Body); err != nil {
+				return nil, err
+			}
+		default:
+			if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+				return nil, err
+			}
+		}
+		return resp, nil
+	}
+}
+
+// sign returns the flattened JWS of the payload signed by the account key with ES256.
+func (a *ACME) sign(url string, payload interface{}) ([]byte, error) {
+	nonce, err := a.nonce()
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if a.kid != "" {
+		protected["kid"] = a.kid
+	} else {
+		protected["jwk"] = jwk(&a.key.PublicKey)
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var body string
+	if payload != nil {
+		p, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = b64(p)
+	}
+	input := b64(header) + "." + body
+	hash := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   body,
+		"signature": b64(sig),
+	})
+}
+
+func (a *ACME) nonce() (string, error) {
+	a.nonceMu.Lock()
+	if n := len(a.nonces); n > 0 {
+		nonce := a.nonces[n-1]
+		a.nonces = a.nonces[:n-1]
+		a.nonceMu.Unlock()
+		return nonce, nil
+	}
+	a.nonceMu.Unlock()
+	resp, err := a.client().Head(a.dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("certs: no nonce from the CA")
+	}
+	return nonce, nil
+}
+
+func jwk(pub *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(padded(pub.X)),
+		"y":   b64(padded(pub.Y)),
+	}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the account key, used in the key authorization.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("certs: unsupported account key")
+	}
+	k := jwk(key)
+	// the members must be in lexicographic order
+	s := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, k["crv"], k["kty"], k["x"], k["y"])
+	sum := sha256.Sum256([]byte(s))
+	return b64(sum[:]), nil
+}
+
+func padded(n *big.Int) []byte {
+	b := make([]byte, 32)
+	return n.FillBytes(b)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,284 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/cache"
+)
+
+// selfSigned returns the PEM of a certificate and its key for the names.
+func selfSigned(t *testing.T, serial int64, names ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeCert(t *testing.T, dir, name string, serial int64, names ...string) (string, string) {
+	certPem, keyPem := selfSigned(t, serial, names...)
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, certPem, 0600)
+	ioutil.WriteFile(keyFile, keyPem, 0600)
+	return certFile, keyFile
+}
+
+func serialOf(t *testing.T, m *Manager, name string) int64 {
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+	if err != nil {
+		t.Fatalf("GetCertificate(%q) error: %v", name, err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestManagerSNI(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "beego-certs")
+	defer os.RemoveAll(dir)
+
+	m := NewManager()
+	if err := m.AddFile(writeCert(t, dir, "www", 1, "www.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddFile(writeCert(t, dir, "wild", 2, "*.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	apiPem, apiKey := selfSigned(t, 3, "api.example.org")
+	api, _ := tls.X509KeyPair(apiPem, apiKey)
+	if err := m.AddCertificate(api); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]int64{
+		"www.example.com":  1,
+		"WWW.Example.com.": 1,
+		"img.example.com":  2,
+		"api.example.org":  3,
+		"":                 1,
+		"unknown.net":      1,
+	}
+	for name, serial := range cases {
+		if s := serialOf(t, m, name); s != serial {
+			t.Errorf("GetCertificate(%q) get serial %d, want %d", name, s, serial)
+		}
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "beego-certs")
+	defer os.RemoveAll(dir)
+
+	m := NewManager()
+	certFile, keyFile := writeCert(t, dir, "www", 1, "www.example.com")
+	if err := m.AddFile(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// a broken file keeps the old certificate
+	ioutil.WriteFile(certFile, []byte("broken"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if err := m.Reload(); err == nil {
+		t.Errorf("Reload of a broken file should fail")
+	}
+	if s := serialOf(t, m, "www.example.com"); s != 1 {
+		t.Errorf("the broken file replaced the certificate, get serial %d", s)
+	}
+
+	writeCert(t, dir, "www", 2, "www.example.com")
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s := serialOf(t, m, "www.example.com"); s != 2 {
+		t.Errorf("Reload get serial %d, want 2", s)
+	}
+}
+
+// fakeCA is a minimal ACME server, it validates the http-01 challenge by the handler of the client.
+type fakeCA struct {
+	*httptest.Server
+	t         *testing.T
+	challenge http.Handler
+	key       *ecdsa.PrivateKey
+	ca        *x509.Certificate
+	authz     string
+	order     string
+	cert      []byte
+	orders    int
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	f := &fakeCA{t: t, authz: "pending", order: "pending"}
+	f.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "fake ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tpl, tpl, &f.key.PublicKey, f.key)
+	f.ca, _ = x509.ParseCertificate(der)
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	u := f.URL
+	w.Header().Set("Replay-Nonce", "nonce")
+	if r.Method == "POST" && r.Header.Get("Content-Type") != "application/jose+json" {
+		http.Error(w, "bad content type", 400)
+		return
+	}
+	var jws struct{ Protected, Payload string }
+	if r.Method == "POST" {
+		json.NewDecoder(r.Body).Decode(&jws)
+	}
+	switch r.URL.Path {
+	case "/dir":
+		json.NewEncoder(w).Encode(map[string]string{"newNonce": u + "/nonce", "newAccount": u + "/account", "newOrder": u + "/order"})
+	case "/nonce":
+	case "/account":
+		w.Header().Set("Location", u+"/acct/1")
+		w.WriteHeader(201)
+		w.Write([]byte("{}"))
+	case "/order", "/order/1":
+		if r.URL.Path == "/order" {
+			f.orders++
+			w.Header().Set("Location", u+"/order/1")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": f.order, "authorizations": []string{u + "/authz/1"},
+			"finalize": u + "/finalize/1", "certificate": u + "/cert/1",
+		})
+	case "/authz/1":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     f.authz,
+			"challenges": []map[string]string{{"type": "http-01", "url": u + "/chal/1", "token": "tok"}},
+		})
+	case "/chal/1":
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://www.example.com/.well-known/acme-challenge/tok", nil)
+		f.challenge.ServeHTTP(rec, req)
+		if strings.HasPrefix(rec.Body.String(), "tok.") {
+			f.authz = "valid"
+		} else {
+			f.authz = "invalid"
+		}
+		w.Write([]byte("{}"))
+	case "/finalize/1":
+		payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+		var req struct{ Csr string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.Csr)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, `{"type":"urn:ietf:params:acme:error:badCSR"}`, 400)
+			return
+		}
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(200),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		cert, _ := x509.CreateCertificate(rand.Reader, tpl, f.ca, csr.PublicKey, f.key)
+		f.cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+		f.order = "valid"
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": f.order, "certificate": u + "/cert/1"})
+	case "/cert/1":
+		w.Write(f.cert)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestACME(t *testing.T) {
+	ca := newFakeCA(t)
+	defer ca.Close()
+	c, _ := cache.NewCache("memory", `{"interval":60}`)
+
+	m := NewManager()
+	m.ACME = &ACME{DirectoryURL: ca.URL + "/dir", Email: "admin@example.com", Hosts: []string{"www.example.com"}, Cache: c}
+	ca.challenge = m.HTTPHandler(nil)
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example.com"}); err == nil {
+		t.Errorf("ACME get the certificate of a host not allowed")
+	}
+	if s := serialOf(t, m, "www.example.com"); s != 200 {
+		t.Fatalf("ACME get serial %d, want 200", s)
+	}
+	serialOf(t, m, "www.example.com")
+	if ca.orders != 1 {
+		t.Errorf("the certificate is ordered %d times", ca.orders)
+	}
+
+	// another instance sharing the cache doesn't order again
+	other := &ACME{DirectoryURL: ca.URL + "/dir", Hosts: []string{"www.example.com"}, Cache: c}
+	cert, err := other.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	if err != nil || cert.Leaf.SerialNumber.Int64() != 200 || ca.orders != 1 {
+		t.Errorf("the certificate isn't loaded from the cache: %v, orders %d", err, ca.orders)
+	}
+
+	// no certificate is issued without Hosts
+	none := &ACME{DirectoryURL: ca.URL + "/dir", Cache: c}
+	if _, err := none.GetCertificate(&tls.ClientHelloInfo{ServerName: "any.example.com"}); err == nil || ca.orders != 1 {
+		t.Errorf("ACME without Hosts get the certificate, orders %d", ca.orders)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://www.example.com/index", nil)
+	ca.challenge.ServeHTTP(w, r)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://www.example.com/index" {
+		t.Errorf("HTTPHandler get %d %q, want the redirect to https", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package certs manages the https certificates: several certificates selected by SNI,
+// reloading the certificate files without restarting the server,
+// and obtaining the certificates from an ACME CA such as Let's Encrypt.
+//
+// Usage:
+//
+//	m := certs.NewManager()
+//	m.AddFile("conf/www.pem", "conf/www.key")
+//	m.AddFile("conf/api.pem", "conf/api.key")
+//	m.Watch(time.Minute)
+//	m.ReloadOnSignal(syscall.SIGUSR1)
+//
+//	srv := &http.Server{Addr: ":443", TLSConfig: m.TLSConfig()}
+//	srv.ListenAndServeTLS("", "")
+//
+// with beego:
+//
+//	beego.HttpsCertManager = m
+//	beego.Run()
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNoCertificate is returned by GetCertificate when no certificate matches the server name.
+var ErrNoCertificate = errors.New("certs: no certificate for the server name")
+
+// Manager selects the certificate by the server name of the tls handshake (SNI).
+// the certificates are loaded from files or added in memory,
+// the name without a certificate is obtained by ACME if it's set.
+type Manager struct {
+	// ACME obtains the certificates for the names not matched by the loaded certificates.
+	ACME *ACME
+
+	mu       sync.RWMutex
+	reloadMu sync.Mutex // serializes Reload
+	files    []*fileCert
+	certs    []*tls.Certificate
+	names    map[string]*tls.Certificate // dns names of the certificates, lower case
+	def      *tls.Certificate            // the first certificate, used when the client doesn't send SNI
+	stop     chan struct{}
+}
+
+// fileCert is a certificate loaded from the files.
+type fileCert struct {
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+// NewManager returns an empty Manager.
+func NewManager() *Manager {
+	return &Manager{names: make(map[string]*tls.Certificate)}
+}
+
+// AddFile loads the certificate and key files,
+// the files are loaded again by Reload when they are changed.
+func (m *Manager) AddFile(certFile, keyFile string) error {
+	f := &fileCert{certFile: certFile, keyFile: keyFile}
+	if err := f.load(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.files = append(m.files, f)
+	m.rebuild()
+	m.mu.Unlock()
+	return nil
+}
+
+// AddCertificate adds the certificate in memory.
+func (m *Manager) AddCertificate(cert tls.Certificate) error {
+	if err := parseLeaf(&cert); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.certs = append(m.certs, &cert)
+	m.rebuild()
+	m.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the certificate of the server name, it's used as tls.Config.GetCertificate.
+// the exact name goes first, then the wildcard name like *.example.com,
+// then ACME, the first certificate is returned if the client doesn't send SNI.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	m.mu.RLock()
+	cert := m.lookup(name)
+	def := m.def
+	m.mu.RUnlock()
+	if cert != nil {
+		return cert, nil
+	}
+	if name != "" && m.ACME != nil {
+		return m.ACME.GetCertificate(hello)
+	}
+	if def != nil {
+		return def, nil
+	}
+	return nil, ErrNoCertificate
+}
+
+// Names returns the dns names of the loaded certificates.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.names))
+	for name := range m.names {
+		names = append(names, name)
+	}
+	return names
+}
+
+// TLSConfig returns the tls.Config serving the certificates of m.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: m.GetCertificate}
+}
+
+// HTTPHandler answers the http-01 challenges of ACME, other requests are served by fallback.
+// it's fallback itself if ACME isn't set.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if m.ACME == nil {
+		return fallback
+	}
+	return m.ACME.HTTPHandler(fallback)
+}
+
+// Reload loads the certificate files changed since the last load,
+// the old certificate is kept if the new one fails to load.
+func (m *Manager) Reload() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.mu.RLock()
+	files := append([]*fileCert(nil), m.files...)
+	m.mu.RUnlock()
+
+	var errs []string
+	reloaded := make(map[*fileCert]*fileCert)
+	for _, f := range files {
+		if !f.changed() {
+			continue
+		}
+		nf := &fileCert{certFile: f.certFile, keyFile: f.keyFile}
+		if err := nf.load(); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		reloaded[f] = nf
+	}
+	if len(reloaded) > 0 {
+		m.mu.Lock()
+		for f, nf := range reloaded {
+			f.cert, f.modTime = nf.cert, nf.modTime
+		}
+		m.rebuild()
+		m.mu.Unlock()
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Watch checks the certificate files every interval and reloads the changed ones.
+func (m *Manager) Watch(interval time.Duration) {
+	stop := m.stopChan()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					fmt.Fprintln(os.Stderr, "certs: reload error:", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ReloadOnSignal reloads the certificate files when the signal is received, SIGHUP by default.
+// the grace server forks on SIGHUP, use another signal like SIGUSR1 with it.
+func (m *Manager) ReloadOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	stop := m.stopChan()
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if err := m.Reload(); err != nil {
+					fmt.Fprintln(os.Stderr, "certs: reload error:", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops Watch and ReloadOnSignal.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+func (m *Manager) stopChan() chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop == nil {
+		m.stop = make(chan struct{})
+	}
+	return m.stop
+}
+
+// lookup finds the certificate by the exact name, then the wildcard name.
+func (m *Manager) lookup(name string) *tls.Certificate {
+	if name == "" {
+		return nil
+	}
+	if cert, ok := m.names[name]; ok {
+		return cert
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := m.names["*"+name[i:]]; ok {
+			return cert
+		}
+	}
+	return nil
+}
+
+// rebuild indexes the certificates by their names, the earlier one wins.
+func (m *Manager) rebuild() {
+	m.names = make(map[string]*tls.Certificate)
+	m.def = nil
+	var all []*tls.Certificate
+	for _, f := range m.files {
+		all = append(all, f.cert)
+	}
+	all = append(all, m.certs...)
+	for _, cert := range all {
+		if m.def == nil {
+			m.def = cert
+		}
+		for _, name := range certNames(cert.Leaf) {
+			if _, ok := m.names[name]; !ok {
+				m.names[name] = cert
+			}
+		}
+	}
+}
+
+func (f *fileCert) load() error {
+	fi, err := os.Stat(f.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("certs: load %s: %v", f.certFile, err)
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return err
+	}
+	f.cert = &cert
+	f.modTime = fi.ModTime()
+	if ki, err := os.Stat(f.keyFile); err == nil && ki.ModTime().After(f.modTime) {
+		f.modTime = ki.ModTime()
+	}
+	return nil
+}
+
+// changed checks if the certificate or key file is modified after it's loaded.
+func (f *fileCert) changed() bool {
+	for _, file := range []string{f.certFile, f.keyFile} {
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(f.modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLeaf(cert *tls.Certificate) error {
+	if cert.Leaf != nil {
+		return nil
+	}
+	if len(cert.Certificate) == 0 {
+		return errors.New("certs: empty certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+// certNames returns the dns names of the certificate, the common name is used if there's no SAN.
+func certNames(leaf *x509.Certificate) []string {
+	var names []string
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	return names
+}
@@ -17,12 +17,15 @@ package beego
 import (
 	"fmt"
 	"html/template"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 
+	"github.com/astaxie/beego/certs"
 	"github.com/astaxie/beego/config"
+	"github.com/astaxie/beego/context"
 	"github.com/astaxie/beego/logs"
 	"github.com/astaxie/beego/session"
 	"github.com/astaxie/beego/utils"
@@ -66,6 +69,7 @@ var (
 	DirectoryIndex         bool // flag of display directory index. default is false.
 	HttpServerTimeOut      int64
 	ErrorsShow             bool   // flag of show errors in page. if true, show error and trace info in page rendered with error template.
+	ErrorsProblemJson      bool   // write the errors as application/problem+json (RFC 7807) instead of the error pages.
 	XSRFKEY                string // xsrf hash salt string.
 	EnableXSRF             bool   // flag of enable xsrf.
 	XSRFExpire             int    // the expiry of xsrf value.
@@ -85,6 +89,184 @@ var (
 	Graceful               bool   // use graceful start the server
 )
 
+// HttpsCertManager selects the https certificates by SNI and reloads them,
+// HttpCertFile and HttpKeyFile are ignored if it's set.
+// usage:
+//	m := certs.NewManager()
+//	m.AddFile("conf/www.pem", "conf/www.key")
+//	m.AddFile("conf/api.pem", "conf/api.key")
+//	m.Watch(time.Minute)
+//	beego.HttpsCertManager = m
+var HttpsCertManager *certs.Manager
+
+// AccessLogsFormat is the format of the access logs when AccessLogs is on,
+// "json" or "combined" (the Apache combined log format) writes a record with the request id, status and bytes to AccessLogger,
+// the default "" prints the short debug line.
+var AccessLogsFormat string
+
+// the static files served besides StaticDir, the keys are the url prefixes like StaticDir.
+// usage:
+//	beego.SetStaticCacheControl("/static/assets", "public, max-age=31536000, immutable")
+//	beego.SetStaticFallback("/app", "index.html")
+//	beego.SetStaticFileSystem("/docs", http.Dir("docs"))
+var (
+	StaticCacheControl map[string]string          // the Cache-Control of the static files, the longest matched prefix is used
+	StaticFallback     map[string]string          // the file served for the unknown paths without extension, such as index.html of a single page app
+	StaticFileSystem   map[string]http.FileSystem // the static files served from http.FileSystem such as the assets embedded in the binary
+)
+
+// Settings configures an App, the requests of the App are served by its own Settings.
+// the App created by NewApp and BeeApp have no Settings, they use the global variables.
+type Settings struct {
+	RunMode                string // "dev" or "prod"
+	EnableHttpListen       bool
+	HttpAddr               string
+	HttpPort               int
+	ListenTCP4             bool
+	EnableHttpTLS          bool
+	HttpsPort              int
+	HttpCertFile           string
+	HttpKeyFile            string
+	HttpsCertManager       *certs.Manager
+	HttpServerTimeOut      int64
+	UseFcgi                bool
+	UseStdIo               bool
+	Graceful               bool
+	RecoverPanic           bool
+	AutoRender             bool
+	CopyRequestBody        bool
+	MaxMemory              int64
+	EnableGzip             bool
+	RouterCaseSensitive    bool
+	AccessLogs             bool
+	AccessLogsFormat       string // "", "json" or "combined"
+	ErrorsShow             bool
+	ErrorsProblemJson      bool
+	BeegoServerName        string
+	EnableXSRF             bool
+	XSRFKEY                string
+	XSRFExpire             int
+	SessionOn              bool
+	Sessions               *session.Manager // the session manager, required if SessionOn
+	StaticDir              map[string]string
+	StaticExtensionsToGzip []string
+	StaticCacheControl     map[string]string
+	StaticFallback         map[string]string
+	StaticFileSystem       map[string]http.FileSystem
+	DirectoryIndex         bool
+	ViewsPath              string
+	TemplateLeft           string
+	TemplateRight          string
+	TemplateCache          map[string]*template.Template // the templates parsed from ViewsPath, keyed by the file name
+}
+
+// NewSettings returns the Settings copied from the global variables.
+// usage:
+//	cfg := beego.NewSettings()
+//	cfg.HttpPort = 8089
+//	cfg.ErrorsProblemJson = true
+//	cfg.StaticDir = map[string]string{}
+//	cfg.ViewsPath = "admin/views"
+//	admin := beego.NewAppWithSettings(cfg)
+func NewSettings() *Settings {
+	c := *globalSettings()
+	cfg := &c
+	cfg.StaticDir = make(map[string]string, len(StaticDir))
+	for k, v := range StaticDir {
+		cfg.StaticDir[k] = v
+	}
+	cfg.StaticExtensionsToGzip = append([]string(nil), StaticExtensionsToGzip...)
+	cfg.StaticCacheControl = make(map[string]string, len(StaticCacheControl))
+	for k, v := range StaticCacheControl {
+		cfg.StaticCacheControl[k] = v
+	}
+	cfg.StaticFallback = make(map[string]string, len(StaticFallback))
+	for k, v := range StaticFallback {
+		cfg.StaticFallback[k] = v
+	}
+	cfg.StaticFileSystem = make(map[string]http.FileSystem, len(StaticFileSystem))
+	for k, v := range StaticFileSystem {
+		cfg.StaticFileSystem[k] = v
+	}
+	cfg.TemplateCache = make(map[string]*template.Template)
+	return cfg
+}
+
+// BuildTemplate parses the template files in ViewsPath into TemplateCache,
+// it's called by Start and by the Render of the dev mode.
+func (cfg *Settings) BuildTemplate() error {
+	if cfg.TemplateCache == nil {
+		cfg.TemplateCache = make(map[string]*template.Template)
+	}
+	return buildTemplate(cfg.ViewsPath, cfg.TemplateCache, cfg.TemplateLeft, cfg.TemplateRight)
+}
+
+// globalSettings returns the Settings of the global variables, it's used by the apps without Settings.
+// the global variables are read at every call, the requests keep the Settings read when they start.
+func globalSettings() *Settings {
+	return &Settings{
+		RunMode:                RunMode,
+		EnableHttpListen:       EnableHttpListen,
+		HttpAddr:               HttpAddr,
+		HttpPort:               HttpPort,
+		ListenTCP4:             ListenTCP4,
+		EnableHttpTLS:          EnableHttpTLS,
+		HttpsPort:              HttpsPort,
+		HttpCertFile:           HttpCertFile,
+		HttpKeyFile:            HttpKeyFile,
+		HttpsCertManager:       HttpsCertManager,
+		HttpServerTimeOut:      HttpServerTimeOut,
+		UseFcgi:                UseFcgi,
+		UseStdIo:               UseStdIo,
+		Graceful:               Graceful,
+		RecoverPanic:           RecoverPanic,
+		AutoRender:             AutoRender,
+		CopyRequestBody:        CopyRequestBody,
+		MaxMemory:              MaxMemory,
+		EnableGzip:             EnableGzip,
+		RouterCaseSensitive:    RouterCaseSensitive,
+		AccessLogs:             AccessLogs,
+		AccessLogsFormat:       AccessLogsFormat,
+		ErrorsShow:             ErrorsShow,
+		ErrorsProblemJson:      ErrorsProblemJson,
+		BeegoServerName:        BeegoServerName,
+		EnableXSRF:             EnableXSRF,
+		XSRFKEY:                XSRFKEY,
+		XSRFExpire:             XSRFExpire,
+		SessionOn:              SessionOn,
+		Sessions:               GlobalSessions,
+		StaticDir:              StaticDir,
+		StaticExtensionsToGzip: StaticExtensionsToGzip,
+		StaticCacheControl:     StaticCacheControl,
+		StaticFallback:         StaticFallback,
+		StaticFileSystem:       StaticFileSystem,
+		DirectoryIndex:         DirectoryIndex,
+		ViewsPath:              ViewsPath,
+		TemplateLeft:           TemplateLeft,
+		TemplateRight:          TemplateRight,
+		TemplateCache:          BeeTemplates,
+	}
+}
+
+// registorKey stores the ControllerRegistor serving the request in Input.Data.
+type registorKey struct{}
+
+// settingsKey stores the Settings read when the request starts in Input.Data.
+type settingsKey struct{}
+
+// appSettings returns the Settings of the app serving the request.
+func appSettings(ctx *context.Context) *Settings {
+	if ctx != nil && ctx.Input != nil {
+		if cfg, ok := ctx.Input.GetData(settingsKey{}).(*Settings); ok {
+			return cfg
+		}
+		if p, ok := ctx.Input.GetData(registorKey{}).(*ControllerRegistor); ok {
+			return p.conf()
+		}
+	}
+	return globalSettings()
+}
+
 type beegoAppConfig struct {
 	innerConfig config.ConfigContainer
 }
@@ -249,6 +431,10 @@ func init() {
 
 	StaticExtensionsToGzip = []string{".css", ".js"}
 
+	StaticCacheControl = make(map[string]string)
+	StaticFallback = make(map[string]string)
+	StaticFileSystem = make(map[string]http.FileSystem)
+
 	TemplateCache = make(map[string]*template.Template)
 
 	// set this to 0.0.0.0 to make this app available to externally
@@ -500,6 +686,24 @@ func ParseConfig() (err error) {
 		}
 	}
 
+	// StaticCacheControl = static/assets:public, max-age=31536000, immutable;static:no-cache
+	if scc := AppConfig.String("StaticCacheControl"); scc != "" {
+		for _, v := range strings.Split(scc, ";") {
+			if url2cc := strings.SplitN(v, ":", 2); len(url2cc) == 2 {
+				StaticCacheControl[staticCacheURL(strings.TrimSpace(url2cc[0]))] = strings.TrimSpace(url2cc[1])
+			}
+		}
+	}
+
+	// StaticFallback = app:index.html
+	if sf := AppConfig.String("StaticFallback"); sf != "" {
+		for _, v := range strings.Fields(sf) {
+			if url2file := strings.SplitN(v, ":", 2); len(url2file) == 2 {
+				StaticFallback[staticURL(url2file[0])] = url2file[1]
+			}
+		}
+	}
+
 	if enableadmin, err := AppConfig.Bool("EnableAdmin"); err == nil {
 		EnableAdmin = enableadmin
 	}
@@ -522,5 +726,14 @@ func ParseConfig() (err error) {
 	if graceful, err := AppConfig.Bool("Graceful"); err == nil {
 		Graceful = graceful
 	}
+	if problemjson, err := AppConfig.Bool("ErrorsProblemJson"); err == nil {
+		ErrorsProblemJson = problemjson
+	}
+	if accesslogs, err := AppConfig.Bool("AccessLogs"); err == nil {
+		AccessLogs = accesslogs
+	}
+	if format := AppConfig.String("AccessLogsFormat"); format != "" {
+		AccessLogsFormat = format
+	}
 	return nil
 }
@@ -15,7 +15,11 @@
 package beego
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/astaxie/beego/context"
 )
 
 func TestDefaults(t *testing.T) {
@@ -27,3 +31,28 @@ func TestDefaults(t *testing.T) {
 		t.Errorf("FlashName was not set to default.")
 	}
 }
+
+func TestGlobalSettingsLive(t *testing.T) {
+	old := ErrorsShow
+	defer func() { ErrorsShow = old }()
+	ErrorsShow = !old
+	if globalSettings().ErrorsShow != !old {
+		t.Errorf("the global Settings doesn't read the changed ErrorsShow")
+	}
+
+	// the request keeps the Settings read when it starts
+	handler := NewControllerRegister()
+	var cfg *Settings
+	handler.Get("/", func(ctx *context.Context) {
+		cfg = appSettings(ctx)
+		ErrorsShow = old
+		if appSettings(ctx) != cfg {
+			t.Errorf("the Settings is read again in the request")
+		}
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if cfg == nil || cfg.ErrorsShow != !old {
+		t.Errorf("the request doesn't serve by the global Settings")
+	}
+}
@@ -22,6 +22,7 @@
 package context
 
 import (
+	gocontext "context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -49,6 +50,13 @@ type Context struct {
 	_xsrf_token string
 }
 
+// RequestContext returns the context.Context of this request.
+// it's canceled when the client closes the connection or the route timeout expires,
+// pass it to the long running operations such as database queries.
+func (ctx *Context) RequestContext() gocontext.Context {
+	return ctx.Request.Context()
+}
+
 // Redirect does redirection to localurl with http header status code.
 // It sends http response header directly.
 func (ctx *Context) Redirect(status int, localurl string) {
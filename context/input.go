@@ -190,6 +190,90 @@ func (input *BeegoInput) AcceptsJson() bool {
 	return acceptsJsonRegex.MatchString(input.Header("Accept"))
 }
 
+// Negotiate returns the best of the offered media types for the Accept header,
+// q-values and the specificity of the media ranges are respected,
+// the earlier offer wins when the q-values are equal.
+// the first offer is returned if the request has no Accept header,
+// "" is returned if none of the offers is acceptable.
+func (input *BeegoInput) Negotiate(offers ...string) string {
+	return NegotiateAccept(input.Header("Accept"), offers...)
+}
+
+// NegotiateAccept returns the best of the offered media types for the Accept header value.
+func NegotiateAccept(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, sub := splitMediaType(strings.ToLower(offer))
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			var s int
+			switch {
+			case r.typ == typ && r.sub == sub:
+				s = 2
+			case r.typ == typ && r.sub == "*":
+				s = 1
+			case r.typ == "*" && r.sub == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+type acceptRange struct {
+	typ, sub string
+	q        float64
+}
+
+// parse the Accept header, like "text/html, application/json;q=0.9, */*;q=0.1"
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{q: 1}
+		r.typ, r.sub = splitMediaType(strings.ToLower(strings.TrimSpace(params[0])))
+		if r.typ == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+func splitMediaType(mime string) (string, string) {
+	if mime == "*" {
+		return "*", "*"
+	}
+	i := strings.Index(mime, "/")
+	if i <= 0 || i == len(mime)-1 {
+		return "", ""
+	}
+	return mime[:i], mime[i+1:]
+}
+
 // IP returns request client ip.
 // if in proxy, return first proxy id.
 // if error, return 127.0.0.1.
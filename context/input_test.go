@@ -112,3 +112,22 @@ func TestSubDomain(t *testing.T) {
 		t.Fatal("Subdomain parse error, got " + beegoInput.SubDomains())
 	}
 }
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/csv"}
+	for accept, want := range map[string]string{
+		"":                                      "application/json",
+		"*/*":                                   "application/json",
+		"text/csv":                              "text/csv",
+		"application/xml;q=0.9, text/csv;q=0.5": "application/xml",
+		"text/*, application/json;q=0.1":        "text/csv",
+		"*/*;q=0.1, application/json;q=0":       "application/xml",
+		"image/png":                             "",
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if got := NewInput(r).Negotiate(offers...); got != want {
+			t.Errorf("Negotiate %q got %q, want %q", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamClosed is returned when writing to a closed stream or a disconnected client.
+var ErrStreamClosed = errors.New("beego: stream is closed")
+
+// Stream is a response body written in chunks,
+// the written data is sent to the client by Flush.
+type Stream struct {
+	output  *BeegoOutput
+	w       io.Writer
+	gz      *gzip.Writer
+	flusher http.Flusher
+	closed  bool
+}
+
+// Stream starts a streaming response of the content type.
+// the body is gzipped if EnableGzip and the client accepts gzip.
+// the status set by SetStatus is sent now, 200 if it's not set.
+// usage:
+//	s := ctx.Output.Stream("text/csv; charset=utf-8")
+//	defer s.Close()
+//	for rows.Next() {
+//		s.Write(row)
+//		s.Flush()
+//	}
+func (output *BeegoOutput) Stream(contentType string) *Stream {
+	s := &Stream{output: output, w: output.Context.ResponseWriter}
+	s.flusher, _ = output.Context.ResponseWriter.(http.Flusher)
+	header := output.Context.ResponseWriter.Header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Del("Content-Length")
+	if output.EnableGzip && strings.Contains(output.Context.Input.Header("Accept-Encoding"), "gzip") {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		s.gz, _ = gzip.NewWriterLevel(output.Context.ResponseWriter, gzip.BestSpeed)
+		s.w = s.gz
+	}
+	status := output.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	output.Context.ResponseWriter.WriteHeader(status)
+	output.Status = 0
+	return s
+}
+
+// Write writes the data to the stream.
+// ErrStreamClosed is returned if the stream is closed or the client is gone.
+func (s *Stream) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, ErrStreamClosed
+	}
+	select {
+	case <-s.Done():
+		return 0, ErrStreamClosed
+	default:
+	}
+	return s.w.Write(p)
+}
+
+// WriteString writes the string to the stream.
+func (s *Stream) WriteString(str string) (int, error) {
+	return s.Write([]byte(str))
+}
+
+// Flush sends the written data to the client.
+func (s *Stream) Flush() error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// Close flushes and ends the stream, the gzip footer is written.
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	var err error
+	if s.gz != nil {
+		err = s.gz.Close()
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	s.closed = true
+	return err
+}
+
+// Done is closed when the client disconnects.
+func (s *Stream) Done() <-chan struct{} {
+	return s.output.Context.Request.Context().Done()
+}
+
+// Event is a message of Server-Sent Events.
+// the Data of string or []byte is sent as is, others are encoded as JSON.
+type Event struct {
+	Id    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// EventStream writes Server-Sent Events, its Send, Retry and Comment are safe for concurrent use.
+type EventStream struct {
+	*Stream
+	mu sync.Mutex
+}
+
+// EventStream starts a text/event-stream response.
+// usage:
+//	es := ctx.Output.EventStream()
+//	defer es.Close()
+//	stop := es.Heartbeat(15 * time.Second)
+//	defer stop()
+//	for p := range progress {
+//		if err := es.Send(&context.Event{Event: "progress", Data: p}); err != nil {
+//			return // client disconnected
+//		}
+//	}
+func (output *BeegoOutput) EventStream() *EventStream {
+	header := output.Context.ResponseWriter.Header()
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// nginx不要缓存
+	header.Set("X-Accel-Buffering", "no")
+	enableGzip := output.EnableGzip
+	output.EnableGzip = false
+	s := output.Stream("text/event-stream; charset=utf-8")
+	output.EnableGzip = enableGzip
+	return &EventStream{Stream: s}
+}
+
+// LastEventId returns the Last-Event-ID header sent by the reconnected client.
+func (es *EventStream) LastEventId() string {
+	return es.output.Context.Input.Header("Last-Event-ID")
+}
+
+// Send writes the event and flushes it to the client.
+func (es *EventStream) Send(e *Event) error {
+	var buf []byte
+	if e.Id != "" {
+		buf = append(buf, "id: "+oneLine(e.Id)+"\n"...)
+	}
+	if e.Event != "" {
+		buf = append(buf, "event: "+oneLine(e.Event)+"\n"...)
+	}
+	if e.Retry > 0 {
+		buf = append(buf, "retry: "+strconv.FormatInt(int64(e.Retry/time.Millisecond), 10)+"\n"...)
+	}
+	var data string
+	switch d := e.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		buf = append(buf, "data: "+line+"\n"...)
+	}
+	buf = append(buf, '\n')
+	return es.write(buf)
+}
+
+// Retry tells the client the reconnection time.
+func (es *EventStream) Retry(d time.Duration) error {
+	return es.write([]byte("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n"))
+}
+
+// Comment writes a comment line, it's ignored by the client.
+func (es *EventStream) Comment(text string) error {
+	return es.write([]byte(": " + oneLine(text) + "\n\n"))
+}
+
+// Heartbeat writes a comment every interval to keep the connection alive,
+// it stops when the client disconnects or the returned func is called.
+func (es *EventStream) Heartbeat(interval time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if es.Comment("heartbeat") != nil {
+					return
+				}
+			case <-es.Done():
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(quit) })
+	}
+}
+
+// Close ends the event stream.
+func (es *EventStream) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.Stream.Close()
+}
+
+func (es *EventStream) write(b []byte) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if _, err := es.Stream.Write(b); err != nil {
+		return err
+	}
+	return es.Stream.Flush()
+}
+
+// the fields of an event must be a single line
+func oneLine(s string) string {
+	return strings.Replace(strings.Replace(s, "\r", "", -1), "\n", " ", -1)
+}
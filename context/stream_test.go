@@ -0,0 +1,87 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"compress/gzip"
+	gocontext "context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newStreamContext(r *http.Request) (*Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	ctx := &Context{Request: r, ResponseWriter: w, Input: NewInput(r), Output: NewOutput()}
+	ctx.Output.Context = ctx
+	return ctx, w
+}
+
+func TestStream(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/export", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	ctx, w := newStreamContext(r)
+	ctx.Output.EnableGzip = true
+
+	s := ctx.Output.Stream("text/csv")
+	s.WriteString("a,b\n")
+	s.Flush()
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("Stream isn't flushed with gzip")
+	}
+	s.WriteString("1,2\n")
+	s.Close()
+	if _, err := s.WriteString("3,4\n"); err != ErrStreamClosed {
+		t.Errorf("Stream write after close get %v", err)
+	}
+
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gr)
+	if string(body) != "a,b\n1,2\n" {
+		t.Errorf("Stream get the body %q", body)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	c, cancel := gocontext.WithCancel(gocontext.Background())
+	r, _ := http.NewRequest("GET", "/events", nil)
+	r = r.WithContext(c)
+	r.Header.Set("Last-Event-ID", "41")
+	ctx, w := newStreamContext(r)
+
+	es := ctx.Output.EventStream()
+	if es.LastEventId() != "41" {
+		t.Errorf("EventStream get the last event id %q", es.LastEventId())
+	}
+	es.Send(&Event{Id: "42", Event: "progress", Data: map[string]int{"done": 50}, Retry: 3 * time.Second})
+	es.Send(&Event{Data: "line1\nline2"})
+	es.Comment("ping")
+	want := "id: 42\nevent: progress\nretry: 3000\ndata: {\"done\":50}\n\n" +
+		"data: line1\ndata: line2\n\n" +
+		": ping\n\n"
+	if w.Header().Get("Content-Type") != "text/event-stream; charset=utf-8" || w.Body.String() != want {
+		t.Errorf("EventStream get the body %q", w.Body.String())
+	}
+
+	cancel()
+	if err := es.Send(&Event{Data: "gone"}); err != ErrStreamClosed {
+		t.Errorf("EventStream send after disconnect get %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package beego
 
 import (
 	"bytes"
+	stdcontext "context"
 	"errors"
 	"html/template"
 	"io"
@@ -197,19 +198,20 @@ func (c *Controller) RenderString() (string, error) {
 
 // RenderBytes returns the bytes of rendered template string. Do not send out response.
 func (c *Controller) RenderBytes() ([]byte, error) {
+	cfg := appSettings(c.Ctx)
 	//if the controller has set layout, then first get the tplname's content set the content to the layout
 	if c.Layout != "" {
 		if c.TplNames == "" {
 			c.TplNames = strings.ToLower(c.controllerName) + "/" + strings.ToLower(c.actionName) + "." + c.TplExt
 		}
-		if RunMode == "dev" {
-			BuildTemplate(ViewsPath)
+		if cfg.RunMode == "dev" {
+			cfg.BuildTemplate()
 		}
 		newbytes := bytes.NewBufferString("")
-		if _, ok := BeeTemplates[c.TplNames]; !ok {
+		if _, ok := cfg.TemplateCache[c.TplNames]; !ok {
 			panic("can't find templatefile in the path:" + c.TplNames)
 		}
-		err := BeeTemplates[c.TplNames].ExecuteTemplate(newbytes, c.TplNames, c.Data)
+		err := cfg.TemplateCache[c.TplNames].ExecuteTemplate(newbytes, c.TplNames, c.Data)
 		if err != nil {
 			Trace("template Execute err:", err)
 			return nil, err
@@ -225,7 +227,7 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 				}
 
 				sectionBytes := bytes.NewBufferString("")
-				err = BeeTemplates[sectionTpl].ExecuteTemplate(sectionBytes, sectionTpl, c.Data)
+				err = cfg.TemplateCache[sectionTpl].ExecuteTemplate(sectionBytes, sectionTpl, c.Data)
 				if err != nil {
 					Trace("template Execute err:", err)
 					return nil, err
@@ -240,7 +242,7 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 		// LayoutContent
 		// ---> Layout Template
 		ibytes := bytes.NewBufferString("")
-		err = BeeTemplates[c.Layout].ExecuteTemplate(ibytes, c.Layout, c.Data)
+		err = cfg.TemplateCache[c.Layout].ExecuteTemplate(ibytes, c.Layout, c.Data)
 		if err != nil {
 			Trace("template Execute err:", err)
 			return nil, err
@@ -254,17 +256,17 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 		}
 
 		// 在测试模式下，Template会重建，便于调试
-		if RunMode == "dev" {
-			BuildTemplate(ViewsPath)
+		if cfg.RunMode == "dev" {
+			cfg.BuildTemplate()
 		}
 		ibytes := bytes.NewBufferString("")
 
 		// 获取Templates
-		if _, ok := BeeTemplates[c.TplNames]; !ok {
+		if _, ok := cfg.TemplateCache[c.TplNames]; !ok {
 			panic("can't find templatefile in the path:" + c.TplNames)
 		}
 		//  XXX: 执行Template
-		err := BeeTemplates[c.TplNames].ExecuteTemplate(ibytes, c.TplNames, c.Data)
+		err := cfg.TemplateCache[c.TplNames].ExecuteTemplate(ibytes, c.TplNames, c.Data)
 		if err != nil {
 			Trace("template Execute err:", err)
 			return nil, err
@@ -274,6 +276,14 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 	}
 }
 
+// RequestContext returns the context.Context of this request.
+// it's done when the client disconnects or the route timeout expires.
+// usage:
+//	o := orm.NewOrm().WithContext(c.RequestContext())
+func (c *Controller) RequestContext() stdcontext.Context {
+	return c.Ctx.RequestContext()
+}
+
 // Redirect sends the redirection response to url with status code.
 func (c *Controller) Redirect(url string, code int) {
 	c.Ctx.Redirect(code, url)
@@ -290,9 +300,18 @@ func (c *Controller) Abort(code string) {
 
 // CustomAbort stops controller handler and show the error data, it's similar Aborts, but support status code and body.
 func (c *Controller) CustomAbort(status int, body string) {
+	// API模式下输出problem+json
+	if isProblem(c.Ctx) {
+		pb := NewProblem(status, body)
+		if body == strconv.Itoa(status) {
+			pb.Detail = ""
+		}
+		writeProblem(c.Ctx, pb)
+		panic(USERSTOPRUN)
+	}
 	c.Ctx.ResponseWriter.WriteHeader(status)
 	// first panic from ErrorMaps, is is user defined error functions.
-	if _, ok := ErrorMaps[body]; ok {
+	if _, ok := lookupErrorHandler(body, c.Ctx); ok {
 		panic(body)
 	}
 	// last panic user string
@@ -324,7 +343,7 @@ func (c *Controller) ServeJson(encoding ...bool) {
 	var hasencoding bool
 
 	// 注意RunMode的区别对待
-	if RunMode == "prod" {
+	if appSettings(c.Ctx).RunMode == "prod" {
 		hasIndent = false
 	} else {
 		hasIndent = true
@@ -340,7 +359,7 @@ func (c *Controller) ServeJson(encoding ...bool) {
 // ServeJsonp sends a jsonp response.
 func (c *Controller) ServeJsonp() {
 	var hasIndent bool
-	if RunMode == "prod" {
+	if appSettings(c.Ctx).RunMode == "prod" {
 		hasIndent = false
 	} else {
 		hasIndent = true
@@ -351,7 +370,7 @@ func (c *Controller) ServeJsonp() {
 // ServeXml sends xml response.
 func (c *Controller) ServeXml() {
 	var hasIndent bool
-	if RunMode == "prod" {
+	if appSettings(c.Ctx).RunMode == "prod" {
 		hasIndent = false
 	} else {
 		hasIndent = true
@@ -359,18 +378,29 @@ func (c *Controller) ServeXml() {
 	c.Ctx.Output.Xml(c.Data["xml"], hasIndent)
 }
 
-// ServeFormatted serve Xml OR Json, depending on the value of the Accept header
+// ServeFormatted serves Data["json"] in the format negotiated by the Accept header,
+// the formats are registered by AddRenderer. JSON is served if there's no Accept header,
+// 406 Not Acceptable is returned if no format matches.
+// Data["xml"] is served for xml if it's set, for the compatibility.
 func (c *Controller) ServeFormatted() {
-	accept := c.Ctx.Input.Header("Accept")
-	// 默认对外以JSON格式提供服务, 也可以考虑: XML等
-	switch accept {
-	case applicationJson:
-		c.ServeJson()
-	case applicationXml, textXml:
-		c.ServeXml()
-	default:
-		c.ServeJson()
+	mediaType := c.Ctx.Input.Negotiate(renderTypes...)
+	c.Ctx.Output.Header("Vary", "Accept")
+	if mediaType == "" {
+		c.Abort("406")
+	}
+	data := c.Data["json"]
+	if mediaType == applicationXml || mediaType == textXml {
+		if x, ok := c.Data["xml"]; ok {
+			data = x
+		}
+	}
+	content, err := renderers[mediaType](data, appSettings(c.Ctx).RunMode != "prod")
+	if err != nil {
+		http.Error(c.Ctx.ResponseWriter, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	c.Ctx.Output.Header("Content-Type", renderContentType(mediaType))
+	c.Ctx.Output.Body(content)
 }
 
 // Input returns the input data map from POST or PUT request body and query string.
@@ -608,14 +638,14 @@ func (c *Controller) SessionRegenerateID() {
 	if c.CruSession != nil {
 		c.CruSession.SessionRelease(c.Ctx.ResponseWriter)
 	}
-	c.CruSession = GlobalSessions.SessionRegenerateId(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.CruSession = appSettings(c.Ctx).Sessions.SessionRegenerateId(c.Ctx.ResponseWriter, c.Ctx.Request)
 	c.Ctx.Input.CruSession = c.CruSession
 }
 
 // DestroySession cleans session data and session cookie.
 func (c *Controller) DestroySession() {
 	c.Ctx.Input.CruSession.Flush()
-	GlobalSessions.SessionDestroy(c.Ctx.ResponseWriter, c.Ctx.Request)
+	appSettings(c.Ctx).Sessions.SessionDestroy(c.Ctx.ResponseWriter, c.Ctx.Request)
 }
 
 // IsAjax returns this request is ajax or not.
@@ -636,13 +666,14 @@ func (c *Controller) SetSecureCookie(Secret, name, value string, others ...inter
 // XsrfToken creates a xsrf token string and returns.
 func (c *Controller) XsrfToken() string {
 	if c._xsrf_token == "" {
+		cfg := appSettings(c.Ctx)
 		var expire int64
 		if c.XSRFExpire > 0 {
 			expire = int64(c.XSRFExpire)
 		} else {
-			expire = int64(XSRFExpire)
+			expire = int64(cfg.XSRFExpire)
 		}
-		c._xsrf_token = c.Ctx.XsrfToken(XSRFKEY, expire)
+		c._xsrf_token = c.Ctx.XsrfToken(cfg.XSRFKEY, expire)
 	}
 	return c._xsrf_token
 }
@@ -16,6 +16,11 @@ package beego
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
 	"github.com/astaxie/beego/context"
 )
 
@@ -76,3 +81,130 @@ func ExampleGetInt64() {
 	fmt.Printf("%T", val)
 	//Output: int64
 }
+
+type bindUser struct {
+	Name string `json:"name" xml:"name" form:"name" valid:"Required"`
+	Age  int    `json:"age" xml:"age" form:"age" valid:"Range(1, 140)"`
+}
+
+func bindController(contentType, body string) *Controller {
+	r, _ := http.NewRequest("POST", "/user", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	ctx := &context.Context{Request: r, Input: context.NewInput(r)}
+	return &Controller{Ctx: ctx}
+}
+
+func TestBindBody(t *testing.T) {
+	for ct, body := range map[string]string{
+		"application/json; charset=utf-8":   `{"name":"astaxie","age":30}`,
+		"application/vnd.api+json":          `{"name":"astaxie","age":30}`,
+		"application/xml":                   `<user><name>astaxie</name><age>30</age></user>`,
+		"application/x-www-form-urlencoded": "name=astaxie&age=30",
+	} {
+		var u bindUser
+		if err := bindController(ct, body).BindBody(&u); err != nil || u.Name != "astaxie" || u.Age != 30 {
+			t.Errorf("TestBindBody %s get %+v, %v", ct, u, err)
+		}
+	}
+
+	var u bindUser
+	err := bindController("application/json", `{"age":200}`).BindBody(&u)
+	berr, ok := err.(*BindError)
+	if !ok || len(berr.Errors) != 2 || berr.Errors[0].Field != "Name" || berr.Errors[1].Field != "Age" {
+		t.Errorf("TestBindBody get the validation error %v", err)
+	}
+
+	if err := bindController("application/msgpack", "").BindBody(&u); err != ErrUnsupportedContentType {
+		t.Errorf("TestBindBody get %v for the unsupported content type", err)
+	}
+	AddBodyDecoder("application/msgpack", func(ctx *context.Context, obj interface{}) error {
+		obj.(*bindUser).Name = "msgpack"
+		return nil
+	})
+	u = bindUser{Age: 1}
+	if err := bindController("application/msgpack", "").BindBody(&u); err != nil || u.Name != "msgpack" {
+		t.Errorf("TestBindBody get %+v, %v with the registered decoder", u, err)
+	}
+}
+
+type userController struct {
+	Controller
+}
+
+func (c *userController) Post() {
+	var u bindUser
+	if err := c.BindBody(&u); err != nil {
+		c.CustomAbort(422, err.Error())
+	}
+	c.Ctx.WriteString(u.Name)
+}
+
+func TestBindBodyTooLarge(t *testing.T) {
+	cfg := NewSettings()
+	cfg.MaxMemory = 32
+	handler := NewAppWithSettings(cfg).Handlers
+	handler.Add("/user", &userController{})
+
+	for body, code := range map[string]int{
+		`{"name":"astaxie","age":30}`:                        200,
+		`{"name":"astaxie","age":30,"about":"a long story"}`: 413,
+	} {
+		r, _ := http.NewRequest("POST", "/user", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("the body of %d bytes get %d: %s", len(body), w.Code, w.Body.String())
+		}
+	}
+}
+
+type formatUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+type formattedController struct {
+	Controller
+}
+
+func (c *formattedController) Get() {
+	c.Data["json"] = []formatUser{{"astaxie", 30}, {"slene", 28}}
+	c.ServeFormatted()
+}
+
+func TestServeFormatted(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Add("/users", &formattedController{})
+	for accept, want := range map[string]string{
+		"":                                 "application/json; charset=utf-8",
+		"text/csv, application/json;q=0.5": "text/csv; charset=utf-8",
+		"text/*;q=0.8, application/xml":    "application/xml; charset=utf-8",
+		"image/png":                        "",
+	} {
+		r, _ := http.NewRequest("GET", "/users", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if want == "" {
+			if w.Code != 406 {
+				t.Errorf("TestServeFormatted %q get the code %d", accept, w.Code)
+			}
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != want {
+			t.Errorf("TestServeFormatted %q get the content type %q", accept, ct)
+		}
+	}
+
+	content, _ := renderCsv([]formatUser{{"astaxie", 30}}, false)
+	if string(content) != "name,age\nastaxie,30\n" {
+		t.Errorf("TestServeFormatted get the csv %q", content)
+	}
+	content, _ = renderCsv([]map[string]interface{}{{"b": 1, "a": "x"}}, false)
+	if string(content) != "a,b\nx,1\n" {
+		t.Errorf("TestServeFormatted get the csv %q", content)
+	}
+}
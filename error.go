@@ -288,6 +288,20 @@ func methodNotAllowed(rw http.ResponseWriter, r *http.Request) {
 	t.Execute(rw, data)
 }
 
+// show 406 Not Acceptable
+func notAcceptable(rw http.ResponseWriter, r *http.Request) {
+	t, _ := template.New("beegoerrortemp").Parse(errtpl)
+	data := make(map[string]interface{})
+	data["Title"] = "Not Acceptable"
+	data["Content"] = template.HTML("<br>The resource you have requested is not available in an acceptable format." +
+		"<br>Perhaps you are here because:" +
+		"<br><br><ul>" +
+		"<br>The Accept header of the request matches none of the formats of the resource" +
+		"</ul>")
+	data["BeegoVersion"] = VERSION
+	t.Execute(rw, data)
+}
+
 // show 500 internal server error.
 func internalServerError(rw http.ResponseWriter, r *http.Request) {
 	t, _ := template.New("beegoerrortemp").Parse(errtpl)
@@ -380,6 +394,10 @@ func registerDefaultErrorHandler() {
 		Errorhandler("405", methodNotAllowed)
 	}
 
+	if _, ok := ErrorMaps["406"]; !ok {
+		Errorhandler("406", notAcceptable)
+	}
+
 	if _, ok := ErrorMaps["500"]; !ok {
 		Errorhandler("500", internalServerError)
 	}
@@ -404,11 +422,7 @@ func registerDefaultErrorHandler() {
 // 	beego.ErrorHandler("404",NotFound)
 //	beego.ErrorHandler("500",InternalServerError)
 func Errorhandler(code string, h http.HandlerFunc) *App {
-	errinfo := &errorInfo{}
-	errinfo.errorType = errorTypeHandler
-	errinfo.handler = h
-	errinfo.method = code
-	ErrorMaps[code] = errinfo
+	addErrorHandler(ErrorMaps, code, h)
 	return BeeApp
 }
 
@@ -416,6 +430,32 @@ func Errorhandler(code string, h http.HandlerFunc) *App {
 // usage:
 // 	beego.ErrorHandler(&controllers.ErrorController{})
 func ErrorController(c ControllerInterface) *App {
+	addErrorController(ErrorMaps, c)
+	return BeeApp
+}
+
+// ErrorHandler registers http.HandlerFunc for the err code in this ControllerRegistor only,
+// it's used by the host routers and the apps of NewAppWithSettings, the global ErrorMaps is used if the code is not registered.
+func (p *ControllerRegistor) ErrorHandler(code string, h http.HandlerFunc) *ControllerRegistor {
+	addErrorHandler(p.errorMaps, code, h)
+	return p
+}
+
+// ErrorController registers ControllerInterface for the err codes in this ControllerRegistor only.
+func (p *ControllerRegistor) ErrorController(c ControllerInterface) *ControllerRegistor {
+	addErrorController(p.errorMaps, c)
+	return p
+}
+
+func addErrorHandler(maps map[string]*errorInfo, code string, h http.HandlerFunc) {
+	errinfo := &errorInfo{}
+	errinfo.errorType = errorTypeHandler
+	errinfo.handler = h
+	errinfo.method = code
+	maps[code] = errinfo
+}
+
+func addErrorController(maps map[string]*errorInfo, c ControllerInterface) {
 	reflectVal := reflect.ValueOf(c)
 	rt := reflectVal.Type()
 	ct := reflect.Indirect(reflectVal).Type()
@@ -426,10 +466,24 @@ func ErrorController(c ControllerInterface) *App {
 			errinfo.controllerType = ct
 			errinfo.method = rt.Method(i).Name
 			errname := strings.TrimPrefix(rt.Method(i).Name, "Error")
-			ErrorMaps[errname] = errinfo
+			maps[errname] = errinfo
 		}
 	}
-	return BeeApp
+}
+
+// lookupErrorHandler finds the error handler of the code,
+// the handlers of the matched host router go first, then the ones of the app.
+func lookupErrorHandler(errcode string, ctx *context.Context) (*errorInfo, bool) {
+	if ctx != nil && ctx.Input != nil {
+		p, _ := ctx.Input.GetData(registorKey{}).(*ControllerRegistor)
+		for ; p != nil; p = p.parent {
+			if h, ok := p.errorMaps[errcode]; ok {
+				return h, true
+			}
+		}
+	}
+	h, ok := ErrorMaps[errcode]
+	return h, ok
 }
 
 // show error string as simple text message.
@@ -439,10 +493,14 @@ func exception(errcode string, ctx *context.Context) {
 	if err != nil {
 		code = 503
 	}
-	if h, ok := ErrorMaps[errcode]; ok {
+	if isProblem(ctx) {
+		writeProblem(ctx, NewProblem(code, ""))
+		return
+	}
+	if h, ok := lookupErrorHandler(errcode, ctx); ok {
 		executeError(h, ctx, code)
 		return
-	} else if h, ok := ErrorMaps["503"]; ok {
+	} else if h, ok := lookupErrorHandler("503", ctx); ok {
 		executeError(h, ctx, code)
 		return
 	} else {
@@ -478,7 +536,7 @@ func executeError(err *errorInfo, ctx *context.Context, code int) {
 		method.Call(in)
 
 		//render template
-		if AutoRender {
+		if appSettings(ctx).AutoRender {
 			if err := execController.Render(); err != nil {
 				panic(err)
 			}
@@ -14,11 +14,37 @@
 
 package beego
 
-import "github.com/astaxie/beego/context"
+import (
+	"net/http"
+
+	"github.com/astaxie/beego/context"
+)
 
 // FilterFunc defines a filter function which is invoked before the controller handler is executed.
 type FilterFunc func(*context.Context)
 
+// MiddleWare wraps the dispatch of a single route.
+// Unlike FilterFunc it receives the downstream handler, so it can run code
+// before and after the controller, recover from panics or replace the ResponseWriter.
+// usage:
+//	func Timer(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+//			start := time.Now()
+//			next.ServeHTTP(rw, r)
+//			beego.Debug(r.URL.Path, time.Since(start))
+//		})
+//	}
+type MiddleWare func(http.Handler) http.Handler
+
+// buildMiddlewares chains the middlewares around h.
+// the first middleware is the outermost one.
+func buildMiddlewares(h http.Handler, mws []MiddleWare) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
 // FilterRouter defines a filter operation which is invoked before the controller handler is executed.
 // It can match the URL against a pattern, and execute a filter function
 // when a request with a matching URL arrives.
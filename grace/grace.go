@@ -39,9 +39,15 @@
 //      log.Println("Server on 8080 stopped")
 //	     os.Exit(0)
 //    }
+//
+// kill -HUP forks the child taking the listeners, the parent stops accepting and drains
+// its connections after the child is ready, it keeps serving if the child fails to start.
+// grace.Status() reports the upgrade. The listeners passed by systemd socket activation
+// (LISTEN_FDS) are used if their addresses match.
 package grace
 
 import (
+	"crypto/tls"
 	"flag"
 	"net/http"
 	"os"
@@ -154,3 +160,16 @@ func ListenAndServeTLS(addr string, certFile string, keyFile string, handler htt
 	server := NewServer(addr, handler)
 	return server.ListenAndServeTLS(certFile, keyFile)
 }
+
+// ListenAndServeTLSConfig serves https with the certificates of the tls config,
+// such as the config of certs.Manager selecting the certificates by SNI.
+// usage:
+//	m := certs.NewManager()
+//	m.AddFile("www.pem", "www.key")
+//	m.AddFile("api.pem", "api.key")
+//	grace.ListenAndServeTLSConfig(":443", m.TLSConfig(), handler)
+func ListenAndServeTLSConfig(addr string, config *tls.Config, handler http.Handler) error {
+	server := NewServer(addr, handler)
+	server.TLSConfig = config
+	return server.ListenAndServeTLS("", "")
+}
@@ -1,18 +1,17 @@
 package grace
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
 	"sync"
 	"syscall"
-	"time"
 )
 
 // http://beego.me/docs/module/grace.md
@@ -48,6 +47,15 @@ func (srv *graceServer) Serve() (err error) {
 // to handle requests on incoming connections. If srv.Addr is blank, ":http" is
 // used.
 func (srv *graceServer) ListenAndServe() (err error) {
+	if err = srv.Listen(); err != nil {
+		return err
+	}
+	return srv.Serve()
+}
+
+// Listen binds srv.Addr, or takes the socket passed by the parent process after forking,
+// the requests are served by Serve. If srv.Addr is blank, ":http" is used.
+func (srv *graceServer) Listen() (err error) {
 	addr := srv.Addr
 	if addr == "" {
 		addr = ":http"
@@ -65,26 +73,11 @@ func (srv *graceServer) ListenAndServe() (err error) {
 
 	srv.GraceListener = newGraceListener(l, srv)
 
-	// 3. Child起来了，然后就准备杀死Parent Process; 如果整个过程出现问题，则直接退出
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		//
-		// kill -9
-		// 怎么这么粗暴呢? Graceful如何体现？ 之前没有处理完毕的请求如何继续处理
-		//
-		err = process.Kill()
-		if err != nil {
-			return err
-		}
-	}
+	// 3. Child起来了, 通知Parent停止Accept并且处理完已有的请求
+	notifyReady()
 
-	// 4. 继续未尽的事业
 	log.Println(os.Getpid(), srv.Addr)
-	return srv.Serve()
+	return nil
 }
 
 // ListenAndServeTLS listens on the TCP network address srv.Addr and then calls
@@ -97,6 +90,15 @@ func (srv *graceServer) ListenAndServe() (err error) {
 //
 // If srv.Addr is blank, ":https" is used.
 func (srv *graceServer) ListenAndServeTLS(certFile, keyFile string) (err error) {
+	if err = srv.ListenTLS(certFile, keyFile); err != nil {
+		return err
+	}
+	return srv.Serve()
+}
+
+// ListenTLS is the TLS version of Listen. If srv.Addr is blank, ":https" is used.
+// certFile and keyFile can be empty if the certificates are set by srv.TLSConfig.
+func (srv *graceServer) ListenTLS(certFile, keyFile string) (err error) {
 	addr := srv.Addr
 	if addr == "" {
 		addr = ":https"
@@ -104,16 +106,19 @@ func (srv *graceServer) ListenAndServeTLS(certFile, keyFile string) (err error)
 
 	config := &tls.Config{}
 	if srv.TLSConfig != nil {
-		*config = *srv.TLSConfig
+		config = srv.TLSConfig.Clone()
 	}
 	if config.NextProtos == nil {
 		config.NextProtos = []string{"http/1.1"}
 	}
 
-	config.Certificates = make([]tls.Certificate, 1)
-	config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return
+	// the certificates can be set by TLSConfig, like http.Server.ServeTLS
+	if len(config.Certificates) == 0 && config.GetCertificate == nil || certFile != "" || keyFile != "" {
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return
+		}
 	}
 
 	go srv.handleSignals()
@@ -127,19 +132,22 @@ func (srv *graceServer) ListenAndServeTLS(certFile, keyFile string) (err error)
 	srv.tlsInnerListener = newGraceListener(l, srv)
 	srv.GraceListener = tls.NewListener(srv.tlsInnerListener, config)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		err = process.Kill()
-		if err != nil {
-			return err
-		}
-	}
+	notifyReady()
 	log.Println(os.Getpid(), srv.Addr)
-	return srv.Serve()
+	return nil
+}
+
+// Shutdown stops accepting the new connections and waits for the in-flight requests,
+// the idle connections are closed. The remaining connections are closed when ctx is done.
+func (srv *graceServer) Shutdown(ctx context.Context) error {
+	if srv.state == STATE_RUNNING {
+		srv.state = STATE_SHUTTING_DOWN
+	}
+	err := srv.Server.Shutdown(ctx)
+	if err != nil {
+		srv.Server.Close()
+	}
+	return err
 }
 
 // getListener either opens a new socket to listen on, or takes the acceptor socket
@@ -162,6 +170,11 @@ func (srv *graceServer) getListener(laddr string) (l net.Listener, err error) {
 			err = fmt.Errorf("net.FileListener error: %v", err)
 			return
 		}
+	} else if l, err = activatedListener(laddr); err != nil {
+		return
+	} else if l != nil {
+		// systemd socket activation
+		log.Println("laddr", laddr, "is passed by systemd")
 	} else {
 		// 正常创建 Listener
 		l, err = net.Listen(srv.Network, laddr)
@@ -228,45 +241,23 @@ func (srv *graceServer) signalHooks(ppFlag int, sig os.Signal) {
 	return
 }
 
-// shutdown closes the listener so that no new connections are accepted. it also
-// starts a goroutine that will serverTimeout (stop all running requests) the server
-// after DefaultTimeout.
+// shutdown closes the listener so that no new connections are accepted,
+// the idle keep-alive connections are closed and the in-flight requests are drained.
+// the remaining connections are closed after DefaultTimeout.
 func (srv *graceServer) shutdown() {
 	if srv.state != STATE_RUNNING {
 		return
 	}
 
-	srv.state = STATE_SHUTTING_DOWN
+	ctx := context.Background()
 	if DefaultTimeout >= 0 {
-		go srv.serverTimeout(DefaultTimeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
 	}
-	err := srv.GraceListener.Close()
-	if err != nil {
-		log.Println(syscall.Getpid(), "Listener.Close() error:", err)
-	} else {
-		log.Println(syscall.Getpid(), srv.GraceListener.Addr(), "Listener closed.")
-	}
-}
-
-// serverTimeout forces the server to shutdown in a given timeout - whether it
-// finished outstanding requests or not. if Read/WriteTimeout are not set or the
-// max header size is very big a connection could hang
-func (srv *graceServer) serverTimeout(d time.Duration) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Println("WaitGroup at 0", r)
-		}
-	}()
-	if srv.state != STATE_SHUTTING_DOWN {
-		return
-	}
-	time.Sleep(d)
-	log.Println("[STOP - Hammer Time] Forcefully shutting down parent")
-	for {
-		if srv.state == STATE_TERMINATE {
-			break
-		}
-		srv.wg.Done()
+	log.Println(syscall.Getpid(), srv.GraceListener.Addr(), "Draining the connections.")
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println(syscall.Getpid(), "[STOP - Hammer Time] Forcefully shutting down:", err)
 	}
 }
 
@@ -320,14 +311,15 @@ func (srv *graceServer) fork() (err error) {
 		log.Println(args)
 	}
 	// 启动一个新的进程！！
-	cmd := exec.Command(path, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = files
-	err = cmd.Start()
+	// 等Child ready之后再停止当前的进程, 如果Child启动失败, 当前进程继续服务
+	err = startChild(path, args, files)
+	for _, f := range files {
+		f.Close()
+	}
 	if err != nil {
-		log.Fatalf("Restart: Failed to launch, error: %v", err)
+		log.Println("Restart: Failed to launch, error:", err)
+		setStatus(UPGRADE_FAILED, 0, err)
+		runningServersForked = false
 	}
-
 	return
 }
@@ -0,0 +1,123 @@
+package grace
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// systemd socket activation:
+// http://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+const listenFdsStart = 3
+
+var (
+	activatedOnce      sync.Once
+	activatedListeners []net.Listener
+	activatedNames     []string
+)
+
+// activated returns the listeners passed by systemd with LISTEN_PID and LISTEN_FDS,
+// the environment variables are removed so that the forked child doesn't take them.
+func activated() ([]net.Listener, []string) {
+	activatedOnce.Do(func() {
+		activatedListeners, activatedNames = listenFds(listenFdsStart)
+	})
+	return activatedListeners, activatedNames
+}
+
+// listenFds takes the LISTEN_FDS sockets from the fd start with their LISTEN_FDNAMES.
+func listenFds(start int) (ls []net.Listener, names []string) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+	fdnames := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	for i := 0; i < n; i++ {
+		fd := start + i
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		name := ""
+		if i < len(fdnames) {
+			name = fdnames[i]
+		}
+		ls = append(ls, l)
+		names = append(names, name)
+	}
+	return
+}
+
+// SocketActivated checks if the process is started by systemd socket activation.
+func SocketActivated() bool {
+	ls, _ := activated()
+	return len(ls) > 0
+}
+
+// activatedListener takes the listener passed by systemd for the address,
+// it's matched by the FileDescriptorName of the socket unit, or the address.
+// only the TCP sockets can be served, the other matched socket is an error.
+func activatedListener(laddr string) (net.Listener, error) {
+	regLock.Lock()
+	defer regLock.Unlock()
+	ls, names := activated()
+	for i, l := range ls {
+		if l == nil || (names[i] != laddr && !sameAddr(l.Addr(), laddr)) {
+			continue
+		}
+		if _, ok := l.(*net.TCPListener); !ok {
+			return nil, fmt.Errorf("grace: the socket %s passed by systemd for %s isn't TCP", l.Addr(), laddr)
+		}
+		activatedListeners[i] = nil
+		return l, nil
+	}
+	return nil, nil
+}
+
+// sameAddr checks if the listening address serves laddr like ":8080" or "127.0.0.1:8080".
+func sameAddr(addr net.Addr, laddr string) bool {
+	ta, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return addr.String() == laddr
+	}
+	host, port, err := net.SplitHostPort(laddr)
+	if err != nil {
+		return false
+	}
+	if p, err := net.LookupPort("tcp", port); err != nil || p != ta.Port {
+		return false
+	}
+	if host == "" || ta.IP.IsUnspecified() {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.Equal(ta.IP)
+}
+
+// sdNotify sends the state to the service manager if it's run by systemd with Type=notify.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
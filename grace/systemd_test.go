@@ -0,0 +1,125 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package grace
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSameAddr(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}
+	any := &net.TCPAddr{IP: net.IPv4zero, Port: 8080}
+	tests := []struct {
+		addr  net.Addr
+		laddr string
+		same  bool
+	}{
+		{addr, ":8080", true},
+		{addr, "127.0.0.1:8080", true},
+		{addr, "127.0.0.2:8080", false},
+		{addr, ":8081", false},
+		{addr, "localhost", false},
+		{any, "10.0.0.1:8080", true},
+		{&net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, "/run/app.sock", true},
+	}
+	for _, tt := range tests {
+		if same := sameAddr(tt.addr, tt.laddr); same != tt.same {
+			t.Errorf("sameAddr(%v, %q) get %v", tt.addr, tt.laddr, same)
+		}
+	}
+}
+
+// listenFd passes the socket of l by LISTEN_FDS as systemd does, it returns the listeners taken by listenFds.
+func listenFd(t *testing.T, l net.Listener, name string, pid int) ([]net.Listener, []string) {
+	f, err := l.(interface {
+		File() (*os.File, error)
+	}).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("LISTEN_PID", strconv.Itoa(pid))
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("LISTEN_FDNAMES", name)
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	ls, names := listenFds(fd)
+	if len(ls) == 0 {
+		syscall.Close(fd)
+	}
+	return ls, names
+}
+
+func TestActivated(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "beego-grace")
+	defer os.RemoveAll(dir)
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+	ul, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ul.Close()
+
+	if ls, _ := listenFd(t, tl, "web", os.Getpid()+1); len(ls) != 0 {
+		t.Fatalf("the sockets of another pid are taken")
+	}
+	web, names := listenFd(t, tl, "web", os.Getpid())
+	if len(web) != 1 || names[0] != "web" || web[0].Addr().String() != tl.Addr().String() {
+		t.Fatalf("get the activated listeners %v %v", web, names)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("LISTEN_FDS isn't removed for the child")
+	}
+	sock, _ := listenFd(t, ul, "sock", os.Getpid())
+	if len(sock) != 1 {
+		t.Fatalf("the unix socket isn't taken")
+	}
+
+	old, oldNames := activatedListeners, activatedNames
+	defer func() {
+		activatedListeners, activatedNames = old, oldNames
+	}()
+	activatedOnce.Do(func() {})
+	activatedListeners = []net.Listener{web[0], sock[0]}
+	activatedNames = []string{"web", "sock"}
+
+	if l, err := activatedListener("sock"); err == nil || !strings.Contains(err.Error(), "isn't TCP") {
+		t.Errorf("the unix socket is served by %v, %v", l, err)
+	}
+	l, err := activatedListener(tl.Addr().String())
+	if err != nil || l != web[0] {
+		t.Fatalf("the TCP socket isn't matched by the address: %v, %v", l, err)
+	}
+	defer l.Close()
+	if l, _ := activatedListener("web"); l != nil {
+		t.Errorf("the TCP socket is taken twice")
+	}
+	sock[0].Close()
+}
@@ -0,0 +1,195 @@
+package grace
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// the state of the upgrade started by SIGHUP or Upgrade
+const (
+	UPGRADE_NONE      = iota // no upgrade is started
+	UPGRADE_FORKING          // the child is started, waiting for its listeners
+	UPGRADE_SUCCEEDED        // the child is ready, the servers are draining
+	UPGRADE_FAILED           // the child failed to start, the servers keep serving
+)
+
+// the environment variable of the fd notified by the child when it's ready
+const readyFdEnv = "GRACE_READY_FD"
+
+// DefaultReadyTimeout is how long the parent waits for the child to be ready,
+// the child is killed and the parent keeps serving after the timeout.
+var DefaultReadyTimeout = 30 * time.Second
+
+// UpgradeStatus reports the last upgrade of the process.
+type UpgradeStatus struct {
+	State           int       // UPGRADE_NONE, UPGRADE_FORKING, UPGRADE_SUCCEEDED or UPGRADE_FAILED
+	ChildPid        int       // pid of the forked child
+	StartTime       time.Time // when the upgrade is started
+	Error           string    // why the upgrade failed
+	IsChild         bool      // the process is forked by an upgrade
+	SocketActivated bool      // the listeners are passed by systemd
+}
+
+var (
+	statusLock sync.Mutex
+	status     UpgradeStatus
+
+	readyOnce sync.Once
+	listened  int // the listening servers
+)
+
+// Status returns the status of the last upgrade.
+// usage:
+//	beego.Get("/upgrade", func(ctx *context.Context) {
+//		ctx.Output.Json(grace.Status(), false, false)
+//	})
+func Status() UpgradeStatus {
+	statusLock.Lock()
+	defer statusLock.Unlock()
+	s := status
+	s.IsChild = isChild
+	s.SocketActivated = SocketActivated()
+	return s
+}
+
+func setStatus(state, pid int, err error) {
+	statusLock.Lock()
+	defer statusLock.Unlock()
+	status.State = state
+	if pid != 0 {
+		status.ChildPid = pid
+	}
+	if state == UPGRADE_FORKING {
+		status.StartTime = time.Now()
+		status.Error = ""
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+}
+
+// Upgrade forks the child taking the listeners, like SIGHUP.
+// the running servers stop accepting and drain after the child is ready,
+// they keep serving if the child fails to start.
+func Upgrade() error {
+	regLock.Lock()
+	var srv *graceServer
+	if len(runningServersOrder) > 0 {
+		srv = runningServers[runningServersOrder[0]]
+	}
+	regLock.Unlock()
+	if srv == nil {
+		return errors.New("grace: no running server")
+	}
+	return srv.fork()
+}
+
+// startChild starts the child with the listener files and waits for it in background.
+func startChild(path string, args []string, files []*os.File) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(os.Environ(), readyFdEnv+"="+strconv.Itoa(3+len(files)))
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return err
+	}
+	setStatus(UPGRADE_FORKING, cmd.Process.Pid, nil)
+	go waitChild(cmd, r)
+	return nil
+}
+
+// waitChild waits for the ready notification of the child,
+// then the servers drain and the process stops.
+func waitChild(cmd *exec.Cmd, r *os.File) {
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := r.Read(b)
+		r.Close()
+		ready <- err
+	}()
+
+	var err error
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = fmt.Errorf("the child exited before ready: %v", err)
+		}
+	case <-time.After(DefaultReadyTimeout):
+		err = errors.New("the child isn't ready in time")
+		cmd.Process.Kill()
+	}
+	if err != nil {
+		log.Println(os.Getpid(), "Upgrade failed:", err)
+		setStatus(UPGRADE_FAILED, 0, err)
+		go cmd.Wait()
+		regLock.Lock()
+		runningServersForked = false
+		regLock.Unlock()
+		return
+	}
+
+	log.Println(os.Getpid(), "The child", cmd.Process.Pid, "is ready, shutting down.")
+	setStatus(UPGRADE_SUCCEEDED, 0, nil)
+	regLock.Lock()
+	servers := make([]*graceServer, 0, len(runningServers))
+	for _, srv := range runningServers {
+		servers = append(servers, srv)
+	}
+	regLock.Unlock()
+	for _, srv := range servers {
+		go srv.shutdown()
+	}
+}
+
+// notifyReady is called when a server is listening,
+// the child tells the parent and systemd it's ready after all the inherited sockets are listening.
+func notifyReady() {
+	regLock.Lock()
+	listened++
+	expected := 1
+	if socketOrder != "" {
+		expected = len(strings.Split(socketOrder, ","))
+	}
+	n := listened
+	regLock.Unlock()
+
+	if !isChild {
+		sdNotify("READY=1")
+		return
+	}
+	if n < expected {
+		return
+	}
+	readyOnce.Do(func() {
+		sdNotify("MAINPID=" + strconv.Itoa(os.Getpid()) + "\nREADY=1")
+		fd, err := strconv.Atoi(os.Getenv(readyFdEnv))
+		if err != nil {
+			// forked by an old version without the ready fd, stop the parent
+			if process, err := os.FindProcess(os.Getppid()); err == nil {
+				process.Signal(syscall.SIGTERM)
+			}
+			return
+		}
+		f := os.NewFile(uintptr(fd), "ready")
+		f.Write([]byte{1})
+		f.Close()
+		os.Unsetenv(readyFdEnv)
+	})
+}
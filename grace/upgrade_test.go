@@ -0,0 +1,73 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package grace
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSleep starts a child which never notifies, and the pipe of the ready fd.
+func startSleep(t *testing.T) (*exec.Cmd, *os.File, *os.File) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip("can't start the child:", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd, r, w
+}
+
+func TestWaitChildReady(t *testing.T) {
+	cmd, r, w := startSleep(t)
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	defer w.Close()
+
+	w.Write([]byte{1})
+	waitChild(cmd, r)
+	if s := Status(); s.State != UPGRADE_SUCCEEDED {
+		t.Errorf("get the state %d after the child is ready: %s", s.State, s.Error)
+	}
+}
+
+func TestWaitChildTimeout(t *testing.T) {
+	old := DefaultReadyTimeout
+	DefaultReadyTimeout = 100 * time.Millisecond
+	defer func() { DefaultReadyTimeout = old }()
+
+	cmd, r, w := startSleep(t)
+	defer w.Close()
+
+	waitChild(cmd, r)
+	if s := Status(); s.State != UPGRADE_FAILED || !strings.Contains(s.Error, "in time") {
+		t.Errorf("get the state %d after the timeout: %s", s.State, s.Error)
+	}
+}
+
+func TestWaitChildExited(t *testing.T) {
+	cmd, r, w := startSleep(t)
+	defer cmd.Process.Kill()
+
+	w.Close()
+	waitChild(cmd, r)
+	if s := Status(); s.State != UPGRADE_FAILED || !strings.Contains(s.Error, "before ready") {
+		t.Errorf("get the state %d after the pipe is closed: %s", s.State, s.Error)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hostRouter owns the routers, filters and error handlers of a host pattern.
+type hostRouter struct {
+	pattern  string
+	regexps  *regexp.Regexp
+	params   []string
+	handlers *ControllerRegistor
+}
+
+// hostMatch is stored in the request context when a host router is matched.
+type hostMatch struct {
+	handlers *ControllerRegistor
+	params   map[string]string
+}
+
+type hostMatchKey struct{}
+
+// Host returns the ControllerRegistor serving the host pattern,
+// it's created at the first call.
+// the pattern supports:
+//	exact host:         api.example.com
+//	wildcard subdomain: *.example.com
+//	captured subdomain: :tenant.example.com, the value is in Input.Param(":tenant")
+// the requests whose host matches no pattern are served by p itself.
+// usage:
+//	api := beego.BeeApp.Handlers.Host("api.example.com")
+//	api.Add("/user", &UserController{})
+//	api.InsertFilter("/*", beego.BeforeRouter, auth)
+//	api.ErrorHandler("404", apiNotFound)
+func (p *ControllerRegistor) Host(pattern string) *ControllerRegistor {
+	pattern = strings.ToLower(pattern)
+	for _, h := range p.hosts {
+		if h.pattern == pattern {
+			return h.handlers
+		}
+	}
+	h := &hostRouter{pattern: pattern, handlers: NewControllerRegister()}
+	h.handlers.parent = p
+	h.regexps, h.params = compileHostPattern(pattern)
+	p.hosts = append(p.hosts, h)
+	return h.handlers
+}
+
+// compileHostPattern converts the host pattern to regexp and the names of the captured labels.
+func compileHostPattern(pattern string) (*regexp.Regexp, []string) {
+	var params []string
+	labels := strings.Split(pattern, ".")
+	for i, l := range labels {
+		switch {
+		case l == "*":
+			labels[i] = `[^.]+`
+		case strings.HasPrefix(l, ":") && len(l) > 1:
+			params = append(params, l)
+			labels[i] = `([^.]+)`
+		default:
+			labels[i] = regexp.QuoteMeta(l)
+		}
+	}
+	return regexp.MustCompile("^" + strings.Join(labels, `\.`) + "$"), params
+}
+
+// matchHost finds the first host router matching the request host, the port is ignored.
+func (p *ControllerRegistor) matchHost(host string) (*hostRouter, map[string]string) {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	host = strings.ToLower(host)
+	for _, h := range p.hosts {
+		matches := h.regexps.FindStringSubmatch(host)
+		if matches == nil {
+			continue
+		}
+		params := make(map[string]string, len(h.params))
+		for i, name := range h.params {
+			params[name] = matches[i+1]
+		}
+		return h, params
+	}
+	return nil, nil
+}
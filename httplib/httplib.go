@@ -33,6 +33,7 @@ package httplib
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
@@ -49,6 +50,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/astaxie/beego/trace"
 )
 
 var defaultSetting = BeegoHttpSettings{
@@ -163,6 +166,16 @@ func (b *BeegoHttpRequest) GetRequest() *http.Request {
 	return b.req
 }
 
+// WithContext sends the request with ctx, it's canceled when ctx is done.
+// the request id and the trace context of ctx are sent in the headers,
+// so the request is correlated with the request of beego serving it.
+// usage:
+//	httplib.Get("http://api/user").WithContext(this.RequestContext()).String()
+func (b *BeegoHttpRequest) WithContext(ctx context.Context) *BeegoHttpRequest {
+	b.req = b.req.WithContext(ctx)
+	return b
+}
+
 // Change request settings
 func (b *BeegoHttpRequest) Setting(setting BeegoHttpSettings) *BeegoHttpRequest {
 	b.setting = setting
@@ -439,6 +452,10 @@ func (b *BeegoHttpRequest) SendOut() (*http.Response, error) {
 		Jar:       jar,
 	}
 
+	if span := trace.FromContext(b.req.Context()); span != nil {
+		span.Inject(b.req.Header)
+	}
+
 	if b.setting.UserAgent != "" && b.req.Header.Get("User-Agent") == "" {
 		b.req.Header.Set("User-Agent", b.setting.UserAgent)
 	}
@@ -15,10 +15,15 @@
 package httplib
 
 import (
+	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/astaxie/beego/trace"
 )
 
 func TestResponse(t *testing.T) {
@@ -195,10 +200,10 @@ func TestToFile(t *testing.T) {
 	f := "beego_testfile"
 	req := Get("http://httpbin.org/ip")
 	err := req.ToFile(f)
+	defer os.Remove(f)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(f)
 	b, err := ioutil.ReadFile(f)
 	if n := strings.Index(string(b), "origin"); n == -1 {
 		t.Fatal(err)
@@ -214,3 +219,19 @@ func TestHeader(t *testing.T) {
 	}
 	t.Log(str)
 }
+
+func TestWithContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Request-Id") + " " + r.Header.Get("Traceparent")))
+	}))
+	defer ts.Close()
+
+	span := trace.FromHeader(http.Header{"X-Request-Id": {"req-1"}})
+	str, err := Get(ts.URL).WithContext(trace.NewContext(context.Background(), span)).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "req-1 " + span.TraceParent(); str != want {
+		t.Errorf("get %q, want %q", str, want)
+	}
+}
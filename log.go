@@ -55,6 +55,22 @@ func SetLogger(adaptername string, config string) error {
 	return nil
 }
 
+// AccessLogger receives the access logs in AccessLogsFormat, BeeLogger is used if it's nil.
+var AccessLogger *logs.BeeLogger
+
+// SetAccessLogger adds the logger adapter of the access logs,
+// so they are written apart from the application logs.
+// usage:
+//	beego.AccessLogs = true
+//	beego.AccessLogsFormat = "json"
+//	beego.SetAccessLogger("file", `{"filename":"logs/access.log"}`)
+func SetAccessLogger(adaptername string, config string) error {
+	if AccessLogger == nil {
+		AccessLogger = logs.NewLogger(10000)
+	}
+	return AccessLogger.SetLogger(adaptername, config)
+}
+
 func Emergency(v ...interface{}) {
 	BeeLogger.Emergency(generateFmtStr(len(v)), v...)
 }
@@ -33,24 +33,15 @@ var lock sync.RWMutex
 
 // OpenMemZipFile returns MemFile object with a compressed static file.
 // it's used for serve static file if gzip enable.
-func openMemZipFile(path string, zip string) (*memFile, error) {
-	osfile, e := os.Open(path)
-	if e != nil {
-		return nil, e
-	}
-	defer osfile.Close()
-
-	osfileinfo, e := osfile.Stat()
-	if e != nil {
-		return nil, e
-	}
-
+// the compressed content is cached by the key until the file is modified, it's not cached if the key is empty.
+func openMemZipFile(key string, osfile io.Reader, osfileinfo os.FileInfo, zip string) (*memFile, error) {
+	var e error
 	modtime := osfileinfo.ModTime()
 	fileSize := osfileinfo.Size()
 	lock.RLock()
-	cfi, ok := gmfim[zip+":"+path]
+	cfi, ok := gmfim[zip+":"+key]
 	lock.RUnlock()
-	if !(ok && cfi.ModTime() == modtime && cfi.fileSize == fileSize) {
+	if !(ok && key != "" && cfi.ModTime() == modtime && cfi.fileSize == fileSize) {
 		var content []byte
 		if zip == "gzip" {
 			var zipbuf bytes.Buffer
@@ -90,9 +81,11 @@ func openMemZipFile(path string, zip string) (*memFile, error) {
 		}
 
 		cfi = &memFileInfo{osfileinfo, modtime, content, int64(len(content)), fileSize}
-		lock.Lock()
-		defer lock.Unlock()
-		gmfim[zip+":"+path] = cfi
+		if key != "" {
+			lock.Lock()
+			defer lock.Unlock()
+			gmfim[zip+":"+key] = cfi
+		}
 	}
 	return &memFile{fi: cfi, offset: 0}, nil
 }
@@ -0,0 +1,47 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego/metrics"
+)
+
+// the metrics of the http requests, they are recorded if EnableAdmin is true
+// and served at /metrics of the admin server.
+var (
+	httpRequests = metrics.NewCounter("beego_http_requests_total", "The http requests served.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("beego_http_request_duration_seconds", "The latency of the http requests.", nil, "method", "route", "status")
+	httpInFlight = metrics.NewGauge("beego_http_requests_in_flight", "The http requests being served.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("beego_sessions_active", "The active sessions of GlobalSessions.", func() float64 {
+		if GlobalSessions == nil {
+			return 0
+		}
+		return float64(GlobalSessions.GetActiveSession())
+	})
+}
+
+// observeRequest records the request in the metrics,
+// it's labeled by the route pattern rather than the url, so /user/1 and /user/2 are the same route.
+func observeRequest(method, route string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.Inc(method, route, code)
+	httpDuration.Observe(elapsed.Seconds(), method, route, code)
+}
@@ -0,0 +1,340 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides counters, gauges and histograms exposed in the Prometheus text format.
+//
+// beego records the http requests, the ORM queries, the cache hits and the task runs in DefaultRegistry,
+// it's served at /metrics of the admin server.
+//
+// Usage:
+//
+//		import "github.com/astaxie/beego/metrics"
+//
+//		var orders = metrics.NewCounter("shop_orders_total", "The orders created.", "payment")
+//		var queue = metrics.NewGauge("shop_queue_length", "The jobs in the queue.")
+//
+//		orders.Inc("alipay")
+//		queue.Set(float64(len(jobs)))
+//
+//	 more docs https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default buckets of the histograms in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// the metric types
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry keeps the metrics.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*metric
+}
+
+// DefaultRegistry is used by the package functions.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+// metric is a family of the series with the same name.
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	fn      func() float64 // the gauge computed when it's collected
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is the value of a metric with the label values.
+type series struct {
+	values []string
+	value  float64  // the counter and the gauge
+	counts []uint64 // the histogram buckets
+	sum    float64  // the histogram sum
+	count  uint64   // the histogram count
+}
+
+// register returns the registered metric of the name, or registers a new one.
+// it panics if the metric is registered with another type or labels.
+func (r *Registry) register(m *metric) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.metrics[m.name]; ok {
+		if old.typ != m.typ || strings.Join(old.labels, ",") != strings.Join(m.labels, ",") {
+			panic("metrics: " + m.name + " is registered with another type or labels")
+		}
+		return old
+	}
+	m.series = make(map[string]*series)
+	r.metrics[m.name] = m
+	return m
+}
+
+// Unregister removes the metric of the name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.metrics, name)
+}
+
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if m.typ == typeHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value which only goes up, such as the requests served.
+type Counter struct{ m *metric }
+
+// NewCounter registers the counter with the label names.
+// the counter registered before is returned if the name is registered.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(&metric{name: name, help: help, typ: typeCounter, labels: labels})}
+}
+
+// Inc increases the counter of the label values by 1.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases the counter of the label values by v, v must not be negative.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.m.name + " can't decrease")
+	}
+	c.m.mu.Lock()
+	c.m.get(values).value += v
+	c.m.mu.Unlock()
+}
+
+// Gauge is a value which goes up and down, such as the requests in flight.
+type Gauge struct{ m *metric }
+
+// NewGauge registers the gauge with the label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(&metric{name: name, help: help, typ: typeGauge, labels: labels})}
+}
+
+// NewGaugeFunc registers the gauge whose value is returned by f when it's collected.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	m := r.register(&metric{name: name, help: help, typ: typeGauge})
+	m.mu.Lock()
+	m.fn = f
+	m.mu.Unlock()
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.m.get(values).value = v
+	g.m.mu.Unlock()
+}
+
+// Add adds v to the gauge of the label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.m.get(values).value += v
+	g.m.mu.Unlock()
+}
+
+// Inc increases the gauge by 1.
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec decreases the gauge by 1.
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Histogram counts the observations in the buckets, such as the request durations.
+type Histogram struct{ m *metric }
+
+// NewHistogram registers the histogram with the upper bounds of the buckets and the label names,
+// DefBuckets is used if buckets is nil.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(&metric{name: name, help: help, typ: typeHistogram, labels: labels, buckets: buckets})}
+}
+
+// Observe adds the observation of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.m.mu.Lock()
+	s := h.m.get(values)
+	for i, b := range h.m.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	h.m.mu.Unlock()
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	ms := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ms = append(ms, m)
+	}
+	r.mu.RUnlock()
+	sort.Sort(byName(ms))
+
+	var buf bytes.Buffer
+	for _, m := range ms {
+		m.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+func (m *metric) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fn != nil {
+		m.get(nil).value = m.fn()
+	}
+	if len(m.series) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.typ != typeHistogram {
+			fmt.Fprintf(buf, "%s%s %s\n", m.name, labelPairs(m.labels, s.values, "", 0), formatFloat(s.value))
+			continue
+		}
+		for i, b := range m.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, labelPairs(m.labels, s.values, "le", b), s.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, labelPairs(m.labels, s.values, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", m.name, labelPairs(m.labels, s.values, "", 0), formatFloat(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", m.name, labelPairs(m.labels, s.values, "", 0), s.count)
+	}
+}
+
+// ServeHTTP writes the metrics, it's the scrape endpoint of Prometheus.
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(rw)
+}
+
+type byName []*metric
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// labelPairs formats the labels like {method="GET",le="0.5"}, le is added if it's not empty.
+func labelPairs(names, values []string, le string, bound float64) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		pairs = append(pairs, n+`="`+escapeValue(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, le+`="`+formatFloat(bound)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
+
+// NewCounter registers the counter in DefaultRegistry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers the gauge in DefaultRegistry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers the gauge computed by f in DefaultRegistry.
+func NewGaugeFunc(name, help string, f func() float64) {
+	DefaultRegistry.NewGaugeFunc(name, help, f)
+}
+
+// NewHistogram registers the histogram in DefaultRegistry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// Handler returns the http.Handler writing the metrics of DefaultRegistry.
+func Handler() http.Handler {
+	return DefaultRegistry
+}
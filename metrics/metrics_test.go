@@ -0,0 +1,92 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "The requests.", "method", "path")
+	c.Inc("GET", "/")
+	c.Add(2, "GET", "/")
+	c.Inc("POST", `/a"b`)
+	g := r.NewGauge("in_flight", "In flight\nrequests.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	r.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+	h := r.NewHistogram("latency_seconds", "The latency.", []float64{0.5, 0.1}, "route")
+	h.Observe(0.05, "/user/:id")
+	h.Observe(0.3, "/user/:id")
+	h.Observe(2, "/user/:id")
+	r.NewCounter("unused_total", "Not written without series.")
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	want := `# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+# HELP in_flight In flight\nrequests.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds The latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/user/:id",le="0.1"} 1
+latency_seconds_bucket{route="/user/:id",le="0.5"} 2
+latency_seconds_bucket{route="/user/:id",le="+Inf"} 3
+latency_seconds_sum{route="/user/:id"} 2.35
+latency_seconds_count{route="/user/:id"} 3
+# HELP requests_total The requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/"} 3
+requests_total{method="POST",path="/a\"b"} 1
+`
+	if buf.String() != want {
+		t.Errorf("get\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	r.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") || w.Body.String() != want {
+		t.Errorf("ServeHTTP get %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	c1 := r.NewCounter("c_total", "C.", "a")
+	c2 := r.NewCounter("c_total", "C.", "a")
+	c1.Inc("x")
+	c2.Inc("x")
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `c_total{a="x"} 2`) {
+		t.Errorf("the counters of the same name aren't shared:\n%s", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering the name with another type should panic")
+		}
+	}()
+	r.NewGauge("c_total", "C.", "a")
+}
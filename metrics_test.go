@@ -0,0 +1,54 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/metrics"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	EnableAdmin = true
+	defer func() { EnableAdmin = false }()
+
+	handler := NewControllerRegister()
+	handler.Get("/metrics/user/:id", func(ctx *context.Context) {
+		ctx.Output.Body([]byte(ctx.Input.Param(":id")))
+	})
+	for _, url := range []string{"/metrics/user/1", "/metrics/user/2", "/metrics/nothing"} {
+		r, _ := http.NewRequest("GET", url, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		`beego_http_requests_total{method="GET",route="/metrics/user/:id",status="200"} 2`,
+		`beego_http_requests_total{method="GET",route="notfound",status="404"} 1`,
+		`beego_http_request_duration_seconds_count{method="GET",route="/metrics/user/:id",status="200"} 2`,
+		`beego_http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the metrics don't contain %s:\n%s", want, out)
+		}
+	}
+}
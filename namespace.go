@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	beecontext "github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/websocket"
 )
 
 type namespaceCond func(*beecontext.Context) bool
@@ -27,8 +28,9 @@ type innnerNamespace func(*Namespace)
 
 // Namespace is store all the info
 type Namespace struct {
-	prefix   string
-	handlers *ControllerRegistor
+	prefix      string
+	handlers    *ControllerRegistor
+	middlewares []MiddleWare
 }
 
 // get new Namespace
@@ -72,6 +74,15 @@ func (n *Namespace) Cond(cond namespaceCond) *Namespace {
 	return n
 }
 
+// ProblemJson writes the errors of the routes in this namespace,
+// including 404 and 405 of the urls under its prefix, as application/problem+json.
+// usage:
+// ns.ProblemJson()
+func (n *Namespace) ProblemJson() *Namespace {
+	n.handlers.problemPrefixes = append(n.handlers.problemPrefixes, "/")
+	return n
+}
+
 // add filter in the Namespace
 // action has before & after
 // FilterFunc
@@ -95,6 +106,16 @@ func (n *Namespace) Filter(action string, filter ...FilterFunc) *Namespace {
 	return n
 }
 
+// add middlewares in the Namespace
+// they are wrapped around every router of this Namespace and its sub Namespaces,
+// the Namespace middlewares run outside the middlewares of the router itself.
+// usage:
+// Use(Timer, Recovery)
+func (n *Namespace) Use(mws ...MiddleWare) *Namespace {
+	n.middlewares = append(n.middlewares, mws...)
+	return n
+}
+
 // same as beego.Rourer
 // refer: https://godoc.org/github.com/astaxie/beego#Router
 func (n *Namespace) Router(rootpath string, c ControllerInterface, mappingMethods ...string) *Namespace {
@@ -123,6 +144,13 @@ func (n *Namespace) Get(rootpath string, f FilterFunc) *Namespace {
 	return n
 }
 
+// same as beego.WebSocket
+// refer: https://godoc.org/github.com/astaxie/beego#WebSocket
+func (n *Namespace) WebSocket(rootpath string, h WebSocketHandler, upgrader ...*websocket.Upgrader) *Namespace {
+	n.handlers.WebSocket(rootpath, h, upgrader...)
+	return n
+}
+
 // same as beego.Post
 // refer: https://godoc.org/github.com/astaxie/beego#Post
 func (n *Namespace) Post(rootpath string, f FilterFunc) *Namespace {
@@ -205,6 +233,8 @@ func (n *Namespace) Include(cList ...ControllerInterface) *Namespace {
 //)
 func (n *Namespace) Namespace(ns ...*Namespace) *Namespace {
 	for _, ni := range ns {
+		ni.applyMiddlewares()
+		addProblemPrefixes(n.handlers, ni)
 		for k, v := range ni.handlers.routers {
 			if t, ok := n.handlers.routers[k]; ok {
 				addPrefix(v, ni.prefix)
@@ -234,6 +264,8 @@ func (n *Namespace) Namespace(ns ...*Namespace) *Namespace {
 // support multi Namespace
 func AddNamespace(nl ...*Namespace) {
 	for _, n := range nl {
+		n.applyMiddlewares()
+		addProblemPrefixes(BeeApp.Handlers, n)
 		for k, v := range n.handlers.routers {
 			if t, ok := BeeApp.Handlers.routers[k]; ok {
 				addPrefix(v, n.prefix)
@@ -258,6 +290,44 @@ func AddNamespace(nl ...*Namespace) {
 	}
 }
 
+// applyMiddlewares prepends the Namespace middlewares to all the routers,
+// it's called when the Namespace is merged into its parent.
+func (n *Namespace) applyMiddlewares() {
+	if len(n.middlewares) == 0 {
+		return
+	}
+	// one controllerInfo is shared by all the method trees, only add once
+	routes := make(map[*controllerInfo]bool)
+	for _, t := range n.handlers.routers {
+		collectRoutes(t, routes)
+	}
+	for c := range routes {
+		c.middlewares = append(append([]MiddleWare{}, n.middlewares...), c.middlewares...)
+	}
+	n.middlewares = nil
+}
+
+func collectRoutes(t *Tree, routes map[*controllerInfo]bool) {
+	for _, v := range t.fixrouters {
+		collectRoutes(v, routes)
+	}
+	if t.wildcard != nil {
+		collectRoutes(t.wildcard, routes)
+	}
+	for _, l := range t.leaves {
+		if c, ok := l.runObject.(*controllerInfo); ok {
+			routes[c] = true
+		}
+	}
+}
+
+// addProblemPrefixes adds the problem+json prefixes of the namespace to p
+func addProblemPrefixes(p *ControllerRegistor, n *Namespace) {
+	for _, prefix := range n.handlers.problemPrefixes {
+		p.problemPrefixes = append(p.problemPrefixes, n.prefix+strings.TrimSuffix(prefix, "/"))
+	}
+}
+
 func addPrefix(t *Tree, prefix string) {
 	for _, v := range t.fixrouters {
 		addPrefix(v, prefix)
@@ -269,12 +339,20 @@ func addPrefix(t *Tree, prefix string) {
 		if c, ok := l.runObject.(*controllerInfo); ok {
 			if !strings.HasPrefix(c.pattern, prefix) {
 				c.pattern = prefix + c.pattern
+				c.namespace = prefix + c.namespace
 			}
 		}
 	}
 
 }
 
+// Namespace problem+json errors
+func NSProblemJson() innnerNamespace {
+	return func(ns *Namespace) {
+		ns.ProblemJson()
+	}
+}
+
 // Namespace Condition
 func NSCond(cond namespaceCond) innnerNamespace {
 	return func(ns *Namespace) {
@@ -296,6 +374,13 @@ func NSAfter(filiterList ...FilterFunc) innnerNamespace {
 	}
 }
 
+// Namespace middlewares
+func NSUse(mws ...MiddleWare) innnerNamespace {
+	return func(ns *Namespace) {
+		ns.Use(mws...)
+	}
+}
+
 // Namespace Include ControllerInterface
 func NSInclude(cList ...ControllerInterface) innnerNamespace {
 	return func(ns *Namespace) {
@@ -317,6 +402,13 @@ func NSGet(rootpath string, f FilterFunc) innnerNamespace {
 	}
 }
 
+// Namespace WebSocket
+func NSWebSocket(rootpath string, h WebSocketHandler, upgrader ...*websocket.Upgrader) innnerNamespace {
+	return func(ns *Namespace) {
+		ns.WebSocket(rootpath, h, upgrader...)
+	}
+}
+
 // Namespace Post
 func NSPost(rootpath string, f FilterFunc) innnerNamespace {
 	return func(ns *Namespace) {
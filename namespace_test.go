@@ -169,3 +169,64 @@ func TestNamespaceInside(t *testing.T) {
 		t.Errorf("TestNamespaceInside can't run, get the response is " + w.Body.String())
 	}
 }
+
+func TestNamespaceMiddleWare(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/v4/shop/order", nil)
+	w := httptest.NewRecorder()
+	ns := NewNamespace("/v4",
+		NSUse(beegoMiddleWare("v4")),
+		NSNamespace("/shop",
+			NSUse(beegoMiddleWare("shop")),
+			NSGet("/order", func(ctx *context.Context) {
+				ctx.WriteString("|order")
+			}),
+		),
+	)
+	AddNamespace(ns)
+	BeeApp.Handlers.ServeHTTP(w, r)
+	if w.Body.String() != "|v4Before|shopBefore|order|shopAfter|v4After" {
+		t.Errorf("TestNamespaceMiddleWare can't run, get the response is " + w.Body.String())
+	}
+}
+
+func TestNamespaceRoutes(t *testing.T) {
+	ns := NewNamespace("/v1")
+	ns.Namespace(
+		NewNamespace("/admin").
+			Get("/routes", func(ctx *context.Context) {}),
+	)
+	AddNamespace(ns)
+	for _, r := range BeeApp.Handlers.Routes() {
+		if r.Pattern == "/v1/admin/routes" {
+			if r.Method != "GET" || r.Namespace != "/v1/admin" {
+				t.Errorf("TestNamespaceRoutes get the route %+v", r)
+			}
+			return
+		}
+	}
+	t.Errorf("TestNamespaceRoutes can't find the route")
+}
+
+func TestNamespaceProblemJson(t *testing.T) {
+	ns := NewNamespace("/v1problem",
+		NSProblemJson(),
+		NSGet("/user", func(ctx *context.Context) {
+			ctx.Output.Body([]byte("user"))
+		}),
+	)
+	AddNamespace(ns)
+
+	r, _ := http.NewRequest("GET", "/v1problem/notexist", nil)
+	w := httptest.NewRecorder()
+	BeeApp.Handlers.ServeHTTP(w, r)
+	if w.Code != 404 || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("TestNamespaceProblemJson get the response %d %s", w.Code, w.Body.String())
+	}
+
+	r, _ = http.NewRequest("GET", "/v1problemx/notexist", nil)
+	w = httptest.NewRecorder()
+	BeeApp.Handlers.ServeHTTP(w, r)
+	if w.Header().Get("Content-Type") == "application/problem+json" {
+		t.Errorf("TestNamespaceProblemJson get problem+json out of the namespace")
+	}
+}
@@ -325,6 +325,11 @@ func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Lo
 
 	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ?", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q)
 
+	// the soft deleted row isn't read
+	if fi := mi.fields.deletedAt; fi != nil {
+		query += fmt.Sprintf(" AND %s%s%s IS NULL", Q, fi.column, Q)
+	}
+
 	refs := make([]interface{}, colsNum)
 	for i := range refs {
 		var ref interface{}
@@ -486,22 +491,59 @@ func (d *dbBase) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 		return 0, err
 	}
 
+	// optimistic locking, the version is increased by the database
+	vfi := mi.fields.version
+	var version interface{}
+	if vfi != nil {
+		for i, name := range setNames {
+			if name == vfi.column {
+				setNames = append(setNames[:i], setNames[i+1:]...)
+				setValues = append(setValues[:i], setValues[i+1:]...)
+				break
+			}
+		}
+		if version, err = d.collectFieldValue(mi, vfi, ind, false, tz); err != nil {
+			return 0, err
+		}
+	}
+
 	setValues = append(setValues, pkValue)
 
 	Q := d.ins.TableQuote()
 
-	sep := fmt.Sprintf("%s = ?, %s", Q, Q)
-	setColumns := strings.Join(setNames, sep)
+	sets := make([]string, 0, len(setNames)+1)
+	for _, name := range setNames {
+		sets = append(sets, fmt.Sprintf("%s%s%s = ?", Q, name, Q))
+	}
+	wheres := fmt.Sprintf("%s%s%s = ?", Q, pkName, Q)
+	if vfi != nil {
+		sets = append(sets, fmt.Sprintf("%s%s%s = %s%s%s + 1", Q, vfi.column, Q, Q, vfi.column, Q))
+		wheres += fmt.Sprintf(" AND %s%s%s = ?", Q, vfi.column, Q)
+		setValues = append(setValues, version)
+	}
 
-	query := fmt.Sprintf("UPDATE %s%s%s SET %s%s%s = ? WHERE %s%s%s = ?", Q, mi.table, Q, Q, setColumns, Q, Q, pkName, Q)
+	query := fmt.Sprintf("UPDATE %s%s%s SET %s WHERE %s", Q, mi.table, Q, strings.Join(sets, ", "), wheres)
 
 	d.ins.ReplaceMarks(&query)
 
-	if res, err := q.Exec(query, setValues...); err == nil {
-		return res.RowsAffected()
-	} else {
+	res, err := q.Exec(query, setValues...)
+	if err != nil {
 		return 0, err
 	}
+	num, err := res.RowsAffected()
+	if err != nil || vfi == nil {
+		return num, err
+	}
+	if num == 0 {
+		return 0, ErrStaleObject
+	}
+	field := ind.Field(vfi.fieldIndex)
+	if vfi.fieldType&IsPostiveIntegerField > 0 {
+		field.SetUint(field.Uint() + 1)
+	} else {
+		field.SetInt(field.Int() + 1)
+	}
+	return num, nil
 }
 
 // execute delete sql dbQuerier with given struct reflect.Value.
@@ -549,12 +591,16 @@ func (d *dbBase) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 // update table-related record by querySet.
 // need querySet not struct reflect.Value to update related records.
 func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, params Params, tz *time.Location) (int64, error) {
-	columns := make([]string, 0, len(params))
-	values := make([]interface{}, 0, len(params))
+	columns := make([]string, 0, len(params)+1)
+	values := make([]interface{}, 0, len(params)+1)
+	vfi := mi.fields.version
 	for col, val := range params {
 		if fi, ok := mi.fields.GetByAny(col); ok == false || fi.dbcol == false {
 			panic(fmt.Errorf("wrong field/column name `%s`", col))
 		} else {
+			if fi == vfi {
+				vfi = nil
+			}
 			columns = append(columns, fi.column)
 			values = append(values, val)
 		}
@@ -564,6 +610,12 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 		panic(fmt.Errorf("update params cannot empty"))
 	}
 
+	// optimistic locking, the version of the updated rows is increased too
+	if vfi != nil {
+		columns = append(columns, vfi.column)
+		values = append(values, ColValue(Col_Add, 1))
+	}
+
 	tables := newDbTables(mi, d.ins)
 	if qs != nil {
 		tables.parseRelated(qs.related, qs.relDepth)
@@ -1560,6 +1612,11 @@ func (d *dbBase) SupportUpdateJoin() bool {
 	return true
 }
 
+// the nested transactions use SAVEPOINT, RELEASE SAVEPOINT and ROLLBACK TO SAVEPOINT.
+func (d *dbBase) SupportSavepoint() bool {
+	return true
+}
+
 func (d *dbBase) MaxLimit() uint64 {
 	return 18446744073709551615
 }
@@ -107,6 +107,7 @@ type alias struct {
 	DbBaser      dbBaser
 	TZ           *time.Location
 	Engine       string
+	cluster      *cluster // the primary and the replicas if it's a cluster alias
 }
 
 func detectTZ(al *alias) {
@@ -0,0 +1,210 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the default interval of pinging the replicas of a cluster
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// a replica of a cluster alias.
+type replica struct {
+	alias   *alias
+	weight  int
+	current int  // the current weight of the smooth weighted round-robin
+	down    bool // ejected until it answers the ping again
+}
+
+// cluster groups a primary and its replicas.
+type cluster struct {
+	primary  *alias
+	mu       sync.Mutex
+	replicas []*replica
+	stop     chan struct{}
+}
+
+// RegisterCluster registers the alias clusterName grouping the registered aliases,
+// the primary and its replicas.
+// with Using(clusterName), the reads of QuerySeter and the SELECTs of Raw are sent to a healthy replica
+// in round-robin, or weighted by SetReplicaWeight, the others are sent to the primary,
+// so are all the queries in transactions and of Ormer.ForcePrimary.
+// the replicas are pinged every DefaultHealthCheckInterval, the failed ones are ejected until they
+// answer again, the reads are sent to the primary if all the replicas are down.
+// usage:
+//	orm.RegisterDataBase("primary", "mysql", "root:root@tcp(10.0.0.1:3306)/orm_test")
+//	orm.RegisterDataBase("replica1", "mysql", "root:root@tcp(10.0.0.2:3306)/orm_test")
+//	orm.RegisterDataBase("replica2", "mysql", "root:root@tcp(10.0.0.3:3306)/orm_test")
+//	orm.RegisterCluster("default", "primary", "replica1", "replica2")
+func RegisterCluster(clusterName, primary string, replicas ...string) error {
+	p, ok := dataBaseCache.get(primary)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", primary)
+	}
+	if p.cluster != nil {
+		return fmt.Errorf("DataBase alias name `%s` is a cluster, cannot be the primary", primary)
+	}
+
+	c := &cluster{primary: p}
+	for _, name := range replicas {
+		r, ok := dataBaseCache.get(name)
+		if !ok {
+			return fmt.Errorf("DataBase alias name `%s` not registered", name)
+		}
+		if r.cluster != nil || r.Driver != p.Driver {
+			return fmt.Errorf("DataBase alias name `%s` cannot be a replica of `%s`", name, primary)
+		}
+		c.replicas = append(c.replicas, &replica{alias: r, weight: 1})
+	}
+
+	al := new(alias)
+	*al = *p
+	al.Name = clusterName
+	al.cluster = c
+	if dataBaseCache.add(clusterName, al) == false {
+		return fmt.Errorf("DataBase alias name `%s` already registered, cannot reuse", clusterName)
+	}
+	c.healthCheck(DefaultHealthCheckInterval)
+	return nil
+}
+
+// SetReplicaWeight changes the weight of the replica in the cluster, the default is 1,
+// a replica of weight 2 serves twice the reads of a replica of weight 1, 0 serves none.
+func SetReplicaWeight(clusterName, replicaName string, weight int) error {
+	c, err := getCluster(clusterName)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.replicas {
+		if r.alias.Name == replicaName {
+			r.weight = weight
+			r.current = 0
+			return nil
+		}
+	}
+	return fmt.Errorf("DataBase alias name `%s` is not a replica of `%s`", replicaName, clusterName)
+}
+
+// SetClusterHealthCheck changes the interval of pinging the replicas, 0 stops it.
+func SetClusterHealthCheck(clusterName string, interval time.Duration) error {
+	c, err := getCluster(clusterName)
+	if err != nil {
+		return err
+	}
+	c.healthCheck(interval)
+	return nil
+}
+
+func getCluster(name string) (*cluster, error) {
+	al, ok := dataBaseCache.get(name)
+	if !ok || al.cluster == nil {
+		return nil, fmt.Errorf("DataBase cluster name `%s` not registered", name)
+	}
+	return al.cluster, nil
+}
+
+// restart the health checking with the interval.
+func (c *cluster) healthCheck(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	if interval <= 0 || len(c.replicas) == 0 {
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.checkHealth(interval)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ping the replicas, the failed ones are ejected.
+func (c *cluster) checkHealth(timeout time.Duration) {
+	c.mu.Lock()
+	replicas := append([]*replica(nil), c.replicas...)
+	c.mu.Unlock()
+
+	for _, r := range replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.alias.DB.PingContext(ctx)
+		cancel()
+
+		c.mu.Lock()
+		if down := err != nil; down != r.down {
+			r.down = down
+			r.current = 0
+			if down {
+				DebugLog.Printf("replica `%s` of `%s` is ejected, %s\n", r.alias.Name, c.primary.Name, err.Error())
+			} else {
+				DebugLog.Printf("replica `%s` of `%s` is back\n", r.alias.Name, c.primary.Name)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// pick a healthy replica by the smooth weighted round-robin,
+// nil if there's none.
+func (c *cluster) pick() *alias {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best *replica
+	total := 0
+	for _, r := range c.replicas {
+		if r.down || r.weight <= 0 {
+			continue
+		}
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	return best.alias
+}
+
+// check the raw query can be sent to a replica,
+// it's a SELECT without locking reads.
+func isReadQuery(query string) bool {
+	q := strings.ToUpper(strings.TrimLeft(query, " \t\r\n("))
+	if !strings.HasPrefix(q, "SELECT") {
+		return false
+	}
+	return !strings.Contains(q, " FOR UPDATE") && !strings.Contains(q, " FOR SHARE") &&
+		!strings.Contains(q, " LOCK IN SHARE MODE")
+}
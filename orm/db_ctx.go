@@ -0,0 +1,103 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+)
+
+// db querier with context support, *sql.DB and *sql.Tx implement it.
+type dbQuerierCtx interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// transaction beginner with context support
+type txerCtx interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// database querier bound to a context.
+// every query is sent with QueryContext/ExecContext, so it's canceled
+// and the connection is released when the context is done.
+type dbQueryCtx struct {
+	ctx context.Context
+	db  dbQuerier
+}
+
+var _ dbQuerier = new(dbQueryCtx)
+var _ txer = new(dbQueryCtx)
+var _ txerCtx = new(dbQueryCtx)
+var _ txEnder = new(dbQueryCtx)
+
+func (d *dbQueryCtx) Prepare(query string) (*sql.Stmt, error) {
+	if db, ok := d.db.(dbQuerierCtx); ok {
+		return db.PrepareContext(d.ctx, query)
+	}
+	return d.db.Prepare(query)
+}
+
+func (d *dbQueryCtx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db, ok := d.db.(dbQuerierCtx); ok {
+		return db.ExecContext(d.ctx, query, args...)
+	}
+	return d.db.Exec(query, args...)
+}
+
+func (d *dbQueryCtx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db, ok := d.db.(dbQuerierCtx); ok {
+		return db.QueryContext(d.ctx, query, args...)
+	}
+	return d.db.Query(query, args...)
+}
+
+func (d *dbQueryCtx) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db, ok := d.db.(dbQuerierCtx); ok {
+		return db.QueryRowContext(d.ctx, query, args...)
+	}
+	return d.db.QueryRow(query, args...)
+}
+
+// begin a transaction bound to the context,
+// the driver rolls it back if the context is canceled before Commit.
+func (d *dbQueryCtx) Begin() (*sql.Tx, error) {
+	if db, ok := d.db.(txerCtx); ok {
+		return db.BeginTx(d.ctx, nil)
+	}
+	return d.db.(txer).Begin()
+}
+
+// begin a transaction with the options, it's bound to ctx.
+func (d *dbQueryCtx) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.db.(txerCtx).BeginTx(ctx, opts)
+}
+
+func (d *dbQueryCtx) Commit() error {
+	return d.db.(txEnder).Commit()
+}
+
+func (d *dbQueryCtx) Rollback() error {
+	return d.db.(txEnder).Rollback()
+}
+
+func newDbQueryCtx(ctx context.Context, db dbQuerier) dbQuerier {
+	d := new(dbQueryCtx)
+	d.ctx = ctx
+	d.db = db
+	return d
+}
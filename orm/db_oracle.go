@@ -27,3 +27,8 @@ func newdbBaseOracle() dbBaser {
 	b.ins = b
 	return b
 }
+
+// oracle has no RELEASE SAVEPOINT.
+func (d *dbBaseOracle) SupportSavepoint() bool {
+	return false
+}
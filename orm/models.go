@@ -41,6 +41,8 @@ var (
 		"auto":         1,
 		"auto_now":     1,
 		"auto_now_add": 1,
+		"deleted_at":   1,
+		"version":      1,
 		"size":         2,
 		"column":       2,
 		"default":      2,
@@ -164,6 +164,13 @@ var _ Fielder = new(CharField)
 // Note that the current date is always used; it’s not just a default value that you can override.
 //
 // eg: `orm:"auto_now"` or `orm:"auto_now_add"`
+//
+// deleted_at:
+// Soft delete the model, Ormer.Delete and QuerySeter.Delete set the field to now instead of deleting the rows,
+// and the rows set are excluded from the queries. Ormer.ForceDelete and QuerySeter.ForceDelete really delete them.
+// The field must be null, a model has one deleted_at field only.
+//
+// eg: `orm:"null;deleted_at"`
 type DateField time.Time
 
 func (e DateField) Value() time.Time {
@@ -34,6 +34,8 @@ type fields struct {
 	fieldsReverse []*fieldInfo
 	fieldsDB      []*fieldInfo
 	rels          []*fieldInfo
+	deletedAt     *fieldInfo
+	version       *fieldInfo
 	orders        []string
 	dbcols        []string
 }
@@ -121,6 +123,8 @@ type fieldInfo struct {
 	size                int
 	auto_now            bool
 	auto_now_add        bool
+	deleted_at          bool
+	version             bool
 	rel                 bool
 	reverse             bool
 	reverseField        string
@@ -354,6 +358,13 @@ checkType:
 		} else if attrs["auto_now_add"] {
 			fi.auto_now_add = true
 		}
+		if attrs["deleted_at"] {
+			if fi.null == false {
+				err = fmt.Errorf("deleted_at field must be null")
+				goto end
+			}
+			fi.deleted_at = true
+		}
 	case TypeFloatField:
 	case TypeDecimalField:
 		d1 := digits
@@ -373,6 +384,11 @@ checkType:
 		}
 	}
 
+	if attrs["deleted_at"] && fi.deleted_at == false {
+		err = fmt.Errorf("non-date/datetime type cannot set deleted_at")
+		goto end
+	}
+
 	if fieldType&IsIntegerField == 0 {
 		if fi.auto {
 			err = fmt.Errorf("non-integer type cannot set auto")
@@ -397,6 +413,14 @@ checkType:
 		fi.unique = false
 	}
 
+	if attrs["version"] {
+		if fieldType&IsIntegerField == 0 || fi.pk || fi.null {
+			err = fmt.Errorf("version field must be a not null and non-pk integer")
+			goto end
+		}
+		fi.version = true
+	}
+
 	if fi.unique {
 		fi.index = false
 	}
@@ -85,6 +85,24 @@ func newModelInfo(val reflect.Value) (info *modelInfo) {
 			}
 		}
 
+		if fi.deleted_at {
+			if info.fields.deletedAt != nil {
+				err = errors.New(fmt.Sprintf("one model must have one deleted_at field only"))
+				break
+			} else {
+				info.fields.deletedAt = fi
+			}
+		}
+
+		if fi.version {
+			if info.fields.version != nil {
+				err = errors.New(fmt.Sprintf("one model must have one version field only"))
+				break
+			} else {
+				info.fields.version = fi
+			}
+		}
+
 		fi.fieldIndex = i
 		fi.mi = info
 		fi.inModel = true
@@ -331,6 +331,78 @@ func NewComment() *Comment {
 	return obj
 }
 
+// the model with the hooks, Slug is derived from Name.
+type Hook struct {
+	Id     int
+	Name   string   `orm:"size(30)"`
+	Slug   string   `orm:"size(30)"`
+	Events []string `orm:"-"`
+}
+
+func (h *Hook) BeforeInsert(o Ormer) error {
+	if h.Name == "" {
+		return fmt.Errorf("the name of the hook is empty")
+	}
+	h.Slug = strings.ToLower(h.Name)
+	h.Events = append(h.Events, "BeforeInsert")
+	return nil
+}
+
+func (h *Hook) AfterInsert(o Ormer) error {
+	h.Events = append(h.Events, "AfterInsert")
+	return nil
+}
+
+func (h *Hook) BeforeUpdate(o Ormer) error {
+	h.Slug = strings.ToLower(h.Name)
+	h.Events = append(h.Events, "BeforeUpdate")
+	return nil
+}
+
+func (h *Hook) AfterUpdate(o Ormer) error {
+	h.Events = append(h.Events, "AfterUpdate")
+	return nil
+}
+
+func (h *Hook) BeforeDelete(o Ormer) error {
+	if h.Name == "keep" {
+		return fmt.Errorf("the hook is kept")
+	}
+	h.Events = append(h.Events, "BeforeDelete")
+	return nil
+}
+
+func (h *Hook) AfterDelete(o Ormer) error {
+	h.Events = append(h.Events, fmt.Sprintf("AfterDelete %d", h.Id))
+	return nil
+}
+
+func (h *Hook) AfterRead(o Ormer) error {
+	h.Events = append(h.Events, "AfterRead")
+	return nil
+}
+
+// the soft deleted models, the tags of SoftPost.
+type SoftPost struct {
+	Id    int
+	Title string     `orm:"size(30)"`
+	Tags  []*SoftTag `orm:"rel(m2m)"`
+}
+
+type SoftTag struct {
+	Id        int
+	Name      string      `orm:"size(30)"`
+	Posts     []*SoftPost `orm:"reverse(many)"`
+	DeletedAt time.Time   `orm:"null;deleted_at"`
+}
+
+// the model with optimistic locking.
+type Ticket struct {
+	Id      int
+	Title   string `orm:"size(30)"`
+	Version int    `orm:"version"`
+}
+
 var DBARGS = struct {
 	Driver string
 	Source string
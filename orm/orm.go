@@ -51,12 +51,15 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"time"
+
+	"github.com/astaxie/beego/trace"
 )
 
 const (
@@ -67,6 +70,7 @@ var (
 	// DebugLevel       = Debug_Queries
 	Debug            = false
 	DebugLog         = NewLog(os.Stderr)
+	Metrics          = false // record the query time in beego/metrics
 	DefaultRowsLimit = 1000
 	DefaultRelsDepth = 2
 	DefaultTimeLoc   = time.Local
@@ -75,6 +79,7 @@ var (
 	ErrMultiRows     = errors.New("<QuerySeter> return multi rows")
 	ErrNoRows        = errors.New("<QuerySeter> no row found")
 	ErrStmtClosed    = errors.New("<QuerySeter> stmt already closed")
+	ErrStaleObject   = errors.New("<Ormer> the version of the row is changed, it's updated by others")
 	ErrArgs          = errors.New("<Ormer> args error may be empty")
 	ErrNotImplement  = errors.New("have not implement")
 )
@@ -85,7 +90,17 @@ type ParamsList []interface{}
 type orm struct {
 	alias *alias
 	db    dbQuerier
+	raw   dbQuerier // *sql.DB or *sql.Tx without log and context wrappers
+	ctx   context.Context
 	isTx  bool
+	txs   *txState // shared by the copies of WithContext
+	force bool     // read from the primary of the cluster alias
+}
+
+// the state of the transaction began by Begin or Transaction.
+type txState struct {
+	savepoints  int      // the number of the savepoints, used to name them
+	afterCommit []func() // the callbacks of AfterCommit
 }
 
 var _ Ormer = new(orm)
@@ -124,7 +139,7 @@ func (o *orm) Read(md interface{}, cols ...string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return callHook(hookAfterRead, md, o)
 }
 
 // Try to read a row from the database, or insert one if it doesn't exist
@@ -137,6 +152,9 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, i
 		id, err := o.Insert(md)
 		return (err == nil), id, err
 	}
+	if err == nil {
+		err = callHook(hookAfterRead, md, o)
+	}
 
 	return false, ind.Field(mi.fields.pk.fieldIndex).Int(), err
 }
@@ -145,6 +163,9 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, i
 func (o *orm) Insert(md interface{}) (int64, error) {
 	// 新增数据
 	mi, ind := o.getMiInd(md, true)
+	if err := callHook(hookBeforeInsert, md, o); err != nil {
+		return 0, err
+	}
 
 	id, err := o.alias.DbBaser.Insert(o.db, mi, ind, o.alias.TZ)
 
@@ -154,7 +175,7 @@ func (o *orm) Insert(md interface{}) (int64, error) {
 
 	o.setPk(mi, ind, id)
 
-	return id, nil
+	return id, callHook(hookAfterInsert, md, o)
 }
 
 // set auto pk field
@@ -187,6 +208,9 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 		for i := 0; i < sind.Len(); i++ {
 			ind := sind.Index(i)
 			mi, _ := o.getMiInd(ind.Interface(), false)
+			if err := callHookValue(hookBeforeInsert, ind, o); err != nil {
+				return cnt, err
+			}
 			id, err := o.alias.DbBaser.Insert(o.db, mi, ind, o.alias.TZ)
 			if err != nil {
 				return cnt, err
@@ -195,35 +219,98 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 			o.setPk(mi, ind, id)
 
 			cnt += 1
+			if err := callHookValue(hookAfterInsert, ind, o); err != nil {
+				return cnt, err
+			}
 		}
 	} else {
 		mi, _ := o.getMiInd(sind.Index(0).Interface(), false)
-		return o.alias.DbBaser.InsertMulti(o.db, mi, sind, bulk, o.alias.TZ)
+		if err := callHooks(hookBeforeInsert, mds, o); err != nil {
+			return cnt, err
+		}
+		num, err := o.alias.DbBaser.InsertMulti(o.db, mi, sind, bulk, o.alias.TZ)
+		if err != nil {
+			return num, err
+		}
+		return num, callHooks(hookAfterInsert, mds, o)
 	}
 	return cnt, nil
 }
 
 // update model to database.
 // cols set the columns those want to update.
+// the model with version field, `orm:"version"`, is updated if its version isn't changed in database,
+// else ErrStaleObject is returned. the version is increased after updating.
 func (o *orm) Update(md interface{}, cols ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	if err := callHook(hookBeforeUpdate, md, o); err != nil {
+		return 0, err
+	}
 	num, err := o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
 	if err != nil {
 		return num, err
 	}
-	return num, nil
+	return num, callHook(hookAfterUpdate, md, o)
 }
 
-// delete model in database
+// delete model in database.
+// the model with deleted_at field is soft deleted, its deleted_at field is set to now and its pk is kept.
 func (o *orm) Delete(md interface{}) (int64, error) {
+	return o.delete(md, false)
+}
+
+// delete model in database, the model with deleted_at field is really deleted.
+func (o *orm) ForceDelete(md interface{}) (int64, error) {
+	return o.delete(md, true)
+}
+
+func (o *orm) delete(md interface{}, force bool) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	if err := callHook(hookBeforeDelete, md, o); err != nil {
+		return 0, err
+	}
+	if fi := mi.fields.deletedAt; fi != nil && !force {
+		num, err := o.softDelete(mi, fi, ind)
+		if err != nil {
+			return num, err
+		}
+		return num, callHook(hookAfterDelete, md, o)
+	}
+	pk := ind.Field(mi.fields.pk.fieldIndex)
+	pkValue := reflect.New(pk.Type()).Elem()
+	pkValue.Set(pk)
 	num, err := o.alias.DbBaser.Delete(o.db, mi, ind, o.alias.TZ)
 	if err != nil {
 		return num, err
 	}
+	// the pk is still set in AfterDelete
+	pk.Set(pkValue)
+	err = callHook(hookAfterDelete, md, o)
 	if num > 0 {
 		o.setPk(mi, ind, 0)
 	}
+	return num, err
+}
+
+// set the deleted_at field of the row to now, if it isn't soft deleted yet.
+func (o *orm) softDelete(mi *modelInfo, fi *fieldInfo, ind reflect.Value) (int64, error) {
+	_, pkValue, ok := getExistPk(mi, ind)
+	if ok == false {
+		return 0, ErrMissPK
+	}
+	tnow := time.Now()
+	o.alias.DbBaser.TimeToDB(&tnow, o.alias.TZ)
+	qs := newQuerySet(o, mi).Filter(mi.fields.pk.name, pkValue)
+	num, err := qs.Update(Params{fi.column: tnow})
+	if err != nil || num == 0 {
+		return num, err
+	}
+	field := ind.Field(fi.fieldIndex)
+	if fi.isFielder {
+		field.Addr().Interface().(Fielder).SetRaw(tnow.In(DefaultTimeLoc))
+	} else {
+		field.Set(reflect.ValueOf(tnow.In(DefaultTimeLoc)))
+	}
 	return num, nil
 }
 
@@ -426,38 +513,106 @@ func (o *orm) Using(name string) error {
 	// 获取一个Alias信息
 	if al, ok := dataBaseCache.get(name); ok {
 		o.alias = al
-		if Debug {
-			o.db = newDbQueryLog(al, al.DB)
-		} else {
-			// 获取对应的DB(为Conn
-			o.db = al.DB
-		}
+		// 获取对应的DB(为Conn
+		o.setDB(al.DB)
 	} else {
 		return fmt.Errorf("<Ormer.Using> unknown db alias name `%s`", name)
 	}
 	return nil
 }
 
+// set the db querier, wrap it with the context and the query log if needed.
+func (o *orm) setDB(db dbQuerier) {
+	o.raw = db
+	o.db = o.wrapDB(o.alias, db)
+}
+
+func (o *orm) wrapDB(al *alias, db dbQuerier) dbQuerier {
+	if o.ctx != nil {
+		db = newDbQueryCtx(o.ctx, db)
+	}
+	if Debug || Metrics {
+		db = newDbQueryLog(al, trace.RequestId(o.ctx), db)
+	}
+	return db
+}
+
+// return the db querier of the reads,
+// it's a replica if the alias is a cluster, out of transaction and not forced to the primary.
+func (o *orm) readDB() dbQuerier {
+	if o.alias.cluster == nil || o.isTx || o.force {
+		return o.db
+	}
+	if al := o.alias.cluster.pick(); al != nil {
+		return o.wrapDB(al, al.DB)
+	}
+	return o.db
+}
+
+// return a copy of this Ormer reading from the primary of the cluster alias,
+// so the rows just written are read without the replication lag.
+// usage:
+//	o.Insert(&user)
+//	o.ForcePrimary().QueryTable("user").Filter("name", user.Name).One(&user)
+func (o *orm) ForcePrimary() Ormer {
+	n := new(orm)
+	*n = *o
+	n.force = true
+	return n
+}
+
+// return a copy of this Ormer bound to ctx.
+// all the queries of the copy and its QuerySeter/RawSeter use ctx,
+// they are canceled when ctx is done.
+// if a transaction has began, the copy shares it, end it only once.
+func (o *orm) WithContext(ctx context.Context) Ormer {
+	if ctx == nil {
+		panic(fmt.Errorf("<Ormer.WithContext> nil context"))
+	}
+	n := new(orm)
+	n.alias = o.alias
+	n.isTx = o.isTx
+	n.txs = o.txs
+	n.force = o.force
+	n.ctx = ctx
+	n.setDB(o.raw)
+	return n
+}
+
 // begin transaction
+// if the Ormer is bound to a context, the transaction is rolled back when the context is done.
 func (o *orm) Begin() error {
+	return o.begin(nil)
+}
+
+func (o *orm) begin(opts *sql.TxOptions) error {
 	if o.isTx {
 		return ErrTxHasBegan
 	}
 	var tx *sql.Tx
-	tx, err := o.db.(txer).Begin()
+	var err error
+	if opts == nil {
+		tx, err = o.db.(txer).Begin()
+	} else if db, ok := o.db.(txerCtx); ok {
+		ctx := o.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tx, err = db.BeginTx(ctx, opts)
+	} else {
+		return ErrNotImplement
+	}
 	if err != nil {
 		return err
 	}
 	o.isTx = true
-	if Debug {
-		o.db.(*dbQueryLog).SetDB(tx)
-	} else {
-		o.db = tx
-	}
+	o.txs = new(txState)
+	o.setDB(tx)
 	return nil
 }
 
 // commit transaction
+// the callbacks of AfterCommit are called after the commit succeeds.
 func (o *orm) Commit() error {
 	if o.isTx == false {
 		return ErrTxDone
@@ -466,6 +621,11 @@ func (o *orm) Commit() error {
 	if err == nil {
 		o.isTx = false
 		o.Using(o.alias.Name)
+		txs := o.txs
+		o.txs = nil
+		for _, fn := range txs.afterCommit {
+			fn()
+		}
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
 	}
@@ -473,6 +633,7 @@ func (o *orm) Commit() error {
 }
 
 // rollback transaction
+// the callbacks of AfterCommit are dropped.
 func (o *orm) Rollback() error {
 	if o.isTx == false {
 		return ErrTxDone
@@ -480,6 +641,7 @@ func (o *orm) Rollback() error {
 	err := o.db.(txEnder).Rollback()
 	if err == nil {
 		o.isTx = false
+		o.txs = nil
 		o.Using(o.alias.Name)
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
@@ -487,6 +649,96 @@ func (o *orm) Rollback() error {
 	return err
 }
 
+// run fn in a transaction, it's committed if fn returns nil,
+// or rolled back if fn returns an error or panics, the panic is passed on after the rollback.
+// the opts set the isolation level and the read-only of the transaction.
+// if a transaction has began, fn runs in a savepoint of it instead,
+// the savepoint is rolled back alone and the opts are ignored.
+// usage:
+//	err := o.Transaction(func(txOrm orm.Ormer) error {
+//		if _, err := txOrm.Insert(&order); err != nil {
+//			return err
+//		}
+//		txOrm.AfterCommit(func() { notify(order.Id) })
+//		_, err := txOrm.Update(&stock, "Count")
+//		return err
+//	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+func (o *orm) Transaction(fn func(txOrm Ormer) error, opts ...*sql.TxOptions) (err error) {
+	if o.isTx {
+		return o.savepoint(fn)
+	}
+
+	var opt *sql.TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	// the transaction is on a copy, so o can still be used outside of it
+	tx := new(orm)
+	tx.alias = o.alias
+	tx.ctx = o.ctx
+	tx.setDB(o.raw)
+	if err = tx.begin(opt); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// run fn in a savepoint of the transaction.
+func (o *orm) savepoint(fn func(txOrm Ormer) error) (err error) {
+	if !o.alias.DbBaser.SupportSavepoint() {
+		return ErrNotImplement
+	}
+	o.txs.savepoints++
+	name := fmt.Sprintf("beego_sp_%d", o.txs.savepoints)
+	if _, err = o.db.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+	hooks := len(o.txs.afterCommit)
+	rollback := func() error {
+		o.txs.afterCommit = o.txs.afterCommit[:hooks]
+		_, err := o.db.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(o); err != nil {
+		// the error of fn is kept for errors.Is with the failed rollback
+		if rerr := rollback(); rerr != nil {
+			return fmt.Errorf("%w, <Ormer.Transaction> rollback to savepoint %s: %v", err, name, rerr)
+		}
+		return err
+	}
+	_, err = o.db.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
+// register fn to be called after the transaction is committed,
+// it's dropped if the transaction or the savepoint registering it is rolled back.
+// fn is called at once if no transaction has began.
+func (o *orm) AfterCommit(fn func()) {
+	if !o.isTx {
+		fn()
+		return
+	}
+	o.txs.afterCommit = append(o.txs.afterCommit, fn)
+}
+
 // return a raw query seter for raw sql string.
 func (o *orm) Raw(query string, args ...interface{}) RawSeter {
 	return newRawSet(o, query, args)
@@ -526,12 +778,7 @@ func NewOrmWithDB(driverName, aliasName string, db *sql.DB) (Ormer, error) {
 
 	o := new(orm)
 	o.alias = al
-
-	if Debug {
-		o.db = newDbQueryLog(o.alias, db)
-	} else {
-		o.db = db
-	}
+	o.setDB(db)
 
 	return o, nil
 }
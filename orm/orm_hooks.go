@@ -0,0 +1,92 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"reflect"
+)
+
+// model hooks
+const (
+	hookBeforeInsert = iota
+	hookAfterInsert
+	hookBeforeUpdate
+	hookAfterUpdate
+	hookBeforeDelete
+	hookAfterDelete
+	hookAfterRead
+)
+
+// call the hook if the model implements it.
+func callHook(hook int, md interface{}, o Ormer) error {
+	switch hook {
+	case hookBeforeInsert:
+		if h, ok := md.(BeforeInserter); ok {
+			return h.BeforeInsert(o)
+		}
+	case hookAfterInsert:
+		if h, ok := md.(AfterInserter); ok {
+			return h.AfterInsert(o)
+		}
+	case hookBeforeUpdate:
+		if h, ok := md.(BeforeUpdater); ok {
+			return h.BeforeUpdate(o)
+		}
+	case hookAfterUpdate:
+		if h, ok := md.(AfterUpdater); ok {
+			return h.AfterUpdate(o)
+		}
+	case hookBeforeDelete:
+		if h, ok := md.(BeforeDeleter); ok {
+			return h.BeforeDelete(o)
+		}
+	case hookAfterDelete:
+		if h, ok := md.(AfterDeleter); ok {
+			return h.AfterDelete(o)
+		}
+	case hookAfterRead:
+		if h, ok := md.(AfterReader); ok {
+			return h.AfterRead(o)
+		}
+	}
+	return nil
+}
+
+// call the hook of the model value, the hooks with pointer receiver are called
+// on the address of the addressable struct.
+func callHookValue(hook int, val reflect.Value, o Ormer) error {
+	if val.Kind() != reflect.Ptr && val.CanAddr() {
+		val = val.Addr()
+	}
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return nil
+	}
+	return callHook(hook, val.Interface(), o)
+}
+
+// call the hook of the models in the slice or the model.
+func callHooks(hook int, container interface{}, o Ormer) error {
+	ind := reflect.Indirect(reflect.ValueOf(container))
+	switch ind.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < ind.Len(); i++ {
+			if err := callHookValue(hook, ind.Index(i), o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return callHook(hook, container, o)
+}
@@ -15,12 +15,15 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	"log"
 	"strings"
 	"time"
+
+	"github.com/astaxie/beego/metrics"
 )
 
 type Log struct {
@@ -34,14 +37,32 @@ func NewLog(out io.Writer) *Log {
 	return d
 }
 
-func debugLogQueies(alias *alias, operaton, query string, t time.Time, err error, args ...interface{}) {
+var queryDuration = metrics.NewHistogram("beego_orm_query_duration_seconds", "The time of the ORM queries.", nil, "alias", "operation", "result")
+
+// rid is the request id of the Ormer bound to a request context, it's logged to correlate the queries with the request.
+// the query time is recorded in the metrics if Metrics is true.
+func debugLogQueies(alias *alias, rid, operaton, query string, t time.Time, err error, args ...interface{}) {
+	if Metrics {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		queryDuration.Observe(time.Since(t).Seconds(), alias.Name, operaton, result)
+	}
+	if !Debug {
+		return
+	}
 	sub := time.Now().Sub(t) / 1e5
 	elsp := float64(int(sub)) / 10.0
 	flag := "  OK"
 	if err != nil {
 		flag = "FAIL"
 	}
-	con := fmt.Sprintf(" - %s - [Queries/%s] - [%s / %11s / %7.1fms] - [%s]", t.Format(format_DateTime), alias.Name, flag, operaton, elsp, query)
+	con := fmt.Sprintf(" - %s - [Queries/%s]", t.Format(format_DateTime), alias.Name)
+	if rid != "" {
+		con += " - [" + rid + "]"
+	}
+	con += fmt.Sprintf(" - [%s / %11s / %7.1fms] - [%s]", flag, operaton, elsp, query)
 	cons := make([]string, 0, len(args))
 	for _, arg := range args {
 		cons = append(cons, fmt.Sprintf("%v", arg))
@@ -59,6 +80,7 @@ func debugLogQueies(alias *alias, operaton, query string, t time.Time, err error
 // if dev mode, use stmtQueryLog, or use stmtQuerier.
 type stmtQueryLog struct {
 	alias *alias
+	rid   string
 	query string
 	stmt  stmtQuerier
 }
@@ -68,35 +90,36 @@ var _ stmtQuerier = new(stmtQueryLog)
 func (d *stmtQueryLog) Close() error {
 	a := time.Now()
 	err := d.stmt.Close()
-	debugLogQueies(d.alias, "st.Close", d.query, a, err)
+	debugLogQueies(d.alias, d.rid, "st.Close", d.query, a, err)
 	return err
 }
 
 func (d *stmtQueryLog) Exec(args ...interface{}) (sql.Result, error) {
 	a := time.Now()
 	res, err := d.stmt.Exec(args...)
-	debugLogQueies(d.alias, "st.Exec", d.query, a, err, args...)
+	debugLogQueies(d.alias, d.rid, "st.Exec", d.query, a, err, args...)
 	return res, err
 }
 
 func (d *stmtQueryLog) Query(args ...interface{}) (*sql.Rows, error) {
 	a := time.Now()
 	res, err := d.stmt.Query(args...)
-	debugLogQueies(d.alias, "st.Query", d.query, a, err, args...)
+	debugLogQueies(d.alias, d.rid, "st.Query", d.query, a, err, args...)
 	return res, err
 }
 
 func (d *stmtQueryLog) QueryRow(args ...interface{}) *sql.Row {
 	a := time.Now()
 	res := d.stmt.QueryRow(args...)
-	debugLogQueies(d.alias, "st.QueryRow", d.query, a, nil, args...)
+	debugLogQueies(d.alias, d.rid, "st.QueryRow", d.query, a, nil, args...)
 	return res
 }
 
-func newStmtQueryLog(alias *alias, stmt stmtQuerier, query string) stmtQuerier {
+func newStmtQueryLog(alias *alias, rid string, stmt stmtQuerier, query string) stmtQuerier {
 	d := new(stmtQueryLog)
 	d.stmt = stmt
 	d.alias = alias
+	d.rid = rid
 	d.query = query
 	return d
 }
@@ -105,6 +128,7 @@ func newStmtQueryLog(alias *alias, stmt stmtQuerier, query string) stmtQuerier {
 // if dev mode, use dbQueryLog, or use dbQuerier.
 type dbQueryLog struct {
 	alias *alias
+	rid   string
 	db    dbQuerier
 	tx    txer
 	txe   txEnder
@@ -112,54 +136,62 @@ type dbQueryLog struct {
 
 var _ dbQuerier = new(dbQueryLog)
 var _ txer = new(dbQueryLog)
+var _ txerCtx = new(dbQueryLog)
 var _ txEnder = new(dbQueryLog)
 
 func (d *dbQueryLog) Prepare(query string) (*sql.Stmt, error) {
 	a := time.Now()
 	stmt, err := d.db.Prepare(query)
-	debugLogQueies(d.alias, "db.Prepare", query, a, err)
+	debugLogQueies(d.alias, d.rid, "db.Prepare", query, a, err)
 	return stmt, err
 }
 
 func (d *dbQueryLog) Exec(query string, args ...interface{}) (sql.Result, error) {
 	a := time.Now()
 	res, err := d.db.Exec(query, args...)
-	debugLogQueies(d.alias, "db.Exec", query, a, err, args...)
+	debugLogQueies(d.alias, d.rid, "db.Exec", query, a, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	a := time.Now()
 	res, err := d.db.Query(query, args...)
-	debugLogQueies(d.alias, "db.Query", query, a, err, args...)
+	debugLogQueies(d.alias, d.rid, "db.Query", query, a, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) QueryRow(query string, args ...interface{}) *sql.Row {
 	a := time.Now()
 	res := d.db.QueryRow(query, args...)
-	debugLogQueies(d.alias, "db.QueryRow", query, a, nil, args...)
+	debugLogQueies(d.alias, d.rid, "db.QueryRow", query, a, nil, args...)
 	return res
 }
 
 func (d *dbQueryLog) Begin() (*sql.Tx, error) {
 	a := time.Now()
 	tx, err := d.db.(txer).Begin()
-	debugLogQueies(d.alias, "db.Begin", "START TRANSACTION", a, err)
+	debugLogQueies(d.alias, d.rid, "db.Begin", "START TRANSACTION", a, err)
+	return tx, err
+}
+
+func (d *dbQueryLog) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	a := time.Now()
+	tx, err := d.db.(txerCtx).BeginTx(ctx, opts)
+	debugLogQueies(d.alias, d.rid, "db.BeginTx", "START TRANSACTION", a, err)
 	return tx, err
 }
 
 func (d *dbQueryLog) Commit() error {
 	a := time.Now()
 	err := d.db.(txEnder).Commit()
-	debugLogQueies(d.alias, "tx.Commit", "COMMIT", a, err)
+	debugLogQueies(d.alias, d.rid, "tx.Commit", "COMMIT", a, err)
 	return err
 }
 
 func (d *dbQueryLog) Rollback() error {
 	a := time.Now()
 	err := d.db.(txEnder).Rollback()
-	debugLogQueies(d.alias, "tx.Rollback", "ROLLBACK", a, err)
+	debugLogQueies(d.alias, d.rid, "tx.Rollback", "ROLLBACK", a, err)
 	return err
 }
 
@@ -167,9 +199,10 @@ func (d *dbQueryLog) SetDB(db dbQuerier) {
 	d.db = db
 }
 
-func newDbQueryLog(alias *alias, db dbQuerier) dbQuerier {
+func newDbQueryLog(alias *alias, rid string, db dbQuerier) dbQuerier {
 	d := new(dbQueryLog)
 	d.alias = alias
+	d.rid = rid
 	d.db = db
 	return d
 }
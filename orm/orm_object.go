@@ -17,6 +17,8 @@ package orm
 import (
 	"fmt"
 	"reflect"
+
+	"github.com/astaxie/beego/trace"
 )
 
 // an insert queryer struct
@@ -44,6 +46,9 @@ func (o *insertSet) Insert(md interface{}) (int64, error) {
 	if name != o.mi.fullName {
 		panic(fmt.Errorf("<Inserter.Insert> need model `%s` but found `%s`", o.mi.fullName, name))
 	}
+	if err := callHook(hookBeforeInsert, md, o.orm); err != nil {
+		return 0, err
+	}
 	id, err := o.orm.alias.DbBaser.InsertStmt(o.stmt, o.mi, ind, o.orm.alias.TZ)
 	if err != nil {
 		return id, err
@@ -57,7 +62,7 @@ func (o *insertSet) Insert(md interface{}) (int64, error) {
 			}
 		}
 	}
-	return id, nil
+	return id, callHook(hookAfterInsert, md, o.orm)
 }
 
 // close insert queryer statement
@@ -78,8 +83,8 @@ func newInsertSet(orm *orm, mi *modelInfo) (Inserter, error) {
 	if err != nil {
 		return nil, err
 	}
-	if Debug {
-		bi.stmt = newStmtQueryLog(orm.alias, st, query)
+	if Debug || Metrics {
+		bi.stmt = newStmtQueryLog(orm.alias, trace.RequestId(orm.ctx), st, query)
 	} else {
 		bi.stmt = st
 	}
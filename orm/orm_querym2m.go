@@ -104,7 +104,7 @@ func (o *queryM2M) Remove(mds ...interface{}) (int64, error) {
 // check model is existed in relationship of origin model
 func (o *queryM2M) Exist(md interface{}) bool {
 	fi := o.fi
-	return o.qs.Filter(fi.reverseFieldInfo.name, o.md).
+	return o.related().Filter(fi.reverseFieldInfo.name, o.md).
 		Filter(fi.reverseFieldInfoTwo.name, md).Exist()
 }
 
@@ -117,7 +117,16 @@ func (o *queryM2M) Clear() (int64, error) {
 // count all related models of origin model
 func (o *queryM2M) Count() (int64, error) {
 	fi := o.fi
-	return o.qs.Filter(fi.reverseFieldInfo.name, o.md).Count()
+	return o.related().Filter(fi.reverseFieldInfo.name, o.md).Count()
+}
+
+// the soft deleted related models are excluded.
+func (o *queryM2M) related() QuerySeter {
+	fi := o.fi
+	if dfi := fi.relModelInfo.fields.deletedAt; dfi != nil {
+		return o.qs.Filter(fi.reverseFieldInfoTwo.name+ExprSep+dfi.name+ExprSep+"isnull", true)
+	}
+	return o.qs
 }
 
 var _ QueryM2Mer = new(queryM2M)
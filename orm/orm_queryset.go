@@ -15,7 +15,9 @@
 package orm
 
 import (
+	"context"
 	"fmt"
+	"time"
 )
 
 type colValue struct {
@@ -52,6 +54,15 @@ func ColValue(opt operator, value interface{}) interface{} {
 	return val
 }
 
+// the soft deleted rows in the queries of a model with deleted_at field
+type deletedScope int
+
+const (
+	excludeDeleted deletedScope = iota
+	withDeleted
+	onlyDeleted
+)
+
 // real query struct
 type querySet struct {
 	mi       *modelInfo
@@ -61,6 +72,8 @@ type querySet struct {
 	limit    int64
 	offset   int64
 	orders   []string
+	deleted  deletedScope
+	version  interface{}
 	orm      *orm
 }
 
@@ -138,25 +151,110 @@ func (o querySet) SetCond(cond *Condition) QuerySeter {
 	return &o
 }
 
+// query the soft deleted rows too.
+func (o querySet) WithDeleted() QuerySeter {
+	o.deleted = withDeleted
+	return &o
+}
+
+// query the soft deleted rows only.
+// e.g. qs.OnlyDeleted().Filter("deleted_at__lt", time.Now().AddDate(0, -1, 0)).ForceDelete()
+func (o querySet) OnlyDeleted() QuerySeter {
+	o.deleted = onlyDeleted
+	return &o
+}
+
+// update the rows of the version only, with the version increased.
+// Update returns ErrStaleObject if no row is updated.
+// e.g. qs.Filter("id", order.Id).WithVersion(order.Version).Update(orm.Params{"status": "paid"})
+func (o querySet) WithVersion(version interface{}) QuerySeter {
+	if o.mi.fields.version == nil {
+		panic(fmt.Errorf("<QuerySeter.WithVersion> model `%s` has no version field", o.mi.fullName))
+	}
+	o.version = version
+	return &o
+}
+
+// get the condition with the soft deleted rows excluded, or only them.
+func (o *querySet) getCond() *Condition {
+	fi := o.mi.fields.deletedAt
+	if fi == nil || o.deleted == withDeleted {
+		return o.cond
+	}
+	// the condition is in parentheses, so its OR doesn't bypass the filter
+	cond := NewCondition()
+	if o.cond != nil && !o.cond.IsEmpty() {
+		cond = cond.AndCond(o.cond)
+	}
+	return cond.And(fi.name+ExprSep+"isnull", o.deleted == excludeDeleted)
+}
+
+// bind the queries of this QuerySeter to ctx.
+// they are canceled when ctx is done.
+func (o querySet) WithContext(ctx context.Context) QuerySeter {
+	o.orm = o.orm.WithContext(ctx).(*orm)
+	return &o
+}
+
 // return QuerySeter execution result number
 func (o *querySet) Count() (int64, error) {
-	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.Count(o.orm.readDB(), o, o.mi, o.getCond(), o.orm.alias.TZ)
 }
 
 // check result empty or not after QuerySeter executed
 func (o *querySet) Exist() bool {
-	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.readDB(), o, o.mi, o.getCond(), o.orm.alias.TZ)
 	return cnt > 0
 }
 
 // execute update with parameters
 func (o *querySet) Update(values Params) (int64, error) {
-	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.cond, values, o.orm.alias.TZ)
+	if o.version == nil {
+		return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.getCond(), values, o.orm.alias.TZ)
+	}
+	fi := o.mi.fields.version
+	qs := o.Filter(fi.name, o.version).(*querySet)
+	// the version is increased by UpdateBatch
+	params := make(Params, len(values))
+	for k, v := range values {
+		if f, ok := o.mi.fields.GetByAny(k); ok && f == fi {
+			continue
+		}
+		params[k] = v
+	}
+	num, err := o.orm.alias.DbBaser.UpdateBatch(o.orm.db, qs, o.mi, qs.getCond(), params, o.orm.alias.TZ)
+	if err == nil && num == 0 {
+		return 0, ErrStaleObject
+	}
+	return num, err
 }
 
-// execute delete
+// execute delete.
+// the rows of a model with deleted_at field are soft deleted.
 func (o *querySet) Delete() (int64, error) {
-	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	fi := o.mi.fields.deletedAt
+	if fi == nil {
+		return o.ForceDelete()
+	}
+	if o.cond == nil || o.cond.IsEmpty() {
+		panic(fmt.Errorf("delete operation cannot execute without condition"))
+	}
+	tnow := time.Now()
+	o.orm.alias.DbBaser.TimeToDB(&tnow, o.orm.alias.TZ)
+	return o.Update(Params{fi.column: tnow})
+}
+
+// execute delete, the rows of a model with deleted_at field are really deleted,
+// the soft deleted rows are included, or only them with OnlyDeleted.
+func (o *querySet) ForceDelete() (int64, error) {
+	if o.cond == nil || o.cond.IsEmpty() {
+		panic(fmt.Errorf("delete operation cannot execute without condition"))
+	}
+	cond := o.cond
+	if o.deleted == onlyDeleted {
+		cond = o.getCond()
+	}
+	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, cond, o.orm.alias.TZ)
 }
 
 // return a insert queryer.
@@ -171,13 +269,17 @@ func (o *querySet) PrepareInsert() (Inserter, error) {
 // query all data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) All(container interface{}, cols ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.readDB(), o, o.mi, o.getCond(), container, o.orm.alias.TZ, cols)
+	if err != nil {
+		return num, err
+	}
+	return num, callHooks(hookAfterRead, container, o.orm)
 }
 
 // query one row data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) One(container interface{}, cols ...string) error {
-	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.readDB(), o, o.mi, o.getCond(), container, o.orm.alias.TZ, cols)
 	if err != nil {
 		return err
 	}
@@ -187,26 +289,26 @@ func (o *querySet) One(container interface{}, cols ...string) error {
 	if num == 0 {
 		return ErrNoRows
 	}
-	return nil
+	return callHooks(hookAfterRead, container, o.orm)
 }
 
 // query all data and map to []map[string]interface.
 // expres means condition expression.
 // it converts data to []map[column]value.
 func (o *querySet) Values(results *[]Params, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.readDB(), o, o.mi, o.getCond(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to [][]interface
 // it converts data to [][column_index]value
 func (o *querySet) ValuesList(results *[]ParamsList, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.readDB(), o, o.mi, o.getCond(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to []interface.
 // it's designed for one row record set, auto change to []value, not [][column]value.
 func (o *querySet) ValuesFlat(result *ParamsList, expr string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.readDB(), o, o.mi, o.getCond(), []string{expr}, result, o.orm.alias.TZ)
 }
 
 // query all rows into map[string]interface with specify key and value column name.
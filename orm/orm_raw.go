@@ -15,10 +15,13 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
 	"time"
+
+	"github.com/astaxie/beego/trace"
 )
 
 // raw sql string prepared statement
@@ -51,8 +54,8 @@ func newRawPreparer(rs *rawSet) (RawPreparer, error) {
 	if err != nil {
 		return nil, err
 	}
-	if Debug {
-		o.stmt = newStmtQueryLog(rs.orm.alias, st, query)
+	if Debug || Metrics {
+		o.stmt = newStmtQueryLog(rs.orm.alias, trace.RequestId(rs.orm.ctx), st, query)
 	} else {
 		o.stmt = st
 	}
@@ -74,6 +77,13 @@ func (o rawSet) SetArgs(args ...interface{}) RawSeter {
 	return &o
 }
 
+// bind the raw queries to ctx.
+// they are canceled when ctx is done.
+func (o rawSet) WithContext(ctx context.Context) RawSeter {
+	o.orm = o.orm.WithContext(ctx).(*orm)
+	return &o
+}
+
 // execute raw sql and return sql.Result
 func (o *rawSet) Exec() (sql.Result, error) {
 	query := o.query
@@ -83,6 +93,15 @@ func (o *rawSet) Exec() (sql.Result, error) {
 	return o.orm.db.Exec(query, args...)
 }
 
+// return the db querier of the query,
+// the SELECTs are sent to a replica if the alias is a cluster.
+func (o *rawSet) queryDB() dbQuerier {
+	if isReadQuery(o.query) {
+		return o.orm.readDB()
+	}
+	return o.orm.db
+}
+
 // set field value to row container
 func (o *rawSet) setFieldValue(ind reflect.Value, value interface{}) {
 	switch ind.Kind() {
@@ -298,7 +317,7 @@ func (o *rawSet) QueryRow(containers ...interface{}) error {
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	rows, err := o.orm.db.Query(query, args...)
+	rows, err := o.queryDB().Query(query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNoRows
@@ -427,7 +446,7 @@ func (o *rawSet) QueryRows(containers ...interface{}) (int64, error) {
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	rows, err := o.orm.db.Query(query, args...)
+	rows, err := o.queryDB().Query(query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -557,7 +576,7 @@ func (o *rawSet) readValues(container interface{}, needCols []string) (int64, er
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
 
 	var rs *sql.Rows
-	if r, err := o.orm.db.Query(query, args...); err != nil {
+	if r, err := o.queryDB().Query(query, args...); err != nil {
 		return 0, err
 	} else {
 		rs = r
@@ -685,7 +704,7 @@ func (o *rawSet) queryRowsTo(container interface{}, keyCol, valueCol string) (in
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
 
 	var rs *sql.Rows
-	if r, err := o.orm.db.Query(query, args...); err != nil {
+	if r, err := o.queryDB().Query(query, args...); err != nil {
 		return 0, err
 	} else {
 		rs = r
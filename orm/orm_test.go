@@ -16,9 +16,12 @@ package orm
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -26,6 +29,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/astaxie/beego/trace"
 )
 
 var _ = os.PathSeparator
@@ -171,6 +176,9 @@ func TestSyncDb(t *testing.T) {
 	RegisterModel(new(Comment))
 	RegisterModel(new(UserBig))
 	RegisterModel(new(PostTags))
+	RegisterModel(new(Hook))
+	RegisterModel(new(SoftPost), new(SoftTag))
+	RegisterModel(new(Ticket))
 
 	err := RunSyncdb("default", true, false)
 	throwFail(t, err)
@@ -187,6 +195,9 @@ func TestRegisterModels(t *testing.T) {
 	RegisterModel(new(Comment))
 	RegisterModel(new(UserBig))
 	RegisterModel(new(PostTags))
+	RegisterModel(new(Hook))
+	RegisterModel(new(SoftPost), new(SoftTag))
+	RegisterModel(new(Ticket))
 
 	BootStrap()
 
@@ -1819,6 +1830,474 @@ func TestTransaction(t *testing.T) {
 
 }
 
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	o := dORM.WithContext(ctx)
+
+	num, err := o.QueryTable("user").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num > 0, true))
+
+	cancel()
+
+	_, err = o.QueryTable("user").Count()
+	throwFail(t, AssertIs(err == context.Canceled, true))
+
+	u := &User{Id: 2}
+	err = o.Read(u)
+	throwFail(t, AssertIs(err == context.Canceled, true))
+
+	_, err = dORM.QueryTable("user").WithContext(ctx).Count()
+	throwFail(t, AssertIs(err == context.Canceled, true))
+
+	_, err = dORM.Raw("SELECT COUNT(*) FROM tag").WithContext(ctx).Exec()
+	throwFail(t, AssertIs(err == context.Canceled, true))
+
+	err = o.Begin()
+	throwFail(t, AssertIs(err == context.Canceled, true))
+
+	// the origin Ormer is not bound to the context
+	num, err = dORM.QueryTable("user").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num > 0, true))
+}
+
+func TestTransactionFunc(t *testing.T) {
+	o := NewOrm()
+	var committed []string
+
+	err := o.Transaction(func(txOrm Ormer) error {
+		_, err := txOrm.Insert(&Tag{Name: "tx_commit"})
+		throwFail(t, err)
+		txOrm.AfterCommit(func() { committed = append(committed, "outer") })
+		throwFail(t, AssertIs(len(committed), 0))
+
+		// the failed savepoint is rolled back alone
+		err = txOrm.Transaction(func(txOrm Ormer) error {
+			_, err := txOrm.Insert(&Tag{Name: "tx_savepoint"})
+			throwFail(t, err)
+			txOrm.AfterCommit(func() { committed = append(committed, "savepoint") })
+			return errors.New("savepoint failed")
+		})
+		throwFail(t, AssertIs(err.Error(), "savepoint failed"))
+
+		return txOrm.Transaction(func(txOrm Ormer) error {
+			_, err := txOrm.Insert(&Tag{Name: "tx_nested"})
+			txOrm.AfterCommit(func() { committed = append(committed, "nested") })
+			return err
+		})
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(committed, ","), "outer,nested"))
+
+	num, err := o.QueryTable("tag").Filter("name__in", "tx_commit", "tx_nested").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = o.QueryTable("tag").Filter("name", "tx_savepoint").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	// the failed rollback of the savepoint is returned with the error of fn
+	errSavepoint := errors.New("savepoint failed")
+	err = o.Transaction(func(txOrm Ormer) error {
+		err := txOrm.Transaction(func(txOrm Ormer) error {
+			_, err := txOrm.Raw("RELEASE SAVEPOINT beego_sp_1").Exec()
+			throwFail(t, err)
+			return errSavepoint
+		})
+		throwFail(t, AssertIs(errors.Is(err, errSavepoint), true))
+		throwFail(t, AssertIs(strings.Contains(err.Error(), "rollback to savepoint beego_sp_1"), true))
+		return nil
+	})
+	throwFail(t, err)
+
+	// rolled back on error
+	committed = nil
+	err = o.Transaction(func(txOrm Ormer) error {
+		_, err := txOrm.Insert(&Tag{Name: "tx_rollback"})
+		throwFail(t, err)
+		txOrm.AfterCommit(func() { committed = append(committed, "rollback") })
+		return errors.New("failed")
+	})
+	throwFail(t, AssertIs(err.Error(), "failed"))
+	throwFail(t, AssertIs(len(committed), 0))
+
+	// rolled back on panic, and the panic is passed on
+	func() {
+		defer func() {
+			throwFail(t, AssertIs(recover(), "tx panic"))
+		}()
+		o.Transaction(func(txOrm Ormer) error {
+			txOrm.Insert(&Tag{Name: "tx_rollback"})
+			panic("tx panic")
+		})
+	}()
+	num, err = o.QueryTable("tag").Filter("name", "tx_rollback").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	// o isn't in the transaction, its callbacks are called at once
+	o.AfterCommit(func() { committed = append(committed, "no tx") })
+	throwFail(t, AssertIs(strings.Join(committed, ","), "no tx"))
+
+	num, err = o.QueryTable("tag").Filter("name__in", "tx_commit", "tx_nested").Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+}
+
+func TestCluster(t *testing.T) {
+	if !IsSqlite {
+		return
+	}
+	replicas := []string{"replica_a", "replica_b"}
+	for _, name := range replicas {
+		throwFail(t, RegisterDataBase(name, "sqlite3", "file:"+name+"?mode=memory&cache=shared", 1, 1))
+		db, err := GetDB(name)
+		throwFail(t, err)
+		_, err = db.Exec("CREATE TABLE tag (id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name varchar(30) NOT NULL DEFAULT '', best_post_id integer)")
+		throwFail(t, err)
+		_, err = db.Exec("INSERT INTO tag (name) VALUES (?)", name)
+		throwFail(t, err)
+	}
+	throwFail(t, RegisterCluster("cluster", "default", replicas...))
+	throwFail(t, SetClusterHealthCheck("cluster", 0))
+	throwFail(t, SetReplicaWeight("cluster", "replica_b", 2))
+	throwFail(t, AssertIs(RegisterCluster("cluster", "default") != nil, true))
+
+	o := NewOrm()
+	throwFail(t, o.Using("cluster"))
+	read := func(o Ormer) string {
+		var names ParamsList
+		_, err := o.QueryTable("tag").Filter("name__in", replicas).ValuesFlat(&names, "name")
+		throwFail(t, err)
+		if len(names) == 0 {
+			return "default"
+		}
+		return names[0].(string)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		counts[read(o)]++
+	}
+	throwFail(t, AssertIs(counts["replica_a"], 2))
+	throwFail(t, AssertIs(counts["replica_b"], 4))
+
+	var name string
+	throwFail(t, o.Raw("SELECT name FROM tag WHERE name IN (?, ?)", replicas).QueryRow(&name))
+	throwFail(t, AssertIs(name == "replica_a" || name == "replica_b", true))
+
+	// the writes, the transactions and ForcePrimary use the primary
+	_, err := o.Insert(&Tag{Name: "cluster_write"})
+	throwFail(t, err)
+	num, err := o.QueryTable("tag").Filter("name", "cluster_write").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+	num, err = o.ForcePrimary().QueryTable("tag").Filter("name", "cluster_write").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	err = o.Transaction(func(txOrm Ormer) error {
+		throwFail(t, AssertIs(read(txOrm), "default"))
+		return nil
+	})
+	throwFail(t, err)
+	_, err = o.Raw("DELETE FROM tag WHERE name = ?", "cluster_write").Exec()
+	throwFail(t, err)
+
+	// the replicas failing the ping are ejected
+	c, err := getCluster("cluster")
+	throwFail(t, err)
+	dbA, _ := GetDB("replica_a")
+	dbA.Close()
+	c.checkHealth(time.Second)
+	throwFail(t, AssertIs(read(o), "replica_b"))
+	throwFail(t, AssertIs(read(o), "replica_b"))
+	dbB, _ := GetDB("replica_b")
+	dbB.Close()
+	c.checkHealth(time.Second)
+	throwFail(t, AssertIs(read(o), "default"))
+}
+
+func TestHooks(t *testing.T) {
+	o := NewOrm()
+
+	h := &Hook{Name: "Hello"}
+	id, err := o.Insert(h)
+	throwFail(t, err)
+	throwFail(t, AssertIs(id > 0, true))
+	throwFail(t, AssertIs(h.Slug, "hello"))
+	throwFail(t, AssertIs(strings.Join(h.Events, ","), "BeforeInsert,AfterInsert"))
+
+	// the error of the Before hook aborts the operation
+	_, err = o.Insert(&Hook{})
+	throwFail(t, AssertIs(err.Error(), "the name of the hook is empty"))
+	num, err := o.QueryTable("hook").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	h.Events = nil
+	h.Name = "World"
+	_, err = o.Update(h)
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(h.Events, ","), "BeforeUpdate,AfterUpdate"))
+
+	r := &Hook{Id: h.Id}
+	throwFail(t, o.Read(r))
+	throwFail(t, AssertIs(r.Slug, "world"))
+	throwFail(t, AssertIs(strings.Join(r.Events, ","), "AfterRead"))
+
+	hooks := []Hook{{Name: "A"}, {Name: "B"}}
+	num, err = o.InsertMulti(2, hooks)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	throwFail(t, AssertIs(hooks[1].Slug, "b"))
+	throwFail(t, AssertIs(strings.Join(hooks[1].Events, ","), "BeforeInsert,AfterInsert"))
+
+	i, err := o.QueryTable("hook").PrepareInsert()
+	throwFail(t, err)
+	k := &Hook{Name: "keep"}
+	_, err = i.Insert(k)
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(k.Events, ","), "BeforeInsert,AfterInsert"))
+	_, err = i.Insert(&Hook{})
+	throwFail(t, AssertIs(err != nil, true))
+	i.Close()
+
+	var all []*Hook
+	num, err = o.QueryTable("hook").OrderBy("id").All(&all)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 4))
+	throwFail(t, AssertIs(strings.Join(all[3].Events, ","), "AfterRead"))
+	one := Hook{}
+	throwFail(t, o.QueryTable("hook").Filter("slug", "a").One(&one))
+	throwFail(t, AssertIs(strings.Join(one.Events, ","), "AfterRead"))
+
+	_, err = o.Delete(k)
+	throwFail(t, AssertIs(err.Error(), "the hook is kept"))
+	h.Events = nil
+	hid := h.Id
+	num, err = o.Delete(h)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(strings.Join(h.Events, ","), fmt.Sprintf("BeforeDelete,AfterDelete %d", hid)))
+	throwFail(t, AssertIs(h.Id, 0))
+
+	num, err = o.QueryTable("hook").Filter("id__gt", 0).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+}
+
+func TestSoftDelete(t *testing.T) {
+	o := NewOrm()
+
+	post := &SoftPost{Title: "soft"}
+	_, err := o.Insert(post)
+	throwFail(t, err)
+	tags := []*SoftTag{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	for _, tag := range tags {
+		_, err = o.Insert(tag)
+		throwFail(t, err)
+	}
+	num, err := o.QueryM2M(post, "Tags").Add(tags)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+
+	// Delete is an update
+	num, err = o.Delete(tags[0])
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(tags[0].DeletedAt.IsZero(), false))
+	throwFail(t, AssertIs(tags[0].Id > 0, true))
+	num, err = o.Delete(tags[0])
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	err = o.Read(&SoftTag{Id: tags[0].Id})
+	throwFail(t, AssertIs(err, ErrNoRows))
+	throwFail(t, o.Read(&SoftTag{Id: tags[1].Id}))
+
+	qs := o.QueryTable("soft_tag")
+	num, err = qs.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = qs.WithDeleted().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+	var deleted []*SoftTag
+	num, err = qs.OnlyDeleted().All(&deleted)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(deleted[0].Name, "a"))
+
+	num, err = o.LoadRelated(post, "Tags")
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = o.QueryM2M(post, "Tags").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	throwFail(t, AssertIs(o.QueryM2M(post, "Tags").Exist(tags[0]), false))
+	throwFail(t, AssertIs(o.QueryM2M(post, "Tags").Exist(tags[1]), true))
+
+	num, err = qs.Filter("name", "b").Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	// ForceDelete really deletes the rows
+	num, err = qs.OnlyDeleted().Filter("id__gt", 0).ForceDelete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = o.ForceDelete(tags[2])
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.WithDeleted().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	// the OR of the condition doesn't bypass the soft deleted filter
+	tags = []*SoftTag{{Name: "x"}, {Name: "y"}, {Name: "z"}}
+	for _, tag := range tags {
+		_, err = o.Insert(tag)
+		throwFail(t, err)
+	}
+	_, err = o.Delete(tags[0])
+	throwFail(t, err)
+
+	cond := NewCondition().And("name", "x").Or("name", "y")
+	var found []*SoftTag
+	num, err = qs.SetCond(cond).All(&found)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(found[0].Name, "y"))
+	num, err = qs.SetCond(cond).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	deletedAt := tags[0].DeletedAt
+	num, err = qs.SetCond(cond).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	x := &SoftTag{}
+	throwFail(t, qs.WithDeleted().Filter("name", "x").One(x))
+	throwFail(t, AssertIs(x.DeletedAt.Unix(), deletedAt.Unix()))
+
+	num, err = qs.OnlyDeleted().SetCond(NewCondition().And("name", "x").Or("name", "z")).ForceDelete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.WithDeleted().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+
+	// ForceDelete needs a condition and deletes the soft deleted rows too
+	func() {
+		defer func() {
+			err := recover()
+			throwFail(t, AssertIs(fmt.Sprint(err), "delete operation cannot execute without condition"))
+		}()
+		qs.ForceDelete()
+	}()
+	func() {
+		defer func() {
+			throwFail(t, AssertIs(recover() != nil, true))
+		}()
+		qs.OnlyDeleted().ForceDelete()
+	}()
+	num, err = qs.WithDeleted().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	_, err = o.Delete(tags[1])
+	throwFail(t, err)
+	num, err = qs.Filter("name__in", "y", "z").ForceDelete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = qs.WithDeleted().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+}
+
+func TestVersion(t *testing.T) {
+	o := NewOrm()
+
+	ticket := &Ticket{Title: "one"}
+	_, err := o.Insert(ticket)
+	throwFail(t, err)
+
+	t1 := &Ticket{Id: ticket.Id}
+	throwFail(t, o.Read(t1))
+	t2 := &Ticket{Id: ticket.Id}
+	throwFail(t, o.Read(t2))
+
+	t1.Title = "two"
+	num, err := o.Update(t1)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(t1.Version, 1))
+
+	// t2 is stale
+	t2.Title = "three"
+	num, err = o.Update(t2, "Title")
+	throwFail(t, AssertIs(err, ErrStaleObject))
+	throwFail(t, AssertIs(num, 0))
+	throwFail(t, AssertIs(t2.Version, 0))
+
+	throwFail(t, o.Read(t2))
+	throwFail(t, AssertIs(t2.Title, "two"))
+	throwFail(t, AssertIs(t2.Version, 1))
+	t2.Title = "three"
+	_, err = o.Update(t2, "Title")
+	throwFail(t, err)
+	throwFail(t, AssertIs(t2.Version, 2))
+
+	// QuerySeter.Update opts in with WithVersion
+	qs := o.QueryTable("ticket").Filter("id", ticket.Id)
+	num, err = qs.WithVersion(1).Update(Params{"title": "four"})
+	throwFail(t, AssertIs(err, ErrStaleObject))
+	throwFail(t, AssertIs(num, 0))
+	num, err = qs.WithVersion(2).Update(Params{"title": "four"})
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	// the Update without WithVersion increases the version too
+	stale := &Ticket{Id: ticket.Id}
+	throwFail(t, o.Read(stale))
+	throwFail(t, AssertIs(stale.Version, 3))
+	num, err = qs.Update(Params{"title": "five"})
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	throwFail(t, o.Read(t2))
+	throwFail(t, AssertIs(t2.Title, "five"))
+	throwFail(t, AssertIs(t2.Version, 4))
+	stale.Title = "six"
+	num, err = o.Update(stale, "Title")
+	throwFail(t, AssertIs(err, ErrStaleObject))
+	throwFail(t, AssertIs(num, 0))
+}
+
+func TestDebugLogRequestId(t *testing.T) {
+	var buf bytes.Buffer
+	oldDebug, oldLog := Debug, DebugLog
+	Debug, DebugLog = true, NewLog(&buf)
+	defer func() {
+		Debug, DebugLog = oldDebug, oldLog
+	}()
+
+	span := trace.FromHeader(http.Header{"X-Request-Id": {"req-42"}})
+	o := NewOrm().WithContext(trace.NewContext(context.Background(), span))
+	_, err := o.QueryTable("user").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Contains(buf.String(), "[Queries/default] - [req-42] - [  OK"), true))
+
+	buf.Reset()
+	_, err = NewOrm().QueryTable("user").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Contains(buf.String(), "[Queries/default] - [  OK"), true))
+}
+
 func TestReadOrCreate(t *testing.T) {
 	u := &User{
 		UserName: "Kyle",
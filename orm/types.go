@@ -15,6 +15,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
 	"time"
@@ -42,6 +43,7 @@ type Ormer interface {
 	InsertMulti(int, interface{}) (int64, error)
 	Update(interface{}, ...string) (int64, error)
 	Delete(interface{}) (int64, error)
+	ForceDelete(interface{}) (int64, error)
 	LoadRelated(interface{}, string, ...interface{}) (int64, error)
 	QueryM2M(interface{}, string) QueryM2Mer
 	QueryTable(interface{}) QuerySeter
@@ -49,8 +51,46 @@ type Ormer interface {
 	Begin() error
 	Commit() error
 	Rollback() error
+	Transaction(func(Ormer) error, ...*sql.TxOptions) error
+	AfterCommit(func())
 	Raw(string, ...interface{}) RawSeter
 	Driver() Driver
+	WithContext(context.Context) Ormer
+	ForcePrimary() Ormer
+}
+
+// the optional hooks of the models.
+// they're called by Ormer and Inserter with the Ormer running the query, so the hooks
+// in a transaction run in it. an error of the Before hooks aborts the operation,
+// an error of the After hooks is returned after the operation is done.
+// the batch operations of QuerySeter.Update and QuerySeter.Delete don't call the hooks.
+type BeforeInserter interface {
+	BeforeInsert(Ormer) error
+}
+
+type AfterInserter interface {
+	AfterInsert(Ormer) error
+}
+
+type BeforeUpdater interface {
+	BeforeUpdate(Ormer) error
+}
+
+type AfterUpdater interface {
+	AfterUpdate(Ormer) error
+}
+
+type BeforeDeleter interface {
+	BeforeDelete(Ormer) error
+}
+
+type AfterDeleter interface {
+	AfterDelete(Ormer) error
+}
+
+// AfterRead is called by Ormer.Read, Ormer.ReadOrCreate, QuerySeter.One and QuerySeter.All.
+type AfterReader interface {
+	AfterRead(Ormer) error
 }
 
 // insert prepared statement
@@ -72,6 +112,7 @@ type QuerySeter interface {
 	Exist() bool
 	Update(Params) (int64, error)
 	Delete() (int64, error)
+	ForceDelete() (int64, error)
 	PrepareInsert() (Inserter, error)
 	All(interface{}, ...string) (int64, error)
 	One(interface{}, ...string) error
@@ -80,6 +121,10 @@ type QuerySeter interface {
 	ValuesFlat(*ParamsList, string) (int64, error)
 	RowsToMap(*Params, string, string) (int64, error)
 	RowsToStruct(interface{}, string, string) (int64, error)
+	WithContext(context.Context) QuerySeter
+	WithDeleted() QuerySeter
+	OnlyDeleted() QuerySeter
+	WithVersion(interface{}) QuerySeter
 }
 
 // model to model query struct
@@ -109,6 +154,7 @@ type RawSeter interface {
 	RowsToMap(*Params, string, string) (int64, error)
 	RowsToStruct(interface{}, string, string) (int64, error)
 	Prepare() (RawPreparer, error)
+	WithContext(context.Context) RawSeter
 }
 
 // statement querier
@@ -157,6 +203,7 @@ type dbBaser interface {
 	Delete(dbQuerier, *modelInfo, reflect.Value, *time.Location) (int64, error)
 	ReadBatch(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) (int64, error)
 	SupportUpdateJoin() bool
+	SupportSavepoint() bool
 	UpdateBatch(dbQuerier, *querySet, *modelInfo, *Condition, Params, *time.Location) (int64, error)
 	DeleteBatch(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
 	Count(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
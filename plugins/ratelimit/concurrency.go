@@ -0,0 +1,66 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego"
+)
+
+// MaxInFlight returns the middleware which runs at most n requests of the route at the same time,
+// a request waits at most wait for its turn, then it gets 429.
+// every call returns a new limit, so the routes using the same middleware share it.
+// usage:
+//	beego.Get("/report", report).Use(ratelimit.MaxInFlight(100, time.Second))
+//	ns.Use(ratelimit.MaxInFlight(1000, 0))
+func MaxInFlight(n int, wait time.Duration) beego.MiddleWare {
+	sem := make(chan struct{}, n)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !acquire(sem, wait) {
+				h := rw.Header()
+				h.Set(headerLimit, strconv.Itoa(n))
+				h.Set(headerRemaining, "0")
+				h.Set(headerRetryAfter, "1")
+				http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			defer func() { <-sem }()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func acquire(sem chan struct{}, wait time.Duration) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	}
+}
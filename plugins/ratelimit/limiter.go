@@ -0,0 +1,216 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/cache"
+)
+
+// the prefix of the keys in the cache
+const keyPrefix = "ratelimit:"
+
+// store keeps the limits in the cache adapter, the keys are named by the limiter,
+// so the instances sharing redis or memcache share the limiters of the same name.
+// the keys are locked in the process too, the memory cache isn't atomic.
+type store struct {
+	c     cache.Cache
+	name  string
+	locks [64]sync.Mutex
+}
+
+func newStore(c cache.Cache, kind, name string) *store {
+	if name == "" {
+		panic("ratelimit: the name of the limiter is empty")
+	}
+	if c == nil {
+		mc := cache.NewMemoryCache()
+		mc.StartAndGC(`{"interval":60}`)
+		c = mc
+	}
+	return &store{c: c, name: keyPrefix + kind + ":" + name + ":"}
+}
+
+func (s *store) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.locks[h.Sum32()%uint32(len(s.locks))]
+}
+
+// put stores the string, or the int for the counters which are increased by Incr,
+// memcache only stores strings so the string is tried if the int fails.
+func (s *store) put(key string, v interface{}, ttl time.Duration) error {
+	timeout := int64(math.Ceil(ttl.Seconds()))
+	if timeout < 1 {
+		timeout = 1
+	}
+	err := s.c.Put(key, v, timeout)
+	if _, ok := v.(int); ok && err != nil {
+		err = s.c.Put(key, strconv.Itoa(v.(int)), timeout)
+	}
+	return err
+}
+
+// incr increases the counter by Incr, it's created with the ttl if it doesn't exist,
+// only the instances creating the same counter at the same moment may lose a request.
+func (s *store) incr(key string, ttl time.Duration) error {
+	if !s.c.IsExist(key) {
+		if err := s.put(key, 0, ttl); err != nil {
+			return err
+		}
+	}
+	return s.c.Incr(key)
+}
+
+// TokenBucket allows rate requests per period with bursts of burst requests.
+// its state is read by Get and written by Put, so it's exact in a process only,
+// the instances sharing a cache may exceed the limit in a race, use SlidingWindow to share a limit.
+type TokenBucket struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+	store *store
+	now   func() time.Time
+}
+
+// NewTokenBucket returns the token bucket limiter named name in the cache,
+// a private memory cache is used if c is nil. burst is rate if it's less than 1.
+func NewTokenBucket(c cache.Cache, name string, rate int, per time.Duration, burst int) *TokenBucket {
+	if rate < 1 {
+		rate = 1
+	}
+	if burst < 1 {
+		burst = rate
+	}
+	return &TokenBucket{Rate: rate, Per: per, Burst: burst, store: newStore(c, "tb", name), now: time.Now}
+}
+
+// Take takes a token of the key.
+func (tb *TokenBucket) Take(key string) (*Result, error) {
+	key = tb.store.name + key
+	mu := tb.store.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := tb.now()
+	// time to get a token
+	interval := time.Duration(int64(tb.Per) / int64(tb.Rate))
+	tokens := float64(tb.Burst)
+	if v := cache.GetString(tb.store.c.Get(key)); v != "" {
+		parts := strings.SplitN(v, "|", 2)
+		if len(parts) == 2 {
+			t, err1 := strconv.ParseFloat(parts[0], 64)
+			last, err2 := strconv.ParseInt(parts[1], 10, 64)
+			if err1 == nil && err2 == nil {
+				elapsed := now.Sub(time.Unix(0, last))
+				tokens = math.Min(float64(tb.Burst), t+float64(elapsed)/float64(interval))
+			}
+		}
+	}
+
+	res := &Result{Limit: tb.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+	}
+	res.Remaining = int(tokens)
+	full := time.Duration((float64(tb.Burst) - tokens) * float64(interval))
+	res.Reset = now.Add(full)
+	if res.Allowed {
+		if err := tb.store.put(key, fmt.Sprintf("%f|%d", tokens, now.UnixNano()), full+time.Second); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// SlidingWindow allows limit requests in any window,
+// it's counted by the current window and the weighted previous window.
+// the counters are changed by Incr and Decr, so the instances sharing redis or memcache
+// don't lose the requests of each other, the request over the limit is counted back.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+	store  *store
+	now    func() time.Time
+}
+
+// NewSlidingWindow returns the sliding window limiter named name in the cache,
+// a private memory cache is used if c is nil.
+func NewSlidingWindow(c cache.Cache, name string, limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{Limit: limit, Window: window, store: newStore(c, "sw", name), now: time.Now}
+}
+
+// Take counts a request of the key.
+func (sw *SlidingWindow) Take(key string) (*Result, error) {
+	key = sw.store.name + key
+	mu := sw.store.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := sw.now()
+	idx := now.UnixNano() / int64(sw.Window)
+	start := time.Unix(0, idx*int64(sw.Window))
+	curKey := key + ":" + strconv.FormatInt(idx, 10)
+	prevKey := key + ":" + strconv.FormatInt(idx-1, 10)
+	// count the request first, the others counting at the same time see it
+	if err := sw.store.incr(curKey, 2*sw.Window); err != nil {
+		return nil, err
+	}
+	vs := sw.store.c.GetMulti([]string{curKey, prevKey})
+	cur, prev := cache.GetInt(vs[0]), cache.GetInt(vs[1])
+	// the requests before this one
+	others := cur - 1
+
+	// the weight of the previous window
+	weight := 1 - float64(now.Sub(start))/float64(sw.Window)
+	count := float64(prev)*weight + float64(cur)
+
+	res := &Result{Limit: sw.Limit, Reset: start.Add(2 * sw.Window)}
+	if others <= 0 && prev == 0 {
+		res.Reset = now.Add(sw.Window)
+	} else if prev == 0 {
+		res.Reset = start.Add(sw.Window)
+	}
+	if count > float64(sw.Limit) {
+		// the request isn't allowed, it's not counted
+		if err := sw.store.c.Decr(curKey); err != nil {
+			return nil, err
+		}
+		if others >= sw.Limit || prev == 0 {
+			// the current window is full
+			res.RetryAfter = start.Add(sw.Window).Sub(now)
+		} else {
+			// wait until the previous window weighs less
+			w := float64(sw.Limit-others-1) / float64(prev)
+			res.RetryAfter = time.Duration((weight - w) * float64(sw.Window))
+		}
+		res.Remaining = 0
+		return res, nil
+	}
+
+	res.Allowed = true
+	res.Remaining = int(float64(sw.Limit) - count)
+	return res, nil
+}
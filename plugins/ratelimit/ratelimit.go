@@ -0,0 +1,170 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides filters to limit the request rate and the requests in flight.
+//
+// Simple Usage:
+//	import(
+//		"github.com/astaxie/beego"
+//		"github.com/astaxie/beego/plugins/ratelimit"
+//	)
+//
+//	func main(){
+//		// 10 requests per second with bursts of 20 for every ip
+//		beego.InsertFilter("*", beego.BeforeRouter, ratelimit.Limit(ratelimit.NewTokenBucket(nil, "ip", 10, time.Second, 20), ratelimit.ByIP))
+//		beego.Run()
+//	}
+//
+// Advanced Usage:
+//
+//	// the limits of the same names are shared by the instances with the redis cache
+//	bm, _ := cache.NewCache("redis", `{"conn":"127.0.0.1:6379"}`)
+//	// 1000 requests per hour for every appid of apiauth
+//	beego.InsertFilter("/api/*", beego.BeforeRouter, ratelimit.Limit(ratelimit.NewSlidingWindow(bm, "api", 1000, time.Hour), ratelimit.ByAppId))
+//	// 5 logins per minute for every user in the session
+//	beego.InsertFilter("/login", beego.BeforeRouter, ratelimit.Limit(ratelimit.NewSlidingWindow(bm, "login", 5, time.Minute), ratelimit.ByUser("uid")))
+//	// at most 100 reports are running
+//	beego.Get("/report", report).Use(ratelimit.MaxInFlight(100, time.Second))
+//
+// Infomation:
+//
+// The limited requests get 429 with the headers:
+//
+//	X-RateLimit-Limit:     the max requests of the limit
+//	X-RateLimit-Remaining: the requests left
+//	X-RateLimit-Reset:     the unix time when the limit is fully reset
+//	Retry-After:           the seconds to wait before the next request
+//
+// The allowed requests get the X-RateLimit-* headers too.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+)
+
+const (
+	headerLimit      = "X-RateLimit-Limit"
+	headerRemaining  = "X-RateLimit-Remaining"
+	headerReset      = "X-RateLimit-Reset"
+	headerRetryAfter = "Retry-After"
+)
+
+// Result is the decision of a limiter for a request.
+type Result struct {
+	Allowed    bool          // the request is allowed
+	Limit      int           // the max requests of the limit
+	Remaining  int           // the requests left
+	Reset      time.Time     // when the limit is fully reset
+	RetryAfter time.Duration // how long to wait if the request isn't allowed
+}
+
+// Limiter takes a request of the key.
+type Limiter interface {
+	Take(key string) (*Result, error)
+}
+
+// KeyFunc returns the key of the request which the limit is counted by,
+// the request isn't limited if the key is empty.
+type KeyFunc func(ctx *context.Context) string
+
+// ByIP counts the requests by the client ip.
+func ByIP(ctx *context.Context) string {
+	return "ip:" + ctx.Input.IP()
+}
+
+// ByAppId counts the requests by the appid param of apiauth.
+func ByAppId(ctx *context.Context) string {
+	if appid := ctx.Input.Query("appid"); appid != "" {
+		return "app:" + appid
+	}
+	return ""
+}
+
+// ByRoute counts the requests by the http method and the pattern of the matched router, such as /user/:id,
+// the requests matching no router aren't limited.
+func ByRoute(ctx *context.Context) string {
+	pattern := beego.RoutePattern(ctx)
+	if pattern == "" {
+		return ""
+	}
+	return "route:" + ctx.Input.Method() + " " + pattern
+}
+
+// Global counts all the requests of the filter together.
+func Global(ctx *context.Context) string {
+	return "global"
+}
+
+// ByUser counts the requests by the value of the session key,
+// the requests without the session value aren't limited.
+func ByUser(sessionKey string) KeyFunc {
+	return func(ctx *context.Context) string {
+		if ctx.Input.CruSession == nil {
+			return ""
+		}
+		if v := ctx.Input.Session(sessionKey); v != nil {
+			return "user:" + fmt.Sprint(v)
+		}
+		return ""
+	}
+}
+
+// Limit returns the filter which writes 429 if the request of the key is over the limit.
+// the request is allowed if the store of the limiter fails.
+func Limit(l Limiter, key KeyFunc) beego.FilterFunc {
+	if key == nil {
+		key = ByIP
+	}
+	return func(ctx *context.Context) {
+		k := key(ctx)
+		if k == "" {
+			return
+		}
+		res, err := l.Take(k)
+		if err != nil {
+			beego.Warn("ratelimit:", err)
+			return
+		}
+		setHeaders(ctx.ResponseWriter.Header(), res)
+		if !res.Allowed {
+			ctx.Output.SetStatus(http.StatusTooManyRequests)
+			ctx.Output.Body([]byte(http.StatusText(http.StatusTooManyRequests)))
+		}
+	}
+}
+
+func setHeaders(h http.Header, res *Result) {
+	h.Set(headerLimit, strconv.Itoa(res.Limit))
+	h.Set(headerRemaining, strconv.Itoa(res.Remaining))
+	h.Set(headerReset, strconv.FormatInt(res.Reset.Unix(), 10))
+	if !res.Allowed {
+		h.Set(headerRetryAfter, strconv.Itoa(retrySeconds(res.RetryAfter)))
+	}
+}
+
+// retrySeconds rounds up the duration, Retry-After is at least 1 second.
+func retrySeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
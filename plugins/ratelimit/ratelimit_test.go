@@ -0,0 +1,191 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/cache"
+	"github.com/astaxie/beego/context"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func take(t *testing.T, l Limiter, key string, allowed bool) *Result {
+	res, err := l.Take(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed != allowed {
+		t.Fatalf("Take(%q) allowed %v, want %v: %+v", key, res.Allowed, allowed, res)
+	}
+	return res
+}
+
+func TestTokenBucket(t *testing.T) {
+	c := &clock{time.Unix(1000, 0)}
+	tb := NewTokenBucket(nil, "test", 2, time.Second, 3)
+	tb.now = c.now
+
+	for i := 2; i >= 0; i-- {
+		if res := take(t, tb, "a", true); res.Remaining != i {
+			t.Errorf("remaining %d, want %d", res.Remaining, i)
+		}
+	}
+	res := take(t, tb, "a", false)
+	if res.RetryAfter != 500*time.Millisecond || res.Limit != 3 {
+		t.Errorf("retry after %v limit %d", res.RetryAfter, res.Limit)
+	}
+	take(t, tb, "b", true)
+
+	c.t = c.t.Add(500 * time.Millisecond)
+	take(t, tb, "a", true)
+	take(t, tb, "a", false)
+	c.t = c.t.Add(time.Hour)
+	if res := take(t, tb, "a", true); res.Remaining != 2 {
+		t.Errorf("the bucket is over the burst: %d", res.Remaining)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c := &clock{time.Unix(600, 0)}
+	sw := NewSlidingWindow(nil, "test", 3, time.Minute)
+	sw.now = c.now
+
+	take(t, sw, "a", true)
+	take(t, sw, "a", true)
+	if res := take(t, sw, "a", true); res.Remaining != 0 {
+		t.Errorf("remaining %d, want 0", res.Remaining)
+	}
+	res := take(t, sw, "a", false)
+	if res.RetryAfter != time.Minute {
+		t.Errorf("retry after %v, want 1m", res.RetryAfter)
+	}
+
+	// half of the previous window is counted
+	c.t = c.t.Add(90 * time.Second)
+	take(t, sw, "a", true)
+	res = take(t, sw, "a", false)
+	if res.RetryAfter != 10*time.Second {
+		t.Errorf("retry after %v, want 10s", res.RetryAfter)
+	}
+	c.t = c.t.Add(10 * time.Second)
+	take(t, sw, "a", true)
+}
+
+func TestLimit(t *testing.T) {
+	handler := beego.NewControllerRegister()
+	handler.InsertFilter("/api/*", beego.BeforeRouter, Limit(NewSlidingWindow(nil, "api", 1, time.Minute), ByAppId))
+	handler.Get("/api/user", func(ctx *context.Context) {
+		ctx.Output.Body([]byte("user"))
+	})
+
+	get := func(url string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("/api/user?appid=1"); w.Code != 200 || w.Header().Get(headerLimit) != "1" || w.Header().Get(headerRemaining) != "0" {
+		t.Errorf("the first request get %d %v", w.Code, w.Header())
+	}
+	w := get("/api/user?appid=1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(headerRetryAfter) == "" || w.Header().Get(headerReset) == "" {
+		t.Errorf("the limited request get %d %v", w.Code, w.Header())
+	}
+	if w := get("/api/user?appid=2"); w.Code != 200 {
+		t.Errorf("another appid get %d", w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("/api/user"); w.Code != 200 {
+			t.Errorf("the request without appid is limited")
+		}
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	bm := cache.NewMemoryCache()
+	// the limiters of the same name in the instances share the limit
+	a := NewSlidingWindow(bm, "shared", 2, time.Minute)
+	b := NewSlidingWindow(bm, "shared", 2, time.Minute)
+	other := NewSlidingWindow(bm, "other", 2, time.Minute)
+
+	take(t, a, "k", true)
+	take(t, b, "k", true)
+	take(t, a, "k", false)
+	take(t, b, "k", false)
+	take(t, other, "k", true)
+}
+
+func TestByRoute(t *testing.T) {
+	handler := beego.NewControllerRegister()
+	handler.InsertFilter("/user/*", beego.BeforeRouter, Limit(NewSlidingWindow(nil, "route", 2, time.Minute), ByRoute))
+	handler.Get("/user/:id", func(ctx *context.Context) {
+		ctx.Output.Body([]byte("user"))
+	})
+
+	codes := []int{200, 200, http.StatusTooManyRequests}
+	for i, url := range []string{"/user/1", "/user/2", "/user/3"} {
+		r, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != codes[i] {
+			t.Errorf("%s get %d, want %d", url, w.Code, codes[i])
+		}
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	block := make(chan bool)
+	running := make(chan bool)
+	handler := beego.NewControllerRegister()
+	handler.Get("/report", func(ctx *context.Context) {
+		running <- true
+		<-block
+		ctx.Output.Body([]byte("report"))
+	}).Use(MaxInFlight(1, 10*time.Millisecond))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r, _ := http.NewRequest("GET", "/report", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+	<-running
+
+	r, _ := http.NewRequest("GET", "/report", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(headerRetryAfter) != "1" {
+		t.Errorf("the request over the limit get %d", w.Code)
+	}
+	close(block)
+	wg.Wait()
+
+	go func() { <-running }()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "report" {
+		t.Errorf("the request after the release get %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package msgpack registers the msgpack renderer and body decoder.
+// Usage
+//	import (
+//		"github.com/astaxie/beego"
+//		_ "github.com/astaxie/beego/plugins/renderers/msgpack"
+//	)
+//
+//	func (c *UserController) Get() {
+//		c.Data["json"] = users
+//		// served as msgpack for "Accept: application/msgpack"
+//		c.ServeFormatted()
+//	}
+package msgpack
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/vmihailenco/msgpack"
+)
+
+// the media types of msgpack
+const (
+	MediaType  = "application/msgpack"
+	MediaTypeX = "application/x-msgpack"
+)
+
+func init() {
+	beego.AddRenderer(MediaType, Render)
+	beego.AddRenderer(MediaTypeX, Render)
+	beego.AddBodyDecoder(MediaType, Decode)
+	beego.AddBodyDecoder(MediaTypeX, Decode)
+}
+
+// Render encodes data as msgpack.
+func Render(data interface{}, hasIndent bool) ([]byte, error) {
+	return msgpack.Marshal(data)
+}
+
+// Decode decodes the msgpack request body into obj.
+func Decode(ctx *context.Context, obj interface{}) error {
+	body := ctx.Input.RequestBody
+	if body == nil {
+		body = ctx.Input.CopyBody()
+	}
+	return msgpack.Unmarshal(body, obj)
+}
@@ -0,0 +1,64 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yaml registers the YAML renderer.
+// Usage
+//	import (
+//		"github.com/astaxie/beego"
+//		_ "github.com/astaxie/beego/plugins/renderers/yaml"
+//	)
+//
+//	func (c *UserController) Get() {
+//		c.Data["json"] = users
+//		// served as YAML for "Accept: application/x-yaml"
+//		c.ServeFormatted()
+//	}
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/astaxie/beego"
+	"github.com/beego/goyaml2"
+)
+
+// the media types of YAML
+const (
+	MediaType  = "application/x-yaml"
+	MediaTypeT = "text/yaml"
+)
+
+func init() {
+	beego.AddRenderer(MediaType, Render)
+	beego.AddRenderer(MediaTypeT, Render)
+}
+
+// Render encodes data as YAML.
+// data is converted by encoding/json first, so the json tags name the fields.
+func Render(data interface{}, hasIndent bool) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := goyaml2.Write(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/trace"
+)
+
+const problemJson = "application/problem+json"
+
+// Problem is the RFC 7807 problem details of an error response.
+// it's written instead of the error pages when ErrorsProblemJson is true,
+// or the request is served by a Namespace with ProblemJson.
+type Problem struct {
+	Type     string          `json:"type"`
+	Title    string          `json:"title"`
+	Status   int             `json:"status"`
+	Detail   string          `json:"detail,omitempty"`
+	Instance string          `json:"instance,omitempty"`
+	TraceId  string          `json:"trace_id,omitempty"`
+	Errors   []*ProblemField `json:"errors,omitempty"`
+}
+
+// ProblemField is the validation error of a field.
+type ProblemField struct {
+	Field   string `json:"field"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// NewProblem returns the problem of the http status,
+// the type is "about:blank" and the title is the status text.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// problemKey marks the requests whose errors are problem+json in Input.Data.
+type problemKey struct{}
+
+// isProblem checks if the errors of the request are written as problem+json.
+func isProblem(ctx *context.Context) bool {
+	if appSettings(ctx).ErrorsProblemJson {
+		return true
+	}
+	if ctx == nil || ctx.Input == nil {
+		return false
+	}
+	v, _ := ctx.Input.GetData(problemKey{}).(bool)
+	return v
+}
+
+// problemFor checks if the url is under a prefix registered by Namespace.ProblemJson.
+func (p *ControllerRegistor) problemFor(urlPath string) bool {
+	caseSensitive := p.conf().RouterCaseSensitive
+	for _, prefix := range p.problemPrefixes {
+		if !caseSensitive {
+			prefix = strings.ToLower(prefix)
+		}
+		if urlPath == prefix || strings.HasPrefix(urlPath, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeProblem writes the problem as the response,
+// the instance and the trace id are filled from the request.
+func writeProblem(ctx *context.Context, pb *Problem) {
+	if pb.Instance == "" && ctx.Request != nil {
+		pb.Instance = ctx.Request.URL.Path
+	}
+	if pb.TraceId == "" {
+		pb.TraceId = problemTraceId(ctx)
+	}
+	content, err := json.Marshal(pb)
+	if err != nil {
+		http.Error(ctx.ResponseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.ResponseWriter.Header().Set("Content-Type", problemJson)
+	ctx.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	ctx.ResponseWriter.WriteHeader(pb.Status)
+	ctx.ResponseWriter.Write(content)
+}
+
+// problemTraceId returns the request id of RequestIdFilter, the X-Request-Id of the request, or a random id.
+func problemTraceId(ctx *context.Context) string {
+	if ctx.Input != nil && ctx.Request != nil {
+		if id := trace.RequestId(ctx.Request.Context()); id != "" {
+			return id
+		}
+		if id := ctx.Input.Header("X-Request-Id"); id != "" {
+			return id
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// panicProblem returns the problem of the recovered panic,
+// the panic of a status code like panic("404") gets the status,
+// the others are 500 and the detail is only shown in dev mode.
+func panicProblem(err interface{}, runMode string) *Problem {
+	if code, e := strconv.Atoi(fmt.Sprint(err)); e == nil && code >= 400 && code < 600 {
+		return NewProblem(code, "")
+	}
+	if runMode == "dev" {
+		return NewProblem(http.StatusInternalServerError, fmt.Sprint(err))
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// AbortProblem stops the controller handler and writes the problem+json of the error,
+// the field errors of *BindError are listed in the problem.
+// usage:
+//	if err := c.BindBody(&u); err != nil {
+//		c.AbortProblem(422, err)
+//	}
+func (c *Controller) AbortProblem(status int, err error) {
+	pb := NewProblem(status, "")
+	if err != nil {
+		pb.Detail = err.Error()
+	}
+	if berr, ok := err.(*BindError); ok {
+		pb.Detail = "the request body is invalid"
+		for _, e := range berr.Errors {
+			pb.Errors = append(pb.Errors, &ProblemField{Field: e.Field, Key: e.Key, Message: e.Message})
+		}
+	}
+	writeProblem(c.Ctx, pb)
+	panic(USERSTOPRUN)
+}
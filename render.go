@@ -0,0 +1,180 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Renderer encodes the data served by Controller.ServeFormatted.
+type Renderer func(data interface{}, hasIndent bool) ([]byte, error)
+
+var (
+	renderers = map[string]Renderer{}
+	// the media types in registration order, the earlier one is preferred by the negotiation.
+	renderTypes []string
+)
+
+func init() {
+	AddRenderer(applicationJson, renderJson)
+	AddRenderer(applicationXml, renderXml)
+	AddRenderer(textXml, renderXml)
+	AddRenderer("text/csv", renderCsv)
+	AddRenderer("text/plain", renderText)
+}
+
+// AddRenderer registers the renderer of the media type for Controller.ServeFormatted,
+// the renderer of a registered media type is replaced.
+// YAML and msgpack renderers are in plugins/renderers/yaml and plugins/renderers/msgpack.
+// usage:
+//	beego.AddRenderer("application/x-yaml", func(data interface{}, hasIndent bool) ([]byte, error) {
+//		return yaml.Marshal(data)
+//	})
+func AddRenderer(mediaType string, r Renderer) {
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := renderers[mediaType]; !ok {
+		renderTypes = append(renderTypes, mediaType)
+	}
+	renderers[mediaType] = r
+}
+
+// content type header of the media type
+func renderContentType(mediaType string) string {
+	if strings.HasPrefix(mediaType, "text/") || mediaType == applicationJson || mediaType == applicationXml {
+		return mediaType + "; charset=utf-8"
+	}
+	return mediaType
+}
+
+func renderJson(data interface{}, hasIndent bool) ([]byte, error) {
+	if hasIndent {
+		return json.MarshalIndent(data, "", "  ")
+	}
+	return json.Marshal(data)
+}
+
+func renderXml(data interface{}, hasIndent bool) ([]byte, error) {
+	if hasIndent {
+		return xml.MarshalIndent(data, "", "  ")
+	}
+	return xml.Marshal(data)
+}
+
+func renderText(data interface{}, hasIndent bool) ([]byte, error) {
+	switch v := data.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return []byte(fmt.Sprint(data)), nil
+}
+
+// renderCsv supports [][]string, slice of structs and slice of maps,
+// the first line is the header for structs and maps.
+// the columns of a struct are its exported fields, named by the json tag,
+// the columns of maps are the sorted keys of the first map.
+func renderCsv(data interface{}, hasIndent bool) ([]byte, error) {
+	if rows, ok := data.([][]string); ok {
+		return writeCsv(rows)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		v = reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+	}
+	var rows [][]string
+	var keys []reflect.Value
+	for i := 0; i < v.Len(); i++ {
+		e := reflect.Indirect(v.Index(i))
+		for e.Kind() == reflect.Interface {
+			e = reflect.Indirect(e.Elem())
+		}
+		switch e.Kind() {
+		case reflect.Struct:
+			var header, row []string
+			for j := 0; j < e.NumField(); j++ {
+				f := e.Type().Field(j)
+				if f.PkgPath != "" {
+					continue
+				}
+				name := strings.Split(f.Tag.Get("json"), ",")[0]
+				if name == "-" {
+					continue
+				} else if name == "" {
+					name = f.Name
+				}
+				header = append(header, name)
+				row = append(row, fmt.Sprint(e.Field(j).Interface()))
+			}
+			if i == 0 {
+				rows = append(rows, header)
+			}
+			rows = append(rows, row)
+		case reflect.Map:
+			if i == 0 {
+				keys = e.MapKeys()
+				sort.Sort(valueSorter(keys))
+				header := make([]string, len(keys))
+				for j, k := range keys {
+					header[j] = fmt.Sprint(k.Interface())
+				}
+				rows = append(rows, header)
+			}
+			row := make([]string, len(keys))
+			for j, k := range keys {
+				if val := e.MapIndex(k); val.IsValid() {
+					row[j] = fmt.Sprint(val.Interface())
+				}
+			}
+			rows = append(rows, row)
+		case reflect.Slice, reflect.Array:
+			row := make([]string, e.Len())
+			for j := range row {
+				row[j] = fmt.Sprint(e.Index(j).Interface())
+			}
+			rows = append(rows, row)
+		default:
+			return nil, fmt.Errorf("beego: can't render %s as csv", e.Kind())
+		}
+	}
+	return writeCsv(rows)
+}
+
+func writeCsv(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type valueSorter []reflect.Value
+
+func (v valueSorter) Len() int      { return len(v) }
+func (v valueSorter) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v valueSorter) Less(i, j int) bool {
+	return fmt.Sprint(v[i].Interface()) < fmt.Sprint(v[j].Interface())
+}
@@ -16,6 +16,7 @@ package beego
 
 import (
 	"bufio"
+	stdcontext "context"
 	"errors"
 	"fmt"
 	"net"
@@ -25,6 +26,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -69,7 +71,7 @@ var (
 		"GetFloat", "GetFile", "SaveToFile", "StartSession", "SetSession", "GetSession",
 		"DelSession", "SessionRegenerateID", "DestroySession", "IsAjax", "GetSecureCookie",
 		"SetSecureCookie", "XsrfToken", "CheckXsrfCookie", "XsrfFormHtml",
-		"GetControllerAndAction"}
+		"GetControllerAndAction", "RequestContext", "BindBody", "AbortProblem"}
 
 	url_placeholder                = "{{placeholder}}"
 	DefaultLogFilter FilterHandler = &logFilter{}
@@ -99,6 +101,11 @@ func (l *logFilter) Filter(ctx *beecontext.Context) bool {
 			return true
 		}
 	}
+	for prefix := range StaticFileSystem {
+		if strings.HasPrefix(requestPath, prefix) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -114,6 +121,127 @@ type controllerInfo struct {
 	handler        http.Handler
 	runfunction    FilterFunc
 	routerType     int
+	middlewares    []MiddleWare
+	timeout        time.Duration
+	conds          []routeCond
+	name           string
+	namespace      string
+}
+
+// routeCond is a predicate which must be true for the route to be matched.
+type routeCond func(*beecontext.Context) bool
+
+// check all the route conditions
+func (c *controllerInfo) checkConds(ctx *beecontext.Context) bool {
+	for _, cond := range c.conds {
+		if !cond(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// Route is returned when a router rule is registered,
+// it is used to attach options to this single rule.
+// usage:
+//	BeeApp.Handlers.Add("/user", &UserController{}).Use(Timer, Recovery)
+type Route struct {
+	info *controllerInfo
+}
+
+// Name names this route, UrlFor(name, params...) builds its url.
+// usage:
+//	beego.Get("/user/:id", getUser).Name("user.show")
+//	beego.UrlFor("user.show", ":id", 1) // /user/1
+func (r *Route) Name(name string) *Route {
+	r.info.name = name
+	return r
+}
+
+// Use appends middlewares which are executed around the dispatch of this route.
+func (r *Route) Use(mws ...MiddleWare) *Route {
+	r.info.middlewares = append(r.info.middlewares, mws...)
+	return r
+}
+
+// Timeout sets the deadline of the request context for this route.
+// the handler should watch Controller.RequestContext() to stop in time.
+func (r *Route) Timeout(d time.Duration) *Route {
+	r.info.timeout = d
+	return r
+}
+
+// Cond adds a condition to this route.
+// when it returns false the route is skipped and the other routes are tried,
+// if no route matches, 404 is returned.
+func (r *Route) Cond(cond func(*beecontext.Context) bool) *Route {
+	r.info.conds = append(r.info.conds, cond)
+	return r
+}
+
+// Host limits this route to the request host, the port is ignored.
+// "*.example.com" matches all the sub domains of example.com.
+func (r *Route) Host(host string) *Route {
+	host = strings.ToLower(host)
+	return r.Cond(func(ctx *beecontext.Context) bool {
+		h := strings.ToLower(ctx.Input.Host())
+		if strings.HasPrefix(host, "*.") {
+			return strings.HasSuffix(h, host[1:])
+		}
+		return h == host
+	})
+}
+
+// Header limits this route to the requests having the header.
+// if value is empty, the header only needs to be present.
+func (r *Route) Header(key, value string) *Route {
+	return r.Cond(func(ctx *beecontext.Context) bool {
+		if value == "" {
+			return ctx.Input.Header(key) != ""
+		}
+		return ctx.Input.Header(key) == value
+	})
+}
+
+// Query limits this route to the requests having the query param.
+// if value is empty, the param only needs to be present.
+func (r *Route) Query(key, value string) *Route {
+	return r.Cond(func(ctx *beecontext.Context) bool {
+		if value == "" {
+			_, ok := ctx.Request.URL.Query()[key]
+			return ok
+		}
+		return ctx.Request.URL.Query().Get(key) == value
+	})
+}
+
+// Accept limits this route to the requests accepting one of the mime types.
+// a request without Accept header accepts everything.
+func (r *Route) Accept(mimes ...string) *Route {
+	ms := make([]string, len(mimes))
+	for i, m := range mimes {
+		ms[i] = strings.ToLower(m)
+	}
+	return r.Cond(func(ctx *beecontext.Context) bool {
+		return acceptsMime(ctx.Input.Header("Accept"), ms)
+	})
+}
+
+// acceptsMime checks whether the Accept header matches one of the mime types.
+func acceptsMime(accept string, mimes []string) bool {
+	if accept == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		typ := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		for _, m := range mimes {
+			if typ == "*/*" || typ == m ||
+				(strings.HasSuffix(typ, "/*") && strings.HasPrefix(m, typ[:len(typ)-1])) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // ControllerRegistor containers registered router rules, controller handlers and filters.
@@ -124,16 +252,35 @@ type ControllerRegistor struct {
 	routers      map[string]*Tree
 	enableFilter bool
 	filters      map[int][]*FilterRouter
+	hosts        []*hostRouter
+	errorMaps    map[string]*errorInfo
+	cfg          *Settings           // settings of the app, see NewAppWithSettings
+	parent       *ControllerRegistor // the ControllerRegistor owning the host router
+	// the url prefixes whose errors are problem+json, see Namespace.ProblemJson
+	problemPrefixes []string
 }
 
 // NewControllerRegister returns a new ControllerRegistor.
 func NewControllerRegister() *ControllerRegistor {
 	return &ControllerRegistor{
-		routers: make(map[string]*Tree),
-		filters: make(map[int][]*FilterRouter),
+		routers:   make(map[string]*Tree),
+		filters:   make(map[int][]*FilterRouter),
+		errorMaps: make(map[string]*errorInfo),
 	}
 }
 
+// conf returns the Settings of the app, the host routers use the Settings of their owner.
+// the global variables are used if the app has no Settings.
+func (p *ControllerRegistor) conf() *Settings {
+	if p.cfg != nil {
+		return p.cfg
+	}
+	if p.parent != nil {
+		return p.parent.conf()
+	}
+	return globalSettings()
+}
+
 // Add controller handler and pattern rules to ControllerRegistor.
 // usage:
 //	default methods is the same name as method
@@ -148,7 +295,7 @@ func NewControllerRegister() *ControllerRegistor {
 // 如何定制: ControllerRegistor呢?
 // BeeApp.Handlers.Add(rootpath, c, mappingMethods...)
 //
-func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingMethods ...string) {
+func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingMethods ...string) *Route {
 	reflectVal := reflect.ValueOf(c) //
 	t := reflect.Indirect(reflectVal).Type()
 	methods := make(map[string]string)
@@ -196,11 +343,15 @@ func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingM
 	if len(methods) == 0 {
 		// 如果没有指定: methods, 那么如何处理呢?
 		// 按照: Restful接口方式来处理
+		// 只注册controller实现了的method, 其他的method由HEAD/OPTIONS/405自动处理
+		implemented := implementedMethods(reflectVal.Type())
 		for _, m := range HTTPMETHOD {
 			//
 			// Add("/user",&UserController{})
 			//
-			p.addToRouter(m, pattern, route)
+			if len(implemented) == 0 || implemented[m] {
+				p.addToRouter(m, pattern, route)
+			}
 		}
 	} else {
 		for k := range methods {
@@ -214,6 +365,76 @@ func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingM
 			}
 		}
 	}
+	return &Route{info: route}
+}
+
+// the http methods handled by the default methods of Controller
+var controllerMethods = map[string]string{
+	"GET":     "Get",
+	"POST":    "Post",
+	"PUT":     "Put",
+	"DELETE":  "Delete",
+	"PATCH":   "Patch",
+	"OPTIONS": "Options",
+	"HEAD":    "Head",
+}
+
+// implementedMethods returns the http methods of the controller type,
+// the methods of Controller not overridden answer 405 only, so they aren't counted.
+// it's empty if the controller overrides none of them, all the methods are served then.
+func implementedMethods(t reflect.Type) map[string]bool {
+	implemented := make(map[string]bool)
+	for m := range HTTPMETHOD {
+		name, ok := controllerMethods[m]
+		if !ok {
+			// TRACE, CONNECT
+			if _, ok := t.MethodByName(m); ok {
+				implemented[m] = true
+			}
+		} else if overridesMethod(t, name) {
+			implemented[m] = true
+		}
+	}
+	return implemented
+}
+
+// overridesMethod checks the method of the controller type isn't the one of Controller.
+// the methods promoted from the embedded fields are autogenerated wrappers,
+// so the embedded field declaring the method is checked.
+func overridesMethod(t reflect.Type, name string) bool {
+	m, ok := t.MethodByName(name)
+	if !ok {
+		return false
+	}
+	pc := m.Func.Pointer()
+	if file, _ := runtime.FuncForPC(pc).FileLine(pc); file != "<autogenerated>" {
+		base, _ := reflect.TypeOf(&Controller{}).MethodByName(name)
+		return pc != base.Func.Pointer()
+	}
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() != reflect.Ptr && ft.Kind() != reflect.Interface {
+			ft = reflect.PtrTo(ft)
+		}
+		if _, ok := ft.MethodByName(name); ok {
+			if ft.Kind() == reflect.Interface {
+				return true
+			}
+			return overridesMethod(ft, name)
+		}
+	}
+	return true
 }
 
 //
@@ -222,7 +443,7 @@ func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingM
 //
 func (p *ControllerRegistor) addToRouter(method, pattern string, r *controllerInfo) {
 	// 是否大小写敏感(一般URL都采用小写字母)
-	if !RouterCaseSensitive {
+	if !p.conf().RouterCaseSensitive {
 		pattern = strings.ToLower(pattern)
 	}
 
@@ -283,8 +504,8 @@ func (p *ControllerRegistor) Include(cList ...ControllerInterface) {
 //    Get("/", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Get(pattern string, f FilterFunc) {
-	p.AddMethod("get", pattern, f)
+func (p *ControllerRegistor) Get(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("get", pattern, f)
 }
 
 // add post method
@@ -292,8 +513,8 @@ func (p *ControllerRegistor) Get(pattern string, f FilterFunc) {
 //    Post("/api", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Post(pattern string, f FilterFunc) {
-	p.AddMethod("post", pattern, f)
+func (p *ControllerRegistor) Post(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("post", pattern, f)
 }
 
 // add put method
@@ -301,8 +522,8 @@ func (p *ControllerRegistor) Post(pattern string, f FilterFunc) {
 //    Put("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Put(pattern string, f FilterFunc) {
-	p.AddMethod("put", pattern, f)
+func (p *ControllerRegistor) Put(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("put", pattern, f)
 }
 
 // add delete method
@@ -310,8 +531,8 @@ func (p *ControllerRegistor) Put(pattern string, f FilterFunc) {
 //    Delete("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Delete(pattern string, f FilterFunc) {
-	p.AddMethod("delete", pattern, f)
+func (p *ControllerRegistor) Delete(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("delete", pattern, f)
 }
 
 // add head method
@@ -319,8 +540,8 @@ func (p *ControllerRegistor) Delete(pattern string, f FilterFunc) {
 //    Head("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Head(pattern string, f FilterFunc) {
-	p.AddMethod("head", pattern, f)
+func (p *ControllerRegistor) Head(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("head", pattern, f)
 }
 
 // add patch method
@@ -328,8 +549,8 @@ func (p *ControllerRegistor) Head(pattern string, f FilterFunc) {
 //    Patch("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Patch(pattern string, f FilterFunc) {
-	p.AddMethod("patch", pattern, f)
+func (p *ControllerRegistor) Patch(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("patch", pattern, f)
 }
 
 // add options method
@@ -337,8 +558,8 @@ func (p *ControllerRegistor) Patch(pattern string, f FilterFunc) {
 //    Options("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Options(pattern string, f FilterFunc) {
-	p.AddMethod("options", pattern, f)
+func (p *ControllerRegistor) Options(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("options", pattern, f)
 }
 
 // add all method
@@ -346,8 +567,8 @@ func (p *ControllerRegistor) Options(pattern string, f FilterFunc) {
 //    Any("/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) Any(pattern string, f FilterFunc) {
-	p.AddMethod("*", pattern, f)
+func (p *ControllerRegistor) Any(pattern string, f FilterFunc) *Route {
+	return p.AddMethod("*", pattern, f)
 }
 
 // add http method router
@@ -355,7 +576,7 @@ func (p *ControllerRegistor) Any(pattern string, f FilterFunc) {
 //    AddMethod("get","/api/:id", func(ctx *context.Context){
 //          ctx.Output.Body("hello world")
 //    })
-func (p *ControllerRegistor) AddMethod(method, pattern string, f FilterFunc) {
+func (p *ControllerRegistor) AddMethod(method, pattern string, f FilterFunc) *Route {
 	if _, ok := HTTPMETHOD[strings.ToUpper(method)]; method != "*" && !ok {
 		panic("not support http method: " + method)
 	}
@@ -381,10 +602,13 @@ func (p *ControllerRegistor) AddMethod(method, pattern string, f FilterFunc) {
 			p.addToRouter(k, pattern, route)
 		}
 	}
+	return &Route{info: route}
 }
 
 // add user defined Handler
-func (p *ControllerRegistor) Handler(pattern string, h http.Handler, options ...interface{}) {
+// options[0] as bool means the handler also serves all the sub paths,
+// MiddleWare options are attached to this route.
+func (p *ControllerRegistor) Handler(pattern string, h http.Handler, options ...interface{}) *Route {
 	route := &controllerInfo{}
 	route.pattern = pattern
 	route.routerType = routerTypeHandler
@@ -394,9 +618,18 @@ func (p *ControllerRegistor) Handler(pattern string, h http.Handler, options ...
 			pattern = path.Join(pattern, "?:all")
 		}
 	}
+	for _, o := range options {
+		switch mw := o.(type) {
+		case MiddleWare:
+			route.middlewares = append(route.middlewares, mw)
+		case func(http.Handler) http.Handler:
+			route.middlewares = append(route.middlewares, mw)
+		}
+	}
 	for _, m := range HTTPMETHOD {
 		p.addToRouter(m, pattern, route)
 	}
+	return &Route{info: route}
 }
 
 // Add auto router to ControllerRegistor.
@@ -447,7 +680,7 @@ func (p *ControllerRegistor) InsertFilter(pattern string, pos int, filter Filter
 	mr.tree = NewTree()
 	mr.pattern = pattern
 	mr.filterFunc = filter
-	if !RouterCaseSensitive {
+	if !p.conf().RouterCaseSensitive {
 		pattern = strings.ToLower(pattern)
 	}
 	if len(params) == 0 {
@@ -468,12 +701,8 @@ func (p *ControllerRegistor) insertFilterRouter(pos int, mr *FilterRouter) error
 
 // UrlFor does another controller handler in this request function.
 // it can access any controller method.
+// the endpoint can also be a name set by Route.Name.
 func (p *ControllerRegistor) UrlFor(endpoint string, values ...interface{}) string {
-	paths := strings.Split(endpoint, ".")
-	if len(paths) <= 1 {
-		Warn("urlfor endpoint must like path.controller.method")
-		return ""
-	}
 	if len(values)%2 != 0 {
 		Warn("urlfor params must key-value pair")
 		return ""
@@ -489,6 +718,19 @@ func (p *ControllerRegistor) UrlFor(endpoint string, values ...interface{}) stri
 			}
 		}
 	}
+	// the routes named by Route.Name
+	if c := p.namedRoute(endpoint); c != nil {
+		if url, ok := urlFromPattern(c.pattern, params); ok {
+			return url
+		}
+		Warn("urlfor params don't match the route " + endpoint)
+		return ""
+	}
+	paths := strings.Split(endpoint, ".")
+	if len(paths) <= 1 {
+		Warn("urlfor endpoint must like path.controller.method")
+		return ""
+	}
 	controllName := strings.Join(paths[:len(paths)-1], "/")
 	methodName := paths[len(paths)-1]
 	for m, t := range p.routers {
@@ -621,17 +863,33 @@ func (p *ControllerRegistor) geturl(t *Tree, url, controllName, methodName strin
 //			ServeHTTP(ResponseWriter, *Request)
 //		}
 func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	// 按照host分发到对应的ControllerRegistor
+	if len(p.hosts) > 0 {
+		if h, params := p.matchHost(r.Host); h != nil {
+			hm := &hostMatch{handlers: h.handlers, params: params}
+			h.handlers.ServeHTTP(rw, r.WithContext(stdcontext.WithValue(r.Context(), hostMatchKey{}, hm)))
+			return
+		}
+	}
+
 	starttime := time.Now()
 	var runrouter reflect.Type
 	var findrouter bool
 	var runMethod string
 	var routerInfo *controllerInfo
+	var headAsGet bool
+	cfg := p.conf()
 
 	w := &responseWriter{writer: rw}
 
+	if EnableAdmin {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+	}
+
 	// 在Response Header中输出: Server
-	if RunMode == "dev" {
-		w.Header().Set("Server", BeegoServerName)
+	if cfg.RunMode == "dev" {
+		w.Header().Set("Server", cfg.BeegoServerName)
 	}
 
 	// 1.  准备Context
@@ -643,18 +901,30 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 		Output:         beecontext.NewOutput(),
 	}
 	context.Output.Context = context
-	context.Output.EnableGzip = EnableGzip
+	context.Output.EnableGzip = cfg.EnableGzip
+	context.Input.SetData(registorKey{}, p)
+	context.Input.SetData(settingsKey{}, cfg)
+
+	// host router captured params, such as :tenant
+	if hm, ok := r.Context().Value(hostMatchKey{}).(*hostMatch); ok {
+		for k, v := range hm.params {
+			context.Input.Params[k] = v
+		}
+	}
 
 	// 如果出现Panic, 那该如何处理呢?
 	defer p.recoverPanic(context)
 
 	// 2. urlPath
 	var urlPath string
-	if !RouterCaseSensitive {
+	if !cfg.RouterCaseSensitive {
 		urlPath = strings.ToLower(r.URL.Path)
 	} else {
 		urlPath = r.URL.Path
 	}
+	if p.problemFor(urlPath) {
+		context.Input.SetData(problemKey{}, true)
+	}
 
 	// 3. 为每一个请求定制: do_filter
 	// defined filter function
@@ -679,6 +949,8 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 						}
 						// 调用: filterFunc
 						filterR.filterFunc(context)
+						// the filter may replace the request, such as the context of RequestIdFilter
+						r = context.Request
 					}
 					if filterR.returnOnOutput && w.started {
 						return true
@@ -701,7 +973,7 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	}
 
 	// 2. 处理 static 文件
-	serverStaticRouter(context)
+	serverStaticRouter(context, cfg)
 	// 如果有有效的 static文件，则started == true
 	if w.started {
 		findrouter = true
@@ -711,9 +983,9 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	// 3. 在Request处理流程中设置的: Session
 	// 注意: defer的执行顺序
 	// session init
-	if SessionOn {
+	if cfg.SessionOn {
 		var err error
-		context.Input.CruSession, err = GlobalSessions.SessionStart(w, r)
+		context.Input.CruSession, err = cfg.Sessions.SessionStart(w, r)
 		if err != nil {
 			Error(err)
 			exception("503", context)
@@ -726,10 +998,10 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 
 	// 4. 对于其他的请求，准备解析POST数据
 	if r.Method != "GET" && r.Method != "HEAD" {
-		if CopyRequestBody && !context.Input.IsUpload() {
+		if cfg.CopyRequestBody && !context.Input.IsUpload() {
 			context.Input.CopyBody()
 		}
-		context.Input.ParseFormOrMulitForm(MaxMemory)
+		context.Input.ParseFormOrMulitForm(cfg.MaxMemory)
 	}
 
 	if do_filter(BeforeRouter) {
@@ -753,23 +1025,37 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			http_method = "DELETE"
 		}
 
-		if t, ok := p.routers[http_method]; ok {
-			runObject, p := t.Match(urlPath)
-			if r, ok := runObject.(*controllerInfo); ok {
-				routerInfo = r
+		routerInfo = p.findRouter(http_method, urlPath, context)
+		if routerInfo == nil && http_method == "HEAD" {
+			// HEAD 由 GET 的router处理, 但不输出body
+			if routerInfo = p.findRouter("GET", urlPath, context); routerInfo != nil {
+				headAsGet = true
+				w.writer = &headResponseWriter{rw}
+			}
+		}
+		if routerInfo != nil {
+			findrouter = true
+			context.Input.SetData(routePatternKey{}, routerInfo.pattern)
+		} else if allow := p.allowedMethods(urlPath, context); len(allow) > 0 {
+			// url存在, 但是不支持当前的method
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			if http_method == "OPTIONS" {
 				findrouter = true
-				if splat, ok := p[":splat"]; ok {
-					splatlist := strings.Split(splat, "/")
-					for k, v := range splatlist {
-						p[strconv.Itoa(k)] = v
-					}
-				}
-				if p != nil {
-					context.Input.Params = p
-				}
+				w.WriteHeader(http.StatusOK)
+			} else {
+				exception("405", context)
 			}
+			goto Admin
 		}
+	}
 
+	// 设置了超时时间的router, 为request加上deadline
+	if routerInfo != nil && routerInfo.timeout > 0 {
+		ctx, cancel := stdcontext.WithTimeout(r.Context(), routerInfo.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+		context.Request = r
+		context.Input.Request = r
 	}
 
 	//if no matches to url, throw a not found exception
@@ -786,16 +1072,18 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 		isRunable := false
 		if routerInfo != nil {
 			if routerInfo.routerType == routerTypeRESTFul {
-				if _, ok := routerInfo.methods[r.Method]; ok {
+				method := r.Method
+				if headAsGet {
+					method = "GET"
+				}
+				if _, ok := routerInfo.methods[method]; ok {
 					isRunable = true
-					routerInfo.runfunction(context)
 				} else {
 					exception("405", context)
 					goto Admin
 				}
 			} else if routerInfo.routerType == routerTypeHandler {
 				isRunable = true
-				routerInfo.handler.ServeHTTP(rw, r)
 			} else {
 				runrouter = routerInfo.controllerType
 				method := r.Method
@@ -805,6 +1093,9 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 				if r.Method == "POST" && context.Input.Query("_method") == "DELETE" {
 					method = "DELETE"
 				}
+				if headAsGet {
+					method = "GET"
+				}
 				if m, ok := routerInfo.methods[method]; ok {
 					runMethod = m
 				} else if m, ok = routerInfo.methods["*"]; ok {
@@ -815,8 +1106,19 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		// also defined runrouter & runMethod from filter
-		if !isRunable {
+		// execute runs the matched router, route middlewares are wrapped around it.
+		// out tracks whether the response has been started by the controller.
+		execute := func(rw http.ResponseWriter, req *http.Request, out *responseWriter) {
+			if isRunable {
+				if routerInfo.routerType == routerTypeRESTFul {
+					routerInfo.runfunction(context)
+				} else {
+					routerInfo.handler.ServeHTTP(rw, req)
+				}
+				return
+			}
+
+			// also defined runrouter & runMethod from filter
 			//Invoke the request handler
 			vc := reflect.New(runrouter)
 			execController, ok := vc.Interface().(ControllerInterface)
@@ -831,7 +1133,7 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			execController.Prepare()
 
 			//if XSRF is Enable then check cookie where there has any cookie in the  request's cookie _csrf
-			if EnableXSRF {
+			if cfg.EnableXSRF {
 				execController.XsrfToken()
 				if r.Method == "POST" || r.Method == "DELETE" || r.Method == "PUT" ||
 					(r.Method == "POST" && (context.Input.Query("_method") == "DELETE" || context.Input.Query("_method") == "PUT")) {
@@ -841,7 +1143,7 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 
 			execController.URLMapping()
 
-			if !w.started {
+			if !out.started {
 				//exec main logic
 				switch runMethod {
 				case "GET":
@@ -867,8 +1169,8 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 				}
 
 				//render template
-				if !w.started && context.Output.Status == 0 {
-					if AutoRender {
+				if !out.started && context.Output.Status == 0 {
+					if cfg.AutoRender {
 						if err := execController.Render(); err != nil {
 							panic(err)
 						}
@@ -880,6 +1182,23 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			execController.Finish()
 		}
 
+		if routerInfo != nil && len(routerInfo.middlewares) > 0 {
+			// 中间件可能替换 ResponseWriter 和 Request, 执行时同步到context中
+			h := buildMiddlewares(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				out := &responseWriter{writer: rw}
+				context.ResponseWriter = out
+				context.Request = req
+				context.Input.Request = req
+				execute(rw, req, out)
+			}), routerInfo.middlewares)
+			h.ServeHTTP(w, r)
+			context.ResponseWriter = w
+			context.Request = r
+			context.Input.Request = r
+		} else {
+			execute(w.writer, r, w)
+		}
+
 		//execute middleware filters
 		if do_filter(AfterExec) {
 			goto Admin
@@ -893,17 +1212,31 @@ Admin:
 	//admin module record QPS
 	// 统计QPS
 	if EnableAdmin {
+		// 按路由的pattern统计, 而不是url, 避免带参数的路由撑爆统计
+		var route string
+		switch {
+		case routerInfo != nil:
+			route = routerInfo.pattern
+		case runrouter != nil:
+			route = runrouter.Name()
+		case findrouter:
+			route = "static"
+		default:
+			route = "notfound"
+		}
+		status := responseStatus(context, w)
 		if FilterMonitorFunc(r.Method, r.URL.Path, timeend) {
 			if runrouter != nil {
-				go toolbox.StatisticsMap.AddStatistics(r.Method, r.URL.Path, runrouter.Name(), timeend)
+				go toolbox.StatisticsMap.AddRequest(r.Method, route, runrouter.Name(), status, timeend)
 			} else {
-				go toolbox.StatisticsMap.AddStatistics(r.Method, r.URL.Path, "", timeend)
+				go toolbox.StatisticsMap.AddRequest(r.Method, route, "", status, timeend)
 			}
 		}
+		observeRequest(r.Method, route, status, timeend)
 	}
 
 	// 打印AccessLogs
-	if RunMode == "dev" || AccessLogs {
+	if cfg.RunMode == "dev" || cfg.AccessLogs {
 		var devinfo string
 		if findrouter {
 			if routerInfo != nil {
@@ -915,7 +1248,15 @@ Admin:
 			devinfo = fmt.Sprintf("| % -10s | % -40s | % -16s | % -10s |", r.Method, r.URL.Path, timeend.String(), "notmatch")
 		}
 		if DefaultLogFilter == nil || !DefaultLogFilter.Filter(context) {
-			Debug(devinfo)
+			if cfg.AccessLogsFormat != "" {
+				var route string
+				if routerInfo != nil {
+					route = routerInfo.pattern
+				}
+				writeAccessLog(newAccessLogRecord(context, w, starttime, timeend, route), cfg.AccessLogsFormat)
+			} else {
+				Debug(devinfo)
+			}
 		}
 	}
 
@@ -925,16 +1266,110 @@ Admin:
 	}
 }
 
+// findRouter matches the url in the router tree of the http method,
+// the routers whose conditions fail are skipped.
+// the params of the matched router are added to the context.
+func (p *ControllerRegistor) findRouter(method, urlPath string, context *beecontext.Context) *controllerInfo {
+	t, ok := p.routers[method]
+	if !ok {
+		return nil
+	}
+	// 检查router上的条件(host, header, accept等), 不满足的router跳过
+	runObject, params := t.MatchWith(urlPath, acceptConds(context))
+	routerInfo, ok := runObject.(*controllerInfo)
+	if !ok {
+		return nil
+	}
+	if splat, ok := params[":splat"]; ok {
+		splatlist := strings.Split(splat, "/")
+		for k, v := range splatlist {
+			params[strconv.Itoa(k)] = v
+		}
+	}
+	for k, v := range params {
+		context.Input.Params[k] = v
+	}
+	return routerInfo
+}
+
+// routePatternKey stores the pattern of the router matching the request in Input.Data.
+type routePatternKey struct{}
+
+// RoutePattern returns the pattern of the router matching the request, such as /user/:id,
+// it's empty if no router matches. It works in the filters before the router too.
+func RoutePattern(ctx *beecontext.Context) string {
+	if pattern, ok := ctx.Input.GetData(routePatternKey{}).(string); ok {
+		return pattern
+	}
+	p, ok := ctx.Input.GetData(registorKey{}).(*ControllerRegistor)
+	if !ok {
+		return ""
+	}
+	urlPath := ctx.Request.URL.Path
+	if !p.conf().RouterCaseSensitive {
+		urlPath = strings.ToLower(urlPath)
+	}
+	methods := []string{ctx.Request.Method}
+	if ctx.Request.Method == "HEAD" {
+		// HEAD 由 GET 的router处理
+		methods = append(methods, "GET")
+	}
+	for _, method := range methods {
+		if t, ok := p.routers[method]; ok {
+			runObject, _ := t.MatchWith(urlPath, acceptConds(ctx))
+			if routerInfo, ok := runObject.(*controllerInfo); ok {
+				ctx.Input.SetData(routePatternKey{}, routerInfo.pattern)
+				return routerInfo.pattern
+			}
+		}
+	}
+	return ""
+}
+
+// acceptConds accepts the routers whose conditions are satisfied by the request.
+func acceptConds(context *beecontext.Context) func(interface{}) bool {
+	return func(o interface{}) bool {
+		c, ok := o.(*controllerInfo)
+		return !ok || c.checkConds(context)
+	}
+}
+
+// allowedMethods returns the http methods having a router which matches the url,
+// HEAD is allowed with GET and OPTIONS is always allowed.
+func (p *ControllerRegistor) allowedMethods(urlPath string, context *beecontext.Context) []string {
+	var allow []string
+	has := make(map[string]bool)
+	for method, t := range p.routers {
+		runObject, _ := t.MatchWith(urlPath, acceptConds(context))
+		if _, ok := runObject.(*controllerInfo); ok {
+			allow = append(allow, method)
+			has[method] = true
+		}
+	}
+	if len(allow) == 0 {
+		return nil
+	}
+	if has["GET"] && !has["HEAD"] {
+		allow = append(allow, "HEAD")
+	}
+	if !has["OPTIONS"] {
+		allow = append(allow, "OPTIONS")
+	}
+	sort.Strings(allow)
+	return allow
+}
+
 func (p *ControllerRegistor) recoverPanic(context *beecontext.Context) {
 	if err := recover(); err != nil {
 		if err == USERSTOPRUN {
 			return
 		}
-		if !RecoverPanic {
+		cfg := p.conf()
+		if !cfg.RecoverPanic {
 			panic(err)
 		} else {
-			if ErrorsShow {
-				if _, ok := ErrorMaps[fmt.Sprint(err)]; ok {
+			if cfg.ErrorsShow {
+				if _, ok := lookupErrorHandler(fmt.Sprint(err), context); ok {
 					exception(fmt.Sprint(err), context)
 					return
 				}
@@ -950,7 +1385,9 @@ func (p *ControllerRegistor) recoverPanic(context *beecontext.Context) {
 				Critical(fmt.Sprintf("%s:%d", file, line))
 				stack = stack + fmt.Sprintln(fmt.Sprintf("%s:%d", file, line))
 			}
-			if RunMode == "dev" {
+			if isProblem(context) {
+				writeProblem(context, panicProblem(err, cfg.RunMode))
+			} else if cfg.RunMode == "dev" {
 				showErr(err, context, stack)
 			}
 		}
@@ -963,6 +1400,7 @@ type responseWriter struct {
 	writer  http.ResponseWriter
 	started bool
 	status  int
+	size    int64 // the bytes of the body written
 }
 
 // Header returns the header map that will be sent by WriteHeader.
@@ -975,7 +1413,9 @@ func (w *responseWriter) Header() http.Header {
 // started means the response has sent out.
 func (w *responseWriter) Write(p []byte) (int, error) {
 	w.started = true
-	return w.writer.Write(p)
+	n, err := w.writer.Write(p)
+	w.size += int64(n)
+	return n, err
 }
 
 // WriteHeader sends an HTTP response header with status code,
@@ -987,13 +1427,35 @@ func (w *responseWriter) WriteHeader(code int) {
 	w.writer.WriteHeader(code)
 }
 
+// Flush sends the buffered data to the client, it's used by the streaming responses.
+func (w *responseWriter) Flush() {
+	if f, ok := w.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// headResponseWriter discards the body written to the response of HEAD request.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
 // hijacker for http
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hj, ok := w.writer.(http.Hijacker)
 	if !ok {
 		return nil, nil, errors.New("webserver doesn't support hijacking")
 	}
-	return hj.Hijack()
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		// the connection is taken over, such as the websocket, nothing else is written
+		w.started = true
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
 }
 
 // ToUrl
@@ -15,10 +15,14 @@
 package beego
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/astaxie/beego/context"
 )
@@ -579,3 +583,329 @@ func beegoFinishRouter1(ctx *context.Context) {
 func beegoFinishRouter2(ctx *context.Context) {
 	ctx.WriteString("|FinishRouter2")
 }
+
+func beegoMiddleWare(name string) MiddleWare {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte("|" + name + "Before"))
+			next.ServeHTTP(rw, r)
+			rw.Write([]byte("|" + name + "After"))
+		})
+	}
+}
+
+func TestRouteMiddleWare(t *testing.T) {
+	mux := NewControllerRegister()
+	mux.Get("/middleware", func(ctx *context.Context) {
+		ctx.WriteString("|hello")
+	}).Use(beegoMiddleWare("m1"), beegoMiddleWare("m2"))
+	mux.Add("/middleware/controller", &TestController{}, "get:List").Use(beegoMiddleWare("m1"))
+
+	rw, r := testRequest("GET", "/middleware")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "|m1Before|m2Before|hello|m2After|m1After" {
+		t.Errorf("TestRouteMiddleWare get the response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("GET", "/middleware/controller")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "|m1Beforei am list|m1After" {
+		t.Errorf("TestRouteMiddleWare get the controller response " + rw.Body.String())
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	mux := NewControllerRegister()
+	mux.Get("/timeout", func(ctx *context.Context) {
+		if _, ok := ctx.RequestContext().Deadline(); !ok {
+			ctx.WriteString("no deadline")
+			return
+		}
+		<-ctx.RequestContext().Done()
+		ctx.WriteString(ctx.RequestContext().Err().Error())
+	}).Timeout(10 * time.Millisecond)
+
+	rw, r := testRequest("GET", "/timeout")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "context deadline exceeded" {
+		t.Errorf("TestRouteTimeout get the response " + rw.Body.String())
+	}
+}
+
+func TestRouteCond(t *testing.T) {
+	mux := NewControllerRegister()
+	mux.Get("/cond", func(ctx *context.Context) {
+		ctx.WriteString("v2")
+	}).Header("X-Version", "2")
+	mux.Get("/cond", func(ctx *context.Context) {
+		ctx.WriteString("csv")
+	}).Accept("text/csv")
+	mux.Get("/cond", func(ctx *context.Context) {
+		ctx.WriteString("api")
+	}).Host("*.beego.me")
+
+	rw, r := testRequest("GET", "/cond")
+	r.Header.Set("X-Version", "2")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "v2" {
+		t.Errorf("TestRouteCond header get the response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("GET", "/cond")
+	r.Header.Set("Accept", "text/html, text/*;q=0.8")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "csv" {
+		t.Errorf("TestRouteCond accept get the response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("GET", "/cond")
+	r.Host = "api.beego.me:8080"
+	r.Header.Set("Accept", "application/json")
+	mux.ServeHTTP(rw, r)
+	if rw.Body.String() != "api" {
+		t.Errorf("TestRouteCond host get the response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("GET", "/cond")
+	r.Host = "beego.me"
+	r.Header.Set("Accept", "application/json")
+	mux.ServeHTTP(rw, r)
+	if rw.Code != 404 {
+		t.Errorf("TestRouteCond should return 404, get the code " + strconv.Itoa(rw.Code))
+	}
+}
+
+func TestHostRouter(t *testing.T) {
+	mux := NewControllerRegister()
+	mux.Get("/", func(ctx *context.Context) {
+		ctx.WriteString("default")
+	})
+	mux.Host("api.beego.me").Get("/", func(ctx *context.Context) {
+		ctx.WriteString("api")
+	})
+	tenant := mux.Host(":tenant.beego.me")
+	tenant.Get("/", func(ctx *context.Context) {
+		ctx.WriteString("tenant " + ctx.Input.Param(":tenant"))
+	})
+	tenant.ErrorHandler("404", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("tenant not found"))
+	})
+
+	for host, body := range map[string]string{
+		"beego.me":          "default",
+		"api.beego.me:8080": "api",
+		"astaxie.beego.me":  "tenant astaxie",
+	} {
+		rw, r := testRequest("GET", "/")
+		r.Host = host
+		mux.ServeHTTP(rw, r)
+		if rw.Body.String() != body {
+			t.Errorf("TestHostRouter " + host + " get the response " + rw.Body.String())
+		}
+	}
+
+	rw, r := testRequest("GET", "/notexist")
+	r.Host = "astaxie.beego.me"
+	mux.ServeHTTP(rw, r)
+	if rw.Code != 404 || rw.Body.String() != "tenant not found" {
+		t.Errorf("TestHostRouter get the 404 response " + rw.Body.String())
+	}
+}
+
+func TestUrlForNamed(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Get("/user/:id:int", func(ctx *context.Context) {}).Name("user.show")
+	handler.Post("/v1/cms_:id(.+)_:page(.+).html", func(ctx *context.Context) {}).Name("cms")
+	handler.Any("/blog/?:year/*", func(ctx *context.Context) {}).Name("blog")
+
+	for name, c := range map[string]struct {
+		params []interface{}
+		url    string
+	}{
+		"user.show": {[]interface{}{":id", 12}, "/user/12"},
+		"cms":       {[]interface{}{":id", "12", ":page", "3"}, "/v1/cms_12_3.html"},
+		"blog":      {[]interface{}{":splat", "a/b", "lang", "go"}, "/blog/a/b?lang=go"},
+	} {
+		if a := handler.UrlFor(name, c.params...); a != c.url {
+			t.Errorf("TestUrlForNamed " + name + " must equal to " + c.url + ", but get " + a)
+		}
+	}
+	if a := handler.UrlFor("user.show"); a != "" {
+		t.Errorf("TestUrlForNamed without the required param must be empty, but get " + a)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Add("/person/:last/:first", &TestController{}, "get:Param;post:List")
+	handler.Get("/user/:id", func(ctx *context.Context) {}).Name("user.show")
+	handler.InsertFilter("/user/*", BeforeRouter, func(ctx *context.Context) {})
+	handler.Host("api.beego.me").Handler("/ws", http.NotFoundHandler())
+
+	routes := handler.Routes()
+	if len(routes) != 3+len(HTTPMETHOD) {
+		t.Fatalf("TestRoutes get %d routes", len(routes))
+	}
+	r := routes[0]
+	if r.Method != "GET" || r.Pattern != "/person/:last/:first" || r.Type != "controller" ||
+		r.Controller != "beego.TestController" || r.Action != "Param" {
+		t.Errorf("TestRoutes get the controller route %+v", r)
+	}
+	if r := routes[1]; r.Method != "POST" || r.Action != "List" {
+		t.Errorf("TestRoutes get the controller route %+v", r)
+	}
+	r = routes[2]
+	if r.Method != "GET" || r.Name != "user.show" || r.Type != "func" ||
+		len(r.Filters) != 1 || r.Filters[0].Position != BeforeRouter || r.Filters[0].Pattern != "/user/*" {
+		t.Errorf("TestRoutes get the func route %+v", r)
+	}
+	r = routes[3]
+	if r.Host != "api.beego.me" || r.Type != "handler" || r.Controller != "http.HandlerFunc" {
+		t.Errorf("TestRoutes get the handler route %+v", r)
+	}
+}
+
+func TestAutoHeadOptions(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Get("/rest", func(ctx *context.Context) {
+		ctx.Output.Header("X-Rest", "get")
+		ctx.WriteString("body")
+	})
+	handler.Post("/rest", func(ctx *context.Context) {})
+	handler.Add("/person/:last/:first", &TestController{}, "get:Param")
+
+	rw, r := testRequest("DELETE", "/rest")
+	handler.ServeHTTP(rw, r)
+	if rw.Code != 405 || rw.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("TestAutoHeadOptions DELETE get the code " + strconv.Itoa(rw.Code) + " Allow: " + rw.Header().Get("Allow"))
+	}
+
+	rw, r = testRequest("OPTIONS", "/person/anderson/thomas")
+	handler.ServeHTTP(rw, r)
+	if rw.Code != 200 || rw.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("TestAutoHeadOptions OPTIONS get the code " + strconv.Itoa(rw.Code) + " Allow: " + rw.Header().Get("Allow"))
+	}
+
+	rw, r = testRequest("HEAD", "/rest")
+	handler.ServeHTTP(rw, r)
+	if rw.Code != 200 || rw.Header().Get("X-Rest") != "get" || rw.Body.Len() != 0 {
+		t.Errorf("TestAutoHeadOptions HEAD get the response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("HEAD", "/person/anderson/thomas")
+	handler.ServeHTTP(rw, r)
+	if rw.Code != 200 || rw.Body.Len() != 0 {
+		t.Errorf("TestAutoHeadOptions HEAD get the controller response " + rw.Body.String())
+	}
+
+	rw, r = testRequest("DELETE", "/notexist")
+	handler.ServeHTTP(rw, r)
+	if rw.Code != 404 {
+		t.Errorf("TestAutoHeadOptions get the code " + strconv.Itoa(rw.Code) + " for the not exist url")
+	}
+}
+
+type getController struct {
+	Controller
+}
+
+func (c *getController) Get() {
+	c.Ctx.Output.Header("X-Get", "get")
+	c.Ctx.WriteString("get")
+}
+
+// Get is promoted from getController
+type embeddedGetController struct {
+	getController
+}
+
+func TestAutoHeadOptionsController(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Add("/get", &getController{})
+	handler.Add("/embedded", &embeddedGetController{})
+
+	for _, url := range []string{"/get", "/embedded"} {
+		rw, r := testRequest("GET", url)
+		handler.ServeHTTP(rw, r)
+		if rw.Code != 200 || rw.Body.String() != "get" {
+			t.Errorf("GET %s get the code %d %q", url, rw.Code, rw.Body.String())
+		}
+
+		rw, r = testRequest("HEAD", url)
+		handler.ServeHTTP(rw, r)
+		if rw.Code != 200 || rw.Header().Get("X-Get") != "get" || rw.Body.Len() != 0 {
+			t.Errorf("HEAD %s get the code %d %q", url, rw.Code, rw.Body.String())
+		}
+
+		rw, r = testRequest("OPTIONS", url)
+		handler.ServeHTTP(rw, r)
+		if rw.Code != 200 || rw.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("OPTIONS %s get the code %d Allow: %s", url, rw.Code, rw.Header().Get("Allow"))
+		}
+
+		rw, r = testRequest("DELETE", url)
+		handler.ServeHTTP(rw, r)
+		if rw.Code != 405 || rw.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("DELETE %s get the code %d Allow: %s", url, rw.Code, rw.Header().Get("Allow"))
+		}
+	}
+
+	if overridesMethod(reflect.TypeOf(&embeddedGetController{}), "Post") {
+		t.Errorf("the Post of Controller is counted as overridden")
+	}
+}
+
+type problemController struct {
+	Controller
+}
+
+func (c *problemController) Get() {
+	c.Abort("401")
+}
+
+func (c *problemController) Post() {
+	var u struct {
+		Name string `form:"name" valid:"Required"`
+	}
+	if err := c.BindBody(&u); err != nil {
+		c.AbortProblem(422, err)
+	}
+}
+
+func TestProblemJson(t *testing.T) {
+	ErrorsProblemJson = true
+	defer func() { ErrorsProblemJson = false }()
+
+	handler := NewControllerRegister()
+	handler.Add("/problem", &problemController{}, "get:Get;post:Post")
+	handler.Get("/panic", func(ctx *context.Context) {
+		panic("something wrong")
+	})
+
+	for _, c := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/notexist", 404},
+		{"DELETE", "/problem", 405},
+		{"GET", "/problem", 401},
+		{"POST", "/problem", 422},
+		{"GET", "/panic", 500},
+	} {
+		rw, r := testRequest(c.method, c.path)
+		r.Header.Set("X-Request-Id", "req-1")
+		handler.ServeHTTP(rw, r)
+		var pb Problem
+		if err := json.Unmarshal(rw.Body.Bytes(), &pb); err != nil {
+			t.Errorf("TestProblemJson %s %s get the body %s", c.method, c.path, rw.Body.String())
+			continue
+		}
+		if rw.Code != c.status || rw.Header().Get("Content-Type") != "application/problem+json" ||
+			pb.Status != c.status || pb.Title != http.StatusText(c.status) || pb.Instance != c.path || pb.TraceId != "req-1" {
+			t.Errorf("TestProblemJson %s %s get %d %+v", c.method, c.path, rw.Code, pb)
+		}
+		if c.status == 422 && (len(pb.Errors) != 1 || pb.Errors[0].Field != "Name") {
+			t.Errorf("TestProblemJson get the field errors %+v", pb.Errors)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/astaxie/beego/utils"
+)
+
+// RouteInfo describes a registered router rule for one http method.
+type RouteInfo struct {
+	Method     string        // http method, upper case
+	Pattern    string        // router pattern, including the Namespace prefix
+	Name       string        // name set by Route.Name
+	Host       string        // host pattern, empty for the default host
+	Namespace  string        // Namespace prefix
+	Type       string        // "controller", "func" or "handler"
+	Controller string        // controller type, func name or handler type
+	Action     string        // controller method serving the http method
+	Filters    []RouteFilter // filters applied to the pattern
+}
+
+// RouteFilter describes a filter applied to a route.
+type RouteFilter struct {
+	Position int    // BeforeStatic, BeforeRouter, BeforeExec, AfterExec or FinishRouter
+	Pattern  string // filter pattern
+	Func     string // filter func name
+}
+
+// Routes returns the descriptors of all the registered router rules,
+// sorted by pattern and method, the routes of the host routers follow the default ones.
+// usage:
+//	for _, r := range beego.BeeApp.Handlers.Routes() {
+//		fmt.Println(r.Method, r.Pattern, r.Controller, r.Action)
+//	}
+func (p *ControllerRegistor) Routes() []RouteInfo {
+	routes := p.routes("")
+	for _, h := range p.hosts {
+		routes = append(routes, h.handlers.routes(h.pattern)...)
+	}
+	return routes
+}
+
+func (p *ControllerRegistor) routes(host string) []RouteInfo {
+	var routes []RouteInfo
+	for method, t := range p.routers {
+		infos := make(map[*controllerInfo]bool)
+		collectRoutes(t, infos)
+		for c := range infos {
+			routes = append(routes, p.routeInfo(method, host, c))
+		}
+	}
+	sort.Sort(routeInfos(routes))
+	return routes
+}
+
+func (p *ControllerRegistor) routeInfo(method, host string, c *controllerInfo) RouteInfo {
+	r := RouteInfo{
+		Method:    method,
+		Pattern:   c.pattern,
+		Name:      c.name,
+		Host:      host,
+		Namespace: c.namespace,
+	}
+	switch c.routerType {
+	case routerTypeBeego:
+		r.Type = "controller"
+		r.Controller = c.controllerType.String()
+		if m, ok := c.methods[method]; ok {
+			r.Action = m
+		} else if m, ok := c.methods["*"]; ok {
+			r.Action = m
+		} else {
+			r.Action = strings.Title(strings.ToLower(method))
+		}
+	case routerTypeRESTFul:
+		r.Type = "func"
+		r.Controller = utils.GetFuncName(c.runfunction)
+	case routerTypeHandler:
+		r.Type = "handler"
+		r.Controller = fmt.Sprintf("%T", c.handler)
+	}
+	if p.enableFilter {
+		pattern := c.pattern
+		if !p.conf().RouterCaseSensitive {
+			pattern = strings.ToLower(pattern)
+		}
+		for pos := BeforeStatic; pos <= FinishRouter; pos++ {
+			for _, f := range p.filters[pos] {
+				if ok, _ := f.ValidRouter(pattern); ok {
+					r.Filters = append(r.Filters, RouteFilter{Position: pos, Pattern: f.pattern, Func: utils.GetFuncName(f.filterFunc)})
+				}
+			}
+		}
+	}
+	return r
+}
+
+type routeInfos []RouteInfo
+
+func (r routeInfos) Len() int      { return len(r) }
+func (r routeInfos) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r routeInfos) Less(i, j int) bool {
+	if r[i].Pattern != r[j].Pattern {
+		return r[i].Pattern < r[j].Pattern
+	}
+	return r[i].Method < r[j].Method
+}
+
+// namedRoute finds the route named by Route.Name.
+func (p *ControllerRegistor) namedRoute(name string) *controllerInfo {
+	for _, t := range p.routers {
+		infos := make(map[*controllerInfo]bool)
+		collectRoutes(t, infos)
+		for c := range infos {
+			if c.name == name {
+				return c
+			}
+		}
+	}
+	for _, h := range p.hosts {
+		if c := h.handlers.namedRoute(name); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// urlFromPattern fills the params into the router pattern,
+// the params not used by the pattern are appended as query string.
+// false is returned if a required param is missing.
+func urlFromPattern(pattern string, params map[string]string) (string, bool) {
+	var segs []string
+	for _, seg := range splitPath(pattern) {
+		switch {
+		case seg == "*":
+			v, ok := params[":splat"]
+			if !ok {
+				return "", false
+			}
+			delete(params, ":splat")
+			segs = append(segs, v)
+		case seg == "*.*":
+			p, ok := params[":path"]
+			e, ok2 := params[":ext"]
+			if !ok || !ok2 {
+				return "", false
+			}
+			delete(params, ":path")
+			delete(params, ":ext")
+			segs = append(segs, p+"."+e)
+		case strings.Contains(seg, ":"):
+			s, ok := fillSegment(seg, params)
+			if !ok {
+				return "", false
+			}
+			if s != "" {
+				segs = append(segs, s)
+			}
+		default:
+			segs = append(segs, seg)
+		}
+	}
+	return "/" + strings.Join(segs, "/") + tourl(params), true
+}
+
+// fillSegment replaces the params of one pattern segment,
+// like ":id", ":id:int", ":id([0-9]+)", "?:id" or "cms_:id.html".
+func fillSegment(seg string, params map[string]string) (string, bool) {
+	var out []byte
+	optional := false
+	for i := 0; i < len(seg); {
+		switch {
+		case seg[i] == '?' && i+1 < len(seg) && seg[i+1] == ':':
+			optional = true
+			i++
+		case seg[i] == ':':
+			j := i + 1
+			for j < len(seg) && isParamChar(seg[j]) {
+				j++
+			}
+			name := ":" + seg[i+1:j]
+			if j < len(seg) && seg[j] == ':' {
+				if typ, _ := matchParamType(seg[j+1:]); typ != "" {
+					j += 1 + len(typ)
+				}
+			} else if j < len(seg) && seg[j] == '(' {
+				for depth := 0; j < len(seg); j++ {
+					if seg[j] == '(' {
+						depth++
+					} else if seg[j] == ')' {
+						depth--
+						if depth == 0 {
+							j++
+							break
+						}
+					}
+				}
+			}
+			v, ok := params[name]
+			if !ok && !optional {
+				return "", false
+			}
+			delete(params, name)
+			out = append(out, v...)
+			i = j
+		default:
+			out = append(out, seg[i])
+			i++
+		}
+	}
+	return string(out), true
+}
+
+func isParamChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
@@ -15,119 +15,335 @@
 package beego
 
 import (
+	"fmt"
+	"hash/fnv"
+	"io"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/astaxie/beego/context"
-	"github.com/astaxie/beego/utils"
 )
 
-func serverStaticRouter(ctx *context.Context) {
+// the precompressed siblings of the static files, like app.js.br and app.js.gz, in order of preference
+var precompressedExts = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func serverStaticRouter(ctx *context.Context, cfg *Settings) {
 	// Static文件只支持两种模式: GET/HEAD
 	if ctx.Input.Method() != "GET" && ctx.Input.Method() != "HEAD" {
 		return
 	}
 	requestPath := path.Clean(ctx.Input.Request.URL.Path)
+	prefixes := staticPrefixes(cfg)
 
-	i := 0
-	for prefix, staticDir := range StaticDir {
-		if len(prefix) == 0 {
-			continue
-		}
-		if requestPath == "/favicon.ico" || requestPath == "/robots.txt" {
-			file := path.Join(staticDir, requestPath)
-			if utils.FileExists(file) {
-				// 发现了： static file, 则直接返回
-				http.ServeFile(ctx.ResponseWriter, ctx.Request, file)
-				return
-			} else {
-				i++
-				// 没有发现文件
-				if i == len(StaticDir) {
-					http.NotFound(ctx.ResponseWriter, ctx.Request)
+	if requestPath == "/favicon.ico" || requestPath == "/robots.txt" {
+		for _, prefix := range prefixes {
+			fs := staticFileSystem(cfg, prefix)
+			if f, finfo, err := openStaticFile(fs, requestPath); err == nil {
+				defer f.Close()
+				if !finfo.IsDir() {
+					// 发现了： static file, 则直接返回
+					serveStaticFile(ctx, cfg, prefix, fs, requestPath, f, finfo)
 					return
-				} else {
-					continue
 				}
 			}
 		}
-		if strings.HasPrefix(requestPath, prefix) {
-			// prefix必须是完整的prefix
-			// 例如:
-			//    /static/1.jpg
-			//    /static 是有效的prefix
-			//    /st 不是有效的prefix
-			if len(requestPath) > len(prefix) && requestPath[len(prefix)] != '/' {
-				continue
-			}
+		// 没有发现文件
+		if len(prefixes) > 0 {
+			http.NotFound(ctx.ResponseWriter, ctx.Request)
+		}
+		return
+	}
 
-			// 如果 prefix 匹配了，那么就认为 staticDir应该就是唯一的了
-			file := path.Join(staticDir, requestPath[len(prefix):])
-			finfo, err := os.Stat(file)
-			if err != nil {
-				if RunMode == "dev" {
-					Warn("Can't find the file:", file, err)
-				}
-				http.NotFound(ctx.ResponseWriter, ctx.Request)
-				return
+	// 最长的prefix优先
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(requestPath, prefix) {
+			continue
+		}
+		// prefix必须是完整的prefix
+		// 例如:
+		//    /static/1.jpg
+		//    /static 是有效的prefix
+		//    /st 不是有效的prefix
+		if len(requestPath) > len(prefix) && requestPath[len(prefix)] != '/' {
+			continue
+		}
+
+		// 如果 prefix 匹配了，那么就认为 staticDir应该就是唯一的了
+		fs := staticFileSystem(cfg, prefix)
+		name := "/" + strings.TrimLeft(requestPath[len(prefix):], "/")
+		f, finfo, err := openStaticFile(fs, name)
+
+		// 单页应用: 没有扩展名的未知路径都返回 index.html
+		if fallback := cfg.StaticFallback[prefix]; fallback != "" && path.Ext(name) == "" && (err != nil || finfo.IsDir()) {
+			if err == nil {
+				f.Close()
 			}
-			//if the request is dir and DirectoryIndex is false then
-			if finfo.IsDir() {
-				if !DirectoryIndex {
-					exception("403", ctx)
-					return
-				} else if ctx.Input.Request.URL.Path[len(ctx.Input.Request.URL.Path)-1] != '/' {
-					http.Redirect(ctx.ResponseWriter, ctx.Request, ctx.Input.Request.URL.Path+"/", 302)
-					return
-				}
-			} else if strings.HasSuffix(requestPath, "/index.html") {
-				// index.html的处理
-				file := path.Join(staticDir, requestPath)
-				if utils.FileExists(file) {
-					http.ServeFile(ctx.ResponseWriter, ctx.Request, file)
-					return
-				}
+			name = path.Join("/", fallback)
+			f, finfo, err = openStaticFile(fs, name)
+		}
+		if err != nil {
+			if cfg.RunMode == "dev" {
+				Warn("Can't find the file:", prefix+name, err)
 			}
+			http.NotFound(ctx.ResponseWriter, ctx.Request)
+			return
+		}
+		defer f.Close()
 
-			//This block obtained from (https://github.com/smithfox/beego) - it should probably get merged into astaxie/beego after a pull request
-			isStaticFileToCompress := false
-			if StaticExtensionsToGzip != nil && len(StaticExtensionsToGzip) > 0 {
-				for _, statExtension := range StaticExtensionsToGzip {
-					if strings.HasSuffix(strings.ToLower(file), strings.ToLower(statExtension)) {
-						isStaticFileToCompress = true
-						break
-					}
-				}
+		//if the request is dir and DirectoryIndex is false then
+		if finfo.IsDir() {
+			if !cfg.DirectoryIndex {
+				exception("403", ctx)
+				return
+			} else if ctx.Input.Request.URL.Path[len(ctx.Input.Request.URL.Path)-1] != '/' {
+				http.Redirect(ctx.ResponseWriter, ctx.Request, ctx.Input.Request.URL.Path+"/", 302)
+				return
 			}
+			// index.html或者目录列表
+			http.StripPrefix(prefix, http.FileServer(fs)).ServeHTTP(ctx.ResponseWriter, ctx.Request)
+			return
+		}
 
-			if isStaticFileToCompress {
-				var contentEncoding string
-				if EnableGzip {
-					contentEncoding = getAcceptEncodingZip(ctx.Request)
-				}
+		serveStaticFile(ctx, cfg, prefix, fs, name, f, finfo)
+		return
+	}
+}
 
-				memzipfile, err := openMemZipFile(file, contentEncoding)
-				if err != nil {
-					return
-				}
+// serveStaticFile serves the file with its ETag and Cache-Control,
+// the precompressed sibling is served if the client accepts its encoding.
+// http.ServeContent answers the conditional requests with 304 and the byte ranges.
+func serveStaticFile(ctx *context.Context, cfg *Settings, prefix string, fs http.FileSystem, name string, f http.File, finfo os.FileInfo) {
+	rw := ctx.ResponseWriter
+	r := ctx.Request
 
-				if contentEncoding == "gzip" {
-					ctx.Output.Header("Content-Encoding", "gzip")
-				} else if contentEncoding == "deflate" {
-					ctx.Output.Header("Content-Encoding", "deflate")
-				} else {
-					ctx.Output.Header("Content-Length", strconv.FormatInt(finfo.Size(), 10))
-				}
+	if cc := staticCacheControl(cfg, prefix+name); cc != "" {
+		rw.Header().Set("Cache-Control", cc)
+	}
+	rw.Header().Add("Vary", "Accept-Encoding")
 
-				http.ServeContent(ctx.ResponseWriter, ctx.Request, file, finfo.ModTime(), memzipfile)
+	// 预压缩的文件: app.js.br, app.js.gz
+	for _, pc := range precompressedExts {
+		if !acceptsEncoding(r, pc.encoding) {
+			continue
+		}
+		cf, cinfo, err := openStaticFile(fs, name+pc.ext)
+		if err != nil {
+			continue
+		}
+		defer cf.Close()
+		if cinfo.IsDir() {
+			continue
+		}
+		etag, err := staticETag(staticCacheKey(fs, name+pc.ext, cinfo), cf, cinfo)
+		if err != nil {
+			continue
+		}
+		rw.Header().Set("ETag", etag)
+		rw.Header().Set("Content-Encoding", pc.encoding)
+		http.ServeContent(rw, r, name, cinfo.ModTime(), cf)
+		return
+	}
 
-			} else {
-				http.ServeFile(ctx.ResponseWriter, ctx.Request, file)
+	key := staticCacheKey(fs, name, finfo)
+	etag, err := staticETag(key, f, finfo)
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	//This block obtained from (https://github.com/smithfox/beego) - it should probably get merged into astaxie/beego after a pull request
+	isStaticFileToCompress := false
+	if cfg.StaticExtensionsToGzip != nil && len(cfg.StaticExtensionsToGzip) > 0 {
+		for _, statExtension := range cfg.StaticExtensionsToGzip {
+			if strings.HasSuffix(strings.ToLower(name), strings.ToLower(statExtension)) {
+				isStaticFileToCompress = true
+				break
 			}
+		}
+	}
+
+	if isStaticFileToCompress {
+		var contentEncoding string
+		if cfg.EnableGzip {
+			contentEncoding = getAcceptEncodingZip(r)
+		}
+
+		memzipfile, err := openMemZipFile(key, f, finfo, contentEncoding)
+		if err != nil {
 			return
 		}
+
+		if contentEncoding == "gzip" || contentEncoding == "deflate" {
+			// the compressed content has its own ETag
+			etag = etag[:len(etag)-1] + "-" + contentEncoding + `"`
+			ctx.Output.Header("Content-Encoding", contentEncoding)
+		} else {
+			ctx.Output.Header("Content-Length", strconv.FormatInt(finfo.Size(), 10))
+		}
+		rw.Header().Set("ETag", etag)
+		http.ServeContent(rw, r, name, finfo.ModTime(), memzipfile)
+		return
+	}
+
+	rw.Header().Set("ETag", etag)
+	http.ServeContent(rw, r, name, finfo.ModTime(), f)
+}
+
+// staticPrefixes returns the url prefixes of StaticDir and StaticFileSystem, the longest first.
+func staticPrefixes(cfg *Settings) []string {
+	prefixes := make([]string, 0, len(cfg.StaticDir)+len(cfg.StaticFileSystem))
+	for prefix := range cfg.StaticDir {
+		if len(prefix) > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	for prefix := range cfg.StaticFileSystem {
+		if _, ok := cfg.StaticDir[prefix]; !ok && len(prefix) > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Sort(sort.Reverse(byLength(prefixes)))
+	return prefixes
+}
+
+type byLength []string
+
+func (s byLength) Len() int      { return len(s) }
+func (s byLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) < len(s[j])
+	}
+	return s[i] < s[j]
+}
+
+// staticFileSystem returns the http.FileSystem of the prefix, StaticFileSystem is preferred to StaticDir.
+func staticFileSystem(cfg *Settings, prefix string) http.FileSystem {
+	if fs, ok := cfg.StaticFileSystem[prefix]; ok {
+		return fs
+	}
+	return http.Dir(cfg.StaticDir[prefix])
+}
+
+func openStaticFile(fs http.FileSystem, name string) (http.File, os.FileInfo, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	finfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, finfo, nil
+}
+
+// staticCacheControl returns the Cache-Control of the longest prefix matching the path.
+func staticCacheControl(cfg *Settings, requestPath string) string {
+	var matched, cacheControl string
+	for prefix, cc := range cfg.StaticCacheControl {
+		if len(prefix) <= len(matched) || !strings.HasPrefix(requestPath, prefix) {
+			continue
+		}
+		if len(requestPath) > len(prefix) && requestPath[len(prefix)] != '/' && prefix != "/" {
+			continue
+		}
+		matched, cacheControl = prefix, cc
+	}
+	return cacheControl
+}
+
+// acceptsEncoding checks if the encoding is in Accept-Encoding and its q isn't 0.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(v, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+			continue
+		}
+		for _, p := range params[1:] {
+			if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+				if f, err := strconv.ParseFloat(q[2:], 64); err == nil && f == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// staticCacheKey returns the key of the file in the caches of the ETags and the compressed contents,
+// it's the source of the file and its name, so the apps serving a prefix from different dirs don't share it.
+// it's empty if the file isn't cachable: the file system isn't comparable or the modtime is unknown.
+func staticCacheKey(fs http.FileSystem, name string, finfo os.FileInfo) string {
+	if finfo.ModTime().IsZero() {
+		return ""
+	}
+	if dir, ok := fs.(http.Dir); ok {
+		if abs, err := filepath.Abs(string(dir)); err == nil {
+			return "dir:" + abs + name
+		}
+		return ""
+	}
+	switch v := reflect.ValueOf(fs); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("fs:%T:%x%s", fs, v.Pointer(), name)
+	}
+	return ""
+}
+
+type staticETagInfo struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+var (
+	staticETags     = make(map[string]*staticETagInfo)
+	staticETagsLock sync.RWMutex
+)
+
+// staticETag returns the ETag of the content hash, it's cached by the key until the file is modified,
+// it's not cached if the key is empty.
+// the file is read from the start after hashing.
+func staticETag(key string, f io.ReadSeeker, finfo os.FileInfo) (string, error) {
+	staticETagsLock.RLock()
+	info, ok := staticETags[key]
+	staticETagsLock.RUnlock()
+	if ok && key != "" && info.modTime.Equal(finfo.ModTime()) && info.size == finfo.Size() {
+		return info.etag, nil
+	}
+
+	h := fnv.New64a()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	info = &staticETagInfo{
+		modTime: finfo.ModTime(),
+		size:    finfo.Size(),
+		etag:    fmt.Sprintf(`"%x-%x"`, finfo.Size(), h.Sum64()),
+	}
+	if key != "" {
+		staticETagsLock.Lock()
+		staticETags[key] = info
+		staticETagsLock.Unlock()
 	}
+	return info.etag, nil
 }
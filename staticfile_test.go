@@ -0,0 +1,234 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newStaticApp(t *testing.T) (*App, string) {
+	dir, err := ioutil.TempDir("", "beego-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "assets"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>spa</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.css"), bytes.Repeat([]byte("body{}"), 100), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("raw js"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "assets", "app.js.br"), []byte("brotli js"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "assets", "app.js.gz"), []byte("gzip js"), 0644)
+
+	cfg := NewSettings()
+	cfg.EnableGzip = true
+	cfg.StaticDir = map[string]string{"/app": dir}
+	cfg.StaticCacheControl = map[string]string{
+		"/app":        "no-cache",
+		"/app/assets": "public, max-age=31536000, immutable",
+	}
+	cfg.StaticFallback = map[string]string{"/app": "index.html"}
+	cfg.StaticFileSystem = map[string]http.FileSystem{
+		"/embed": http.FS(fstest.MapFS{"hello.txt": {Data: []byte("embedded")}}),
+	}
+	return NewAppWithSettings(cfg), dir
+}
+
+func serveStatic(app *App, url string, header map[string]string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	app.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func TestStaticETag(t *testing.T) {
+	app, dir := newStaticApp(t)
+	defer os.RemoveAll(dir)
+
+	w := serveStatic(app, "/app/index.html", nil)
+	etag := w.HeaderMap.Get("ETag")
+	if w.Code != 200 || w.Body.String() != "<html>spa</html>" || etag == "" {
+		t.Fatalf("get %d %q etag %q", w.Code, w.Body.String(), etag)
+	}
+	if cc := w.HeaderMap.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("get Cache-Control %q", cc)
+	}
+	w = serveStatic(app, "/app/index.html", map[string]string{"If-None-Match": etag})
+	if w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match get %d %q, want 304", w.Code, w.Body.String())
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>new spa</html>"), 0644)
+	w = serveStatic(app, "/app/index.html", map[string]string{"If-None-Match": etag})
+	if w.Code != 200 || w.HeaderMap.Get("ETag") == etag {
+		t.Errorf("the modified file get %d etag %q", w.Code, w.HeaderMap.Get("ETag"))
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	app, dir := newStaticApp(t)
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		accept, encoding, body string
+	}{
+		{"gzip, deflate, br", "br", "brotli js"},
+		{"gzip, br;q=0", "gzip", "gzip js"},
+		{"", "", "raw js"},
+	} {
+		w := serveStatic(app, "/app/assets/app.js", map[string]string{"Accept-Encoding": c.accept})
+		if w.Code != 200 || w.Body.String() != c.body || w.HeaderMap.Get("Content-Encoding") != c.encoding {
+			t.Errorf("Accept-Encoding %q get %d %q %q", c.accept, w.Code, w.HeaderMap.Get("Content-Encoding"), w.Body.String())
+		}
+		if ct := w.HeaderMap.Get("Content-Type"); ct != "text/javascript; charset=utf-8" && ct != "application/javascript" {
+			t.Errorf("get Content-Type %q", ct)
+		}
+		if cc := w.HeaderMap.Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+			t.Errorf("get Cache-Control %q", cc)
+		}
+	}
+}
+
+func TestStaticGzipRange(t *testing.T) {
+	app, dir := newStaticApp(t)
+	defer os.RemoveAll(dir)
+
+	w := serveStatic(app, "/app/app.css", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Code != 200 || w.HeaderMap.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("get %d %q", w.Code, w.HeaderMap.Get("Content-Encoding"))
+	}
+	full := w.Body.Bytes()
+	zr, err := gzip.NewReader(bytes.NewReader(full))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, bytes.Repeat([]byte("body{}"), 100)) {
+		t.Errorf("get the gzipped body %q", b)
+	}
+	if w.HeaderMap.Get("ETag") == serveStatic(app, "/app/app.css", nil).HeaderMap.Get("ETag") {
+		t.Errorf("the gzipped content has the same ETag as the raw content")
+	}
+
+	w = serveStatic(app, "/app/app.css", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-9"})
+	if w.Code != 206 || !bytes.Equal(w.Body.Bytes(), full[:10]) {
+		t.Errorf("the range of the gzipped content get %d %q", w.Code, w.Body.Bytes())
+	}
+}
+
+func TestStaticFallbackAndFileSystem(t *testing.T) {
+	app, dir := newStaticApp(t)
+	defer os.RemoveAll(dir)
+
+	for _, url := range []string{"/app", "/app/users/1"} {
+		w := serveStatic(app, url, nil)
+		if w.Code != 200 || w.Body.String() != "<html>spa</html>" {
+			t.Errorf("%s get %d %q, want index.html", url, w.Code, w.Body.String())
+		}
+	}
+	if w := serveStatic(app, "/app/missing.js", nil); w.Code != 404 {
+		t.Errorf("the missing asset get %d, want 404", w.Code)
+	}
+
+	w := serveStatic(app, "/embed/hello.txt", nil)
+	if w.Code != 200 || w.Body.String() != "embedded" || w.HeaderMap.Get("ETag") == "" {
+		t.Errorf("the file of http.FileSystem get %d %q", w.Code, w.Body.String())
+	}
+	if w := serveStatic(app, "/embed/missing.txt", nil); w.Code != 404 {
+		t.Errorf("get %d, want 404", w.Code)
+	}
+}
+
+func TestStaticCacheKeyBySource(t *testing.T) {
+	modTime := time.Unix(1500000000, 0)
+	var apps []*App
+	for _, content := range []string{"first app", "other app"} {
+		dir, err := ioutil.TempDir("", "beego-static")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "app.css")
+		ioutil.WriteFile(file, []byte(content), 0644)
+		os.Chtimes(file, modTime, modTime)
+
+		cfg := NewSettings()
+		cfg.EnableGzip = true
+		cfg.StaticExtensionsToGzip = []string{".css"}
+		cfg.StaticDir = map[string]string{"/app": dir}
+		apps = append(apps, NewAppWithSettings(cfg))
+	}
+
+	// the same prefix, size and modtime in different dirs
+	var etags []string
+	for i, want := range []string{"first app", "other app"} {
+		w := serveStatic(apps[i], "/app/app.css", nil)
+		if w.Body.String() != want {
+			t.Errorf("app %d get %q, want %q", i, w.Body.String(), want)
+		}
+		etags = append(etags, w.HeaderMap.Get("ETag"))
+
+		w = serveStatic(apps[i], "/app/app.css", map[string]string{"Accept-Encoding": "gzip"})
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadAll(zr); string(b) != want {
+			t.Errorf("app %d get the gzip content %q, want %q", i, b, want)
+		}
+	}
+	if etags[0] == etags[1] {
+		t.Errorf("the apps share the ETag %s", etags[0])
+	}
+
+	// the modtime of the file system is unknown
+	fs := http.FS(fstest.MapFS{"a.txt": {Data: []byte("a")}})
+	f, finfo, err := openStaticFile(fs, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if key := staticCacheKey(fs, "/a.txt", finfo); key != "" {
+		t.Errorf("the file without modtime is cached by %q", key)
+	}
+}
+
+func TestStaticCacheControlRoot(t *testing.T) {
+	old := StaticCacheControl
+	StaticCacheControl = make(map[string]string)
+	defer func() { StaticCacheControl = old }()
+
+	SetStaticCacheControl("/", "no-cache")
+	SetStaticCacheControl("static/assets/", "immutable")
+	if StaticCacheControl["/"] != "no-cache" || StaticCacheControl["/static/assets"] != "immutable" {
+		t.Fatalf("get StaticCacheControl %v", StaticCacheControl)
+	}
+	cfg := &Settings{StaticCacheControl: StaticCacheControl}
+	if cc := staticCacheControl(cfg, "/static/app.js"); cc != "no-cache" {
+		t.Errorf("the root Cache-Control get %q", cc)
+	}
+	if cc := staticCacheControl(cfg, "/static/assets/app.js"); cc != "immutable" {
+		t.Errorf("the longest prefix get %q", cc)
+	}
+}
@@ -128,6 +128,11 @@ func AddTemplateExt(ext string) {
 // build all template files in a directory.
 // it makes beego can render any template file in view directory.
 func BuildTemplate(dir string) error {
+	return buildTemplate(dir, BeeTemplates, TemplateLeft, TemplateRight)
+}
+
+// buildTemplate parses the template files in dir with the delimiters into cache.
+func buildTemplate(dir string, cache map[string]*template.Template, left, right string) error {
 	if _, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -148,18 +153,18 @@ func BuildTemplate(dir string) error {
 	}
 	for _, v := range self.files {
 		for _, file := range v {
-			t, err := getTemplate(self.root, file, v...)
+			t, err := getTemplate(self.root, left, right, file, v...)
 			if err != nil {
 				Trace("parse template err:", file, err)
 			} else {
-				BeeTemplates[file] = t
+				cache[file] = t
 			}
 		}
 	}
 	return nil
 }
 
-func getTplDeep(root, file, parent string, t *template.Template) (*template.Template, [][]string, error) {
+func getTplDeep(root, left, file, parent string, t *template.Template) (*template.Template, [][]string, error) {
 	var fileabspath string
 	if filepath.HasPrefix(file, "../") {
 		fileabspath = filepath.Join(root, filepath.Dir(parent), file)
@@ -177,7 +182,7 @@ func getTplDeep(root, file, parent string, t *template.Template) (*template.Temp
 	if err != nil {
 		return nil, [][]string{}, err
 	}
-	reg := regexp.MustCompile(TemplateLeft + "[ ]*template[ ]+\"([^\"]+)\"")
+	reg := regexp.MustCompile(left + "[ ]*template[ ]+\"([^\"]+)\"")
 	allsub := reg.FindAllStringSubmatch(string(data), -1)
 	for _, m := range allsub {
 		if len(m) == 2 {
@@ -188,7 +193,7 @@ func getTplDeep(root, file, parent string, t *template.Template) (*template.Temp
 			if !HasTemplateExt(m[1]) {
 				continue
 			}
-			t, _, err = getTplDeep(root, m[1], file, t)
+			t, _, err = getTplDeep(root, left, m[1], file, t)
 			if err != nil {
 				return nil, [][]string{}, err
 			}
@@ -197,14 +202,14 @@ func getTplDeep(root, file, parent string, t *template.Template) (*template.Temp
 	return t, allsub, nil
 }
 
-func getTemplate(root, file string, others ...string) (t *template.Template, err error) {
-	t = template.New(file).Delims(TemplateLeft, TemplateRight).Funcs(beegoTplFuncMap)
+func getTemplate(root, left, right, file string, others ...string) (t *template.Template, err error) {
+	t = template.New(file).Delims(left, right).Funcs(beegoTplFuncMap)
 	var submods [][]string
-	t, submods, err = getTplDeep(root, file, "", t)
+	t, submods, err = getTplDeep(root, left, file, "", t)
 	if err != nil {
 		return nil, err
 	}
-	t, err = _getTemplate(t, root, submods, others...)
+	t, err = _getTemplate(t, root, left, submods, others...)
 
 	if err != nil {
 		return nil, err
@@ -212,7 +217,7 @@ func getTemplate(root, file string, others ...string) (t *template.Template, err
 	return
 }
 
-func _getTemplate(t0 *template.Template, root string, submods [][]string, others ...string) (t *template.Template, err error) {
+func _getTemplate(t0 *template.Template, root, left string, submods [][]string, others ...string) (t *template.Template, err error) {
 	t = t0
 	for _, m := range submods {
 		if len(m) == 2 {
@@ -224,11 +229,11 @@ func _getTemplate(t0 *template.Template, root string, submods [][]string, others
 			for _, otherfile := range others {
 				if otherfile == m[1] {
 					var submods1 [][]string
-					t, submods1, err = getTplDeep(root, otherfile, "", t)
+					t, submods1, err = getTplDeep(root, left, otherfile, "", t)
 					if err != nil {
 						Trace("template parse file err:", err)
 					} else if submods1 != nil && len(submods1) > 0 {
-						t, err = _getTemplate(t, root, submods1, others...)
+						t, err = _getTemplate(t, root, left, submods1, others...)
 					}
 					break
 				}
@@ -240,16 +245,16 @@ func _getTemplate(t0 *template.Template, root string, submods [][]string, others
 				if err != nil {
 					continue
 				}
-				reg := regexp.MustCompile(TemplateLeft + "[ ]*define[ ]+\"([^\"]+)\"")
+				reg := regexp.MustCompile(left + "[ ]*define[ ]+\"([^\"]+)\"")
 				allsub := reg.FindAllStringSubmatch(string(data), -1)
 				for _, sub := range allsub {
 					if len(sub) == 2 && sub[1] == m[1] {
 						var submods1 [][]string
-						t, submods1, err = getTplDeep(root, otherfile, "", t)
+						t, submods1, err = getTplDeep(root, left, otherfile, "", t)
 						if err != nil {
 							Trace("template parse file err:", err)
 						} else if submods1 != nil && len(submods1) > 0 {
-							t, err = _getTemplate(t, root, submods1, others...)
+							t, err = _getTemplate(t, root, left, submods1, others...)
 						}
 						break
 					}
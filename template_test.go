@@ -15,6 +15,9 @@
 package beego
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -134,3 +137,43 @@ func TestRelativeTemplate(t *testing.T) {
 	}
 	os.RemoveAll(dir)
 }
+
+type viewsController struct {
+	Controller
+}
+
+func (c *viewsController) Get() {
+	c.TplNames = "index.tpl"
+	c.Data["Name"] = "beego"
+}
+
+func TestSettingsViews(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "beego-views")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "site"), 0777)
+	os.MkdirAll(filepath.Join(dir, "admin"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "site", "index.tpl"), []byte("site {{.Name}}"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "admin", "index.tpl"), []byte("admin <<.Name>>"), 0666)
+
+	site := NewSettings()
+	site.RunMode = "prod"
+	site.ViewsPath = filepath.Join(dir, "site")
+	admin := NewSettings()
+	admin.RunMode = "prod"
+	admin.ViewsPath = filepath.Join(dir, "admin")
+	admin.TemplateLeft, admin.TemplateRight = "<<", ">>"
+
+	for body, cfg := range map[string]*Settings{"site beego": site, "admin beego": admin} {
+		if err := cfg.BuildTemplate(); err != nil {
+			t.Fatal(err)
+		}
+		app := NewAppWithSettings(cfg)
+		app.Handlers.Add("/", &viewsController{})
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		app.Handlers.ServeHTTP(w, r)
+		if w.Body.String() != body {
+			t.Errorf("the views of %s render %q", cfg.ViewsPath, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package toolbox
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// the relative accuracy of the quantiles
+	sketchAccuracy = 0.01
+	// the max bins of a sketch, 512 bins cover the values from 1x to about 28000x at 1%
+	sketchMaxBins = 512
+)
+
+var (
+	sketchGamma   = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLnGamma = math.Log(sketchGamma)
+)
+
+// sketch is a streaming quantile sketch with the relative accuracy sketchAccuracy.
+// The values are counted in the logarithmic bins, so its memory is bounded by sketchMaxBins
+// however many values are added, the lowest bins are merged if there're more bins.
+type sketch struct {
+	bins  map[int]int64
+	zero  int64 // the values less than 1
+	count int64
+}
+
+func newSketch() *sketch {
+	return &sketch{bins: make(map[int]int64)}
+}
+
+func (s *sketch) add(v float64) {
+	s.count++
+	if v < 1 {
+		s.zero++
+		return
+	}
+	s.bins[int(math.Ceil(math.Log(v)/sketchLnGamma))]++
+	s.collapse()
+}
+
+func (s *sketch) merge(o *sketch) {
+	if o == nil {
+		return
+	}
+	s.count += o.count
+	s.zero += o.zero
+	for k, n := range o.bins {
+		s.bins[k] += n
+	}
+	s.collapse()
+}
+
+// collapse merges the lowest bins, so the high quantiles stay accurate.
+func (s *sketch) collapse() {
+	if len(s.bins) <= sketchMaxBins {
+		return
+	}
+	keys := s.keys()
+	for _, k := range keys[:len(keys)-sketchMaxBins] {
+		s.bins[keys[len(keys)-sketchMaxBins]] += s.bins[k]
+		delete(s.bins, k)
+	}
+}
+
+func (s *sketch) keys() []int {
+	keys := make([]int, 0, len(s.bins))
+	for k := range s.bins {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// quantile returns the estimated value of the quantile q in [0, 1].
+func (s *sketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int64(q * float64(s.count-1))
+	n := s.zero
+	if rank < n {
+		return 0
+	}
+	for _, k := range s.keys() {
+		n += s.bins[k]
+		if rank < n {
+			return 2 * math.Pow(sketchGamma, float64(k)) / (sketchGamma + 1)
+		}
+	}
+	return 0
+}
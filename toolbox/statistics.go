@@ -16,10 +16,22 @@ package toolbox
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
 
+// OtherRoutes is the route recording the requests of the new routes after UrlMap.LengthLimit is reached.
+const OtherRoutes = "[others]"
+
+// the time windows are kept in the slots, the last minute in 5s slots and the last hour in 1m slots.
+const (
+	fineSlot    = 5 * time.Second
+	fineSlots   = 12
+	coarseSlot  = time.Minute
+	coarseSlots = 60
+)
+
 // Statistics struct
 type Statistics struct {
 	RequestUrl        string
@@ -28,6 +40,41 @@ type Statistics struct {
 	MinTime           time.Duration
 	MaxTime           time.Duration
 	TotalTime         time.Duration
+
+	since  time.Time
+	status map[int]int64
+	sketch *sketch
+	fine   *ring
+	coarse *ring
+}
+
+func newStatistics(requestUrl, requestController string, now time.Time) *Statistics {
+	return &Statistics{
+		RequestUrl:        requestUrl,
+		RequestController: requestController,
+		since:             now,
+		status:            make(map[int]int64),
+		sketch:            newSketch(),
+		fine:              newRing(fineSlot, fineSlots),
+		coarse:            newRing(coarseSlot, coarseSlots),
+	}
+}
+
+func (s *Statistics) add(status int, requesttime time.Duration, now time.Time) {
+	if s.RequestNum == 0 || s.MinTime > requesttime {
+		s.MinTime = requesttime
+	}
+	if s.MaxTime < requesttime {
+		s.MaxTime = requesttime
+	}
+	s.RequestNum += 1
+	s.TotalTime += requesttime
+	if status > 0 {
+		s.status[status]++
+	}
+	s.sketch.add(float64(requesttime))
+	s.fine.add(now, status, requesttime)
+	s.coarse.add(now, status, requesttime)
 }
 
 // UrlMap contains several statistics struct to log different data
@@ -35,82 +82,229 @@ type UrlMap struct {
 	lock        sync.RWMutex
 	LengthLimit int //limit the urlmap's length if it's equal to 0 there's no limit
 	urlmap      map[string]map[string]*Statistics
+
+	now func() time.Time // for the tests
+}
+
+func (m *UrlMap) timeNow() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
 }
 
 // add statistics task.
 // it needs request method, request url, request controller and statistics time duration
 func (m *UrlMap) AddStatistics(requestMethod, requestUrl, requestController string, requesttime time.Duration) {
+	m.AddRequest(requestMethod, requestUrl, requestController, 0, requesttime)
+}
+
+// AddRequest records the request of the route with its status code.
+// the route should be the router pattern like "/user/:id" rather than the url,
+// the new routes are recorded as OtherRoutes once there're LengthLimit routes.
+func (m *UrlMap) AddRequest(requestMethod, route, requestController string, status int, requesttime time.Duration) {
+	now := m.timeNow()
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	// 如何统计呢?
-	// Url --> Method
-	// 如果Url太多，那该怎么处理呢?
-	//
-	if method, ok := m.urlmap[requestUrl]; ok {
-		if s, ok := method[requestMethod]; ok {
-			s.RequestNum += 1
-			if s.MaxTime < requesttime {
-				s.MaxTime = requesttime
+	method, ok := m.urlmap[route]
+	if !ok {
+		if m.LengthLimit > 0 && m.LengthLimit <= len(m.urlmap) {
+			route = OtherRoutes
+			requestController = ""
+		}
+		if method, ok = m.urlmap[route]; !ok {
+			method = make(map[string]*Statistics)
+			m.urlmap[route] = method
+		}
+	}
+	s, ok := method[requestMethod]
+	if !ok {
+		s = newStatistics(route, requestController, now)
+		method[requestMethod] = s
+	}
+	s.add(status, requesttime, now)
+}
+
+// RouteStats is the statistics of a route and method in a time window.
+type RouteStats struct {
+	Route      string        `json:"route"`
+	Method     string        `json:"method"`
+	Controller string        `json:"controller"`
+	Count      int64         `json:"count"`
+	QPS        float64       `json:"qps"`
+	Status     map[int]int64 `json:"status"`
+	Total      time.Duration `json:"-"`
+	Min        time.Duration `json:"-"`
+	Max        time.Duration `json:"-"`
+	Avg        time.Duration `json:"-"`
+	P50        time.Duration `json:"-"`
+	P95        time.Duration `json:"-"`
+	P99        time.Duration `json:"-"`
+
+	// the times in milliseconds for the json
+	TotalMs float64 `json:"total_ms"`
+	MinMs   float64 `json:"min_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// Snapshot returns the statistics of the requests in the last window such as time.Minute,
+// 5*time.Minute or time.Hour, the windows longer than an hour are an hour.
+// window 0 returns the statistics since the start.
+// The result is sorted by the route and the method.
+func (m *UrlMap) Snapshot(window time.Duration) []*RouteStats {
+	now := m.timeNow()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	result := make([]*RouteStats, 0, len(m.urlmap))
+	for k, v := range m.urlmap {
+		for kk, vv := range v {
+			var c counts
+			var elapsed time.Duration
+			if window <= 0 {
+				c = counts{
+					num:    vv.RequestNum,
+					total:  vv.TotalTime,
+					min:    vv.MinTime,
+					max:    vv.MaxTime,
+					status: vv.status,
+					sketch: vv.sketch,
+				}
+				elapsed = now.Sub(vv.since)
+			} else {
+				if window > time.Hour {
+					window = time.Hour
+				}
+				if window <= fineSlot*fineSlots {
+					vv.fine.collect(now, window, &c)
+				} else {
+					vv.coarse.collect(now, window, &c)
+				}
+				elapsed = window
+				if since := now.Sub(vv.since); since < elapsed {
+					elapsed = since
+				}
+				if c.num == 0 {
+					continue
+				}
+			}
+			rs := &RouteStats{
+				Route:      k,
+				Method:     kk,
+				Controller: vv.RequestController,
+				Count:      c.num,
+				Status:     make(map[int]int64, len(c.status)),
+				Total:      c.total,
+				Min:        c.min,
+				Max:        c.max,
+			}
+			for code, n := range c.status {
+				rs.Status[code] = n
 			}
-			if s.MinTime > requesttime {
-				s.MinTime = requesttime
+			if c.num > 0 {
+				rs.Avg = time.Duration(int64(c.total) / c.num)
 			}
-			s.TotalTime += requesttime
-		} else {
-			nb := &Statistics{
-				RequestUrl:        requestUrl,
-				RequestController: requestController,
-				RequestNum:        1,
-				MinTime:           requesttime,
-				MaxTime:           requesttime,
-				TotalTime:         requesttime,
+			if c.sketch != nil {
+				rs.P50 = rs.quantile(c.sketch, 0.5)
+				rs.P95 = rs.quantile(c.sketch, 0.95)
+				rs.P99 = rs.quantile(c.sketch, 0.99)
 			}
-			m.urlmap[requestUrl][requestMethod] = nb
+			if elapsed < time.Second {
+				elapsed = time.Second
+			}
+			rs.QPS = float64(c.num) / elapsed.Seconds()
+			rs.TotalMs = toMs(rs.Total)
+			rs.MinMs = toMs(rs.Min)
+			rs.MaxMs = toMs(rs.Max)
+			rs.AvgMs = toMs(rs.Avg)
+			rs.P50Ms = toMs(rs.P50)
+			rs.P95Ms = toMs(rs.P95)
+			rs.P99Ms = toMs(rs.P99)
+			result = append(result, rs)
 		}
+	}
+	sort.Sort(routeStatsSorter(result))
+	return result
+}
 
-	} else {
-		if m.LengthLimit > 0 && m.LengthLimit <= len(m.urlmap) {
-			return
-		}
-		methodmap := make(map[string]*Statistics)
-		nb := &Statistics{
-			RequestUrl:        requestUrl,
-			RequestController: requestController,
-			RequestNum:        1,
-			MinTime:           requesttime,
-			MaxTime:           requesttime,
-			TotalTime:         requesttime,
+// quantile keeps the estimated quantile in [Min, Max].
+func (rs *RouteStats) quantile(s *sketch, q float64) time.Duration {
+	d := time.Duration(s.quantile(q))
+	if d < rs.Min {
+		d = rs.Min
+	}
+	if d > rs.Max {
+		d = rs.Max
+	}
+	return d
+}
+
+type routeStatsSorter []*RouteStats
+
+func (s routeStatsSorter) Len() int      { return len(s) }
+func (s routeStatsSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s routeStatsSorter) Less(i, j int) bool {
+	if s[i].Route != s[j].Route {
+		return s[i].Route < s[j].Route
+	}
+	return s[i].Method < s[j].Method
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// the status codes like "200:10 404:1"
+func statusString(status map[int]int64) string {
+	codes := make([]int, 0, len(status))
+	for code := range status {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	str := ""
+	for i, code := range codes {
+		if i > 0 {
+			str += " "
 		}
-		methodmap[requestMethod] = nb
-		m.urlmap[requestUrl] = methodmap
+		str += fmt.Sprintf("%d:%d", code, status[code])
 	}
+	return str
 }
 
 // put url statistics result in io.Writer
 func (m *UrlMap) GetMap() map[string]interface{} {
-	m.lock.RLock()
-	defer m.lock.RUnlock()
+	return m.GetWindowMap(0)
+}
 
-	var fields = []string{"requestUrl", "method", "times", "used", "max used", "min used", "avg used"}
+// GetWindowMap is GetMap of the requests in the last window, see Snapshot.
+func (m *UrlMap) GetWindowMap(window time.Duration) map[string]interface{} {
+	var fields = []string{"requestUrl", "method", "times", "used", "max used", "min used", "avg used", "p50", "p95", "p99", "qps", "status"}
 
 	resultLists := make([][]string, 0)
 	content := make(map[string]interface{})
 	content["Fields"] = fields
 
-	for k, v := range m.urlmap {
-		for kk, vv := range v {
-			result := []string{
-				fmt.Sprintf("% -50s", k),
-				fmt.Sprintf("% -10s", kk),
-				fmt.Sprintf("% -16d", vv.RequestNum),
-				fmt.Sprintf("% -16s", toS(vv.TotalTime)),
-				fmt.Sprintf("% -16s", toS(vv.MaxTime)),
-				fmt.Sprintf("% -16s", toS(vv.MinTime)),
-				fmt.Sprintf("% -16s", toS(time.Duration(int64(vv.TotalTime)/vv.RequestNum))),
-			}
-			resultLists = append(resultLists, result)
+	for _, rs := range m.Snapshot(window) {
+		result := []string{
+			fmt.Sprintf("% -50s", rs.Route),
+			fmt.Sprintf("% -10s", rs.Method),
+			fmt.Sprintf("% -16d", rs.Count),
+			fmt.Sprintf("% -16s", toS(rs.Total)),
+			fmt.Sprintf("% -16s", toS(rs.Max)),
+			fmt.Sprintf("% -16s", toS(rs.Min)),
+			fmt.Sprintf("% -16s", toS(rs.Avg)),
+			fmt.Sprintf("% -16s", toS(rs.P50)),
+			fmt.Sprintf("% -16s", toS(rs.P95)),
+			fmt.Sprintf("% -16s", toS(rs.P99)),
+			fmt.Sprintf("% -10.2f", rs.QPS),
+			statusString(rs.Status),
 		}
+		resultLists = append(resultLists, result)
 	}
 	content["Data"] = resultLists
 	return content
@@ -120,23 +314,119 @@ func (m *UrlMap) GetMapData() []map[string]interface{} {
 
 	resultLists := make([]map[string]interface{}, 0)
 
-	for k, v := range m.urlmap {
-		for kk, vv := range v {
-			result := map[string]interface{}{
-				"request_url": k,
-				"method":      kk,
-				"times":       vv.RequestNum,
-				"total_time":  toS(vv.TotalTime),
-				"max_time":    toS(vv.MaxTime),
-				"min_time":    toS(vv.MinTime),
-				"avg_time":    toS(time.Duration(int64(vv.TotalTime) / vv.RequestNum)),
-			}
-			resultLists = append(resultLists, result)
+	for _, rs := range m.Snapshot(0) {
+		result := map[string]interface{}{
+			"request_url": rs.Route,
+			"method":      rs.Method,
+			"times":       rs.Count,
+			"total_time":  toS(rs.Total),
+			"max_time":    toS(rs.Max),
+			"min_time":    toS(rs.Min),
+			"avg_time":    toS(rs.Avg),
+			"p50_time":    toS(rs.P50),
+			"p95_time":    toS(rs.P95),
+			"p99_time":    toS(rs.P99),
+			"status":      rs.Status,
 		}
+		resultLists = append(resultLists, result)
 	}
 	return resultLists
 }
 
+// counts is the statistics of the requests in a slot or a window.
+type counts struct {
+	num    int64
+	total  time.Duration
+	min    time.Duration
+	max    time.Duration
+	status map[int]int64
+	sketch *sketch
+}
+
+func (c *counts) add(status int, d time.Duration) {
+	if c.num == 0 || c.min > d {
+		c.min = d
+	}
+	if c.max < d {
+		c.max = d
+	}
+	c.num++
+	c.total += d
+	if status > 0 {
+		if c.status == nil {
+			c.status = make(map[int]int64)
+		}
+		c.status[status]++
+	}
+	if c.sketch == nil {
+		c.sketch = newSketch()
+	}
+	c.sketch.add(float64(d))
+}
+
+func (c *counts) merge(o *counts) {
+	if o.num == 0 {
+		return
+	}
+	if c.num == 0 || c.min > o.min {
+		c.min = o.min
+	}
+	if c.max < o.max {
+		c.max = o.max
+	}
+	c.num += o.num
+	c.total += o.total
+	for code, n := range o.status {
+		if c.status == nil {
+			c.status = make(map[int]int64)
+		}
+		c.status[code] += n
+	}
+	if c.sketch == nil {
+		c.sketch = newSketch()
+	}
+	c.sketch.merge(o.sketch)
+}
+
+type slot struct {
+	index int64
+	counts
+}
+
+// ring keeps the counts of the recent slots of the width, the old slots are reused.
+type ring struct {
+	width time.Duration
+	slots []slot
+}
+
+func newRing(width time.Duration, n int) *ring {
+	return &ring{width: width, slots: make([]slot, n)}
+}
+
+func (r *ring) add(now time.Time, status int, d time.Duration) {
+	i := now.UnixNano() / int64(r.width)
+	s := &r.slots[i%int64(len(r.slots))]
+	if s.index != i {
+		*s = slot{index: i}
+	}
+	s.add(status, d)
+}
+
+// collect merges the slots in the window into c, the current slot is counted as a whole.
+func (r *ring) collect(now time.Time, window time.Duration, c *counts) {
+	i := now.UnixNano() / int64(r.width)
+	n := int64((window + r.width - 1) / r.width)
+	if n > int64(len(r.slots)) {
+		n = int64(len(r.slots))
+	}
+	for j := int64(0); j < n; j++ {
+		s := &r.slots[(i-j)%int64(len(r.slots))]
+		if s.index == i-j {
+			c.merge(&s.counts)
+		}
+	}
+}
+
 // global statistics data map
 var StatisticsMap *UrlMap
 
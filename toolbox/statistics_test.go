@@ -38,3 +38,71 @@ func TestStatics(t *testing.T) {
 
 	t.Log(string(b))
 }
+
+func TestStatisticsRoutes(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &UrlMap{
+		LengthLimit: 2,
+		urlmap:      make(map[string]map[string]*Statistics),
+		now:         func() time.Time { return now },
+	}
+	for i := 1; i <= 1000; i++ {
+		status := 200
+		if i%100 == 0 {
+			status = 500
+		}
+		m.AddRequest("GET", "/user/:id", "UserController", status, time.Duration(i)*time.Millisecond)
+	}
+	m.AddRequest("GET", "/static", "", 200, time.Millisecond)
+	m.AddRequest("GET", "/a", "", 404, time.Millisecond)
+	m.AddRequest("GET", "/b", "", 404, time.Millisecond)
+
+	stats := m.Snapshot(0)
+	if len(stats) != 3 || stats[2].Route != OtherRoutes || stats[2].Count != 2 || stats[2].Status[404] != 2 {
+		t.Fatalf("the routes after LengthLimit should be others, get %+v", stats)
+	}
+	s := stats[1]
+	if s.Route != "/user/:id" || s.Count != 1000 || s.Status[200] != 990 || s.Status[500] != 10 {
+		t.Fatalf("get %+v", s)
+	}
+	for _, q := range []struct {
+		get, want time.Duration
+	}{{s.P50, 500 * time.Millisecond}, {s.P95, 950 * time.Millisecond}, {s.P99, 990 * time.Millisecond}} {
+		if diff := float64(q.get-q.want) / float64(q.want); diff > 0.02 || diff < -0.02 {
+			t.Errorf("get quantile %v, want about %v", q.get, q.want)
+		}
+	}
+	if s.Min != time.Millisecond || s.Max != time.Second || s.Avg != 500500*time.Microsecond {
+		t.Errorf("get min %v, max %v, avg %v", s.Min, s.Max, s.Avg)
+	}
+
+	now = now.Add(2 * time.Minute)
+	m.AddRequest("GET", "/user/:id", "UserController", 200, 5*time.Millisecond)
+	if stats = m.Snapshot(time.Minute); len(stats) != 1 || stats[0].Count != 1 || stats[0].P99 != 5*time.Millisecond {
+		t.Errorf("the last minute should have a request, get %+v", stats)
+	}
+	if stats = m.Snapshot(5 * time.Minute); len(stats) != 3 || stats[1].Count != 1001 {
+		t.Errorf("the last 5 minutes should have all the requests, get %+v", stats)
+	}
+	now = now.Add(2 * time.Hour)
+	if stats = m.Snapshot(time.Hour); len(stats) != 0 {
+		t.Errorf("the last hour should be empty, get %+v", stats)
+	}
+	if stats = m.Snapshot(0); stats[1].Count != 1001 {
+		t.Errorf("get %+v", stats[1])
+	}
+}
+
+func TestSketchBounded(t *testing.T) {
+	s := newSketch()
+	for i := 0; i < 100000; i++ {
+		s.add(float64(i * i))
+	}
+	if len(s.bins) > sketchMaxBins {
+		t.Errorf("the sketch has %d bins", len(s.bins))
+	}
+	want := float64(99990 * 99990)
+	if q := s.quantile(0.9999); q < want*0.98 || q > want*1.02 {
+		t.Errorf("get p99.99 %v, want about %v", q, want)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/astaxie/beego/metrics"
 )
 
 // bounds provides a range of acceptable values (plus a map of name to value).
@@ -413,11 +415,11 @@ func run() {
 		select {
 		case now = <-time.After(effective.Sub(now)):
 			// Run every entry whose next time was this effective time.
-			for _, e := range sortList.Vals {
+			for i, e := range sortList.Vals {
 				if e.GetNext() != effective {
 					break
 				}
-				go e.Run()
+				go runTask(sortList.Keys[i], e)
 				e.SetPrev(e.GetNext())
 				e.SetNext(effective)
 			}
@@ -430,6 +432,22 @@ func run() {
 	}
 }
 
+var (
+	taskRuns     = metrics.NewCounter("beego_task_runs_total", "The runs of the tasks by result.", "task", "result")
+	taskDuration = metrics.NewHistogram("beego_task_duration_seconds", "The time of the task runs.", nil, "task")
+)
+
+// runTask runs the task and records the run in the metrics.
+func runTask(name string, t Tasker) {
+	start := time.Now()
+	result := "ok"
+	if err := t.Run(); err != nil {
+		result = "error"
+	}
+	taskRuns.Inc(name, result)
+	taskDuration.Observe(time.Since(start).Seconds(), name)
+}
+
 // start all tasks
 func StopTask() {
 	isstart = false
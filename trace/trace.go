@@ -0,0 +1,170 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace carries the request id and the W3C trace context (https://www.w3.org/TR/trace-context/)
+// of a request in context.Context, so the outgoing requests of httplib and the ORM logs are correlated with it.
+//
+// Usage:
+//
+//	// in the server, beego.RequestIdFilter does it
+//	span := trace.FromHeader(r.Header)
+//	r = r.WithContext(trace.NewContext(r.Context(), span))
+//
+//	// in the handler
+//	trace.RequestId(ctx.RequestContext())
+//	httplib.Get("http://api/user").WithContext(ctx.RequestContext())
+//	orm.NewOrm().WithContext(ctx.RequestContext())
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// the headers of the request id and the trace context
+const (
+	HeaderRequestId   = "X-Request-Id"
+	HeaderTraceParent = "Traceparent"
+	HeaderTraceState  = "Tracestate"
+)
+
+// the max length of the request id accepted from the client
+const maxRequestIdLen = 128
+
+// Span is the trace context of a request.
+type Span struct {
+	RequestId  string // the X-Request-Id, it's the trace id if the request has no X-Request-Id
+	TraceId    string // 32 hex digits, shared by all the requests of a trace
+	SpanId     string // 16 hex digits, the id of this request
+	ParentId   string // the span id of the caller in traceparent
+	Flags      string // 2 hex digits, "01" means sampled
+	TraceState string // the vendor data in tracestate, passed to the outgoing requests as is
+}
+
+type spanKey struct{}
+
+// NewContext returns the copy of ctx carrying the span.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// FromContext returns the span of ctx, it's nil if ctx has no span.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// RequestId returns the request id of ctx, it's empty if ctx has no span.
+func RequestId(ctx context.Context) string {
+	if s := FromContext(ctx); s != nil {
+		return s.RequestId
+	}
+	return ""
+}
+
+// FromHeader returns the span of the incoming request,
+// it continues the trace in traceparent, or starts a new trace.
+// the X-Request-Id of the client is kept if it's valid.
+func FromHeader(h http.Header) *Span {
+	s := &Span{Flags: "01"}
+	if traceId, parentId, flags, ok := ParseTraceParent(h.Get(HeaderTraceParent)); ok {
+		s.TraceId, s.ParentId, s.Flags = traceId, parentId, flags
+		s.TraceState = h.Get(HeaderTraceState)
+	} else {
+		s.TraceId = randomHex(16)
+	}
+	s.SpanId = randomHex(8)
+	if id := h.Get(HeaderRequestId); validRequestId(id) {
+		s.RequestId = id
+	} else {
+		s.RequestId = s.TraceId
+	}
+	return s
+}
+
+// TraceParent returns the traceparent of the outgoing requests, this span is their parent.
+func (s *Span) TraceParent() string {
+	return "00-" + s.TraceId + "-" + s.SpanId + "-" + s.Flags
+}
+
+// Inject sets the request id and the trace context in the header of an outgoing request.
+func (s *Span) Inject(h http.Header) {
+	if h.Get(HeaderRequestId) == "" {
+		h.Set(HeaderRequestId, s.RequestId)
+	}
+	if h.Get(HeaderTraceParent) == "" {
+		h.Set(HeaderTraceParent, s.TraceParent())
+		if s.TraceState != "" {
+			h.Set(HeaderTraceState, s.TraceState)
+		}
+	}
+}
+
+// ParseTraceParent parses the traceparent header like "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(v string) (traceId, parentId, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", "", false
+	}
+	// the version 00 has exactly 4 parts, the future versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", "", false
+	}
+	traceId, parentId, flags = parts[1], parts[2], parts[3]
+	if len(traceId) != 32 || len(parentId) != 16 || len(flags) != 2 ||
+		!isHex(parts[0]) || !isHex(traceId) || !isHex(parentId) || !isHex(flags) ||
+		isZero(traceId) || isZero(parentId) {
+		return "", "", "", false
+	}
+	return traceId, parentId, flags, true
+}
+
+// validRequestId accepts the printable ids, so they are safe in the logs.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' || id[i] == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestFromHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set("tracestate", "congo=t61rcWkgMzE")
+	s := FromHeader(h)
+	if s.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentId != "00f067aa0ba902b7" || s.Flags != "01" {
+		t.Errorf("traceparent isn't continued: %+v", s)
+	}
+	if s.RequestId != s.TraceId || len(s.SpanId) != 16 || s.SpanId == s.ParentId {
+		t.Errorf("bad span %+v", s)
+	}
+
+	out := http.Header{}
+	s.Inject(out)
+	if out.Get("traceparent") != "00-"+s.TraceId+"-"+s.SpanId+"-01" || out.Get("tracestate") != "congo=t61rcWkgMzE" || out.Get("x-request-id") != s.RequestId {
+		t.Errorf("bad outgoing headers %v", out)
+	}
+
+	ctx := NewContext(context.Background(), s)
+	if RequestId(ctx) != s.RequestId || RequestId(context.Background()) != "" {
+		t.Errorf("RequestId of the context failed")
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	bad := []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, v := range bad {
+		if _, _, _, ok := ParseTraceParent(v); ok {
+			t.Errorf("ParseTraceParent(%q) should fail", v)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("X-Request-Id", "evil\nid")
+	s := FromHeader(h)
+	if s.RequestId == "evil\nid" || len(s.TraceId) != 32 {
+		t.Errorf("the invalid request id is accepted: %+v", s)
+	}
+}
@@ -19,10 +19,56 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/astaxie/beego/utils"
 )
 
+// registered types of the router params, used as :id:int or :name:string.
+// the value is the regexp with one capture group.
+// it's guarded by routerParamTypesLock, the types can be added while the routes are matched.
+var (
+	routerParamTypesLock sync.RWMutex
+	routerParamTypes     = map[string]string{
+		"int":    "([0-9]+)",
+		"string": `([\w]+)`,
+	}
+)
+
+// AddRouterParamType registers a named type for the router params.
+// expr is the regexp matching the param value, it must not have capture groups,
+// use (?:...) if a group is needed.
+// usage:
+//	AddRouterParamType("uuid", "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}")
+//	beego.Router("/order/:id:uuid", &OrderController{})
+func AddRouterParamType(name, expr string) {
+	if !regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`).MatchString(name) {
+		panic("router param type name is invalid: " + name)
+	}
+	reg, err := regexp.Compile(expr)
+	if err != nil {
+		panic("router param type " + name + " has invalid regexp: " + err.Error())
+	}
+	if reg.NumSubexp() > 0 {
+		panic("router param type " + name + " regexp must not have capture groups")
+	}
+	routerParamTypesLock.Lock()
+	routerParamTypes[name] = "(" + expr + ")"
+	routerParamTypesLock.Unlock()
+}
+
+// matchParamType finds the longest registered param type at the beginning of key.
+func matchParamType(key string) (typ, expr string) {
+	routerParamTypesLock.RLock()
+	defer routerParamTypesLock.RUnlock()
+	for name, e := range routerParamTypes {
+		if len(name) > len(typ) && strings.HasPrefix(key, name) {
+			typ, expr = name, e
+		}
+	}
+	return typ, expr
+}
+
 type Tree struct {
 	// search fix route first
 	fixrouters map[string]*Tree
@@ -301,17 +347,24 @@ func (t *Tree) addseg(segments []string, route interface{}, wildcards []string,
 
 // match router to runObject & params
 func (t *Tree) Match(pattern string) (runObject interface{}, params map[string]string) {
+	return t.MatchWith(pattern, nil)
+}
+
+// MatchWith is the same as Match, but the runObject is only matched when accept returns true,
+// otherwise the other routers are tried.
+// accept can be nil.
+func (t *Tree) MatchWith(pattern string, accept func(runObject interface{}) bool) (runObject interface{}, params map[string]string) {
 	if len(pattern) == 0 || pattern[0] != '/' {
 		return nil, nil
 	}
 
-	return t.match(splitPath(pattern), nil)
+	return t.match(splitPath(pattern), nil, accept)
 }
 
 //
 // Tree如何 match 呢?
 //
-func (t *Tree) match(segments []string, wildcardValues []string) (runObject interface{}, params map[string]string) {
+func (t *Tree) match(segments []string, wildcardValues []string, accept func(interface{}) bool) (runObject interface{}, params map[string]string) {
 	fmt.Printf("segments: %v, wildcardValues: %v\n", segments, wildcardValues)
 
 	// Handle leaf nodes:
@@ -320,7 +373,7 @@ func (t *Tree) match(segments []string, wildcardValues []string) (runObject inte
 		// 按照: wildcardValues来匹配
 		// 如果没有: wildcardValues那如何处理呢?
 		for _, l := range t.leaves {
-			if ok, pa := l.match(wildcardValues); ok {
+			if ok, pa := l.match(wildcardValues); ok && (accept == nil || accept(l.runObject)) {
 				return l.runObject, pa
 			}
 		}
@@ -328,7 +381,7 @@ func (t *Tree) match(segments []string, wildcardValues []string) (runObject inte
 		// 如果: leaves不能匹配, 则交给更加general的wildcard去匹配
 		if t.wildcard != nil {
 			for _, l := range t.wildcard.leaves {
-				if ok, pa := l.match(wildcardValues); ok {
+				if ok, pa := l.match(wildcardValues); ok && (accept == nil || accept(l.runObject)) {
 					return l.runObject, pa
 				}
 			}
@@ -342,14 +395,14 @@ func (t *Tree) match(segments []string, wildcardValues []string) (runObject inte
 	subTree, ok := t.fixrouters[seg]
 	if ok {
 		// 如果是: fixrouter, 则直接进入subTree的匹配
-		runObject, params = subTree.match(segs, wildcardValues)
+		runObject, params = subTree.match(segs, wildcardValues, accept)
 	} else if len(segs) == 0 { //.json .xml
 		if subindex := strings.LastIndex(seg, "."); subindex != -1 {
 			// 再次匹配: fixrouters
 			// .json, .xml特殊情况
 			subTree, ok = t.fixrouters[seg[:subindex]]
 			if ok {
-				runObject, params = subTree.match(segs, wildcardValues)
+				runObject, params = subTree.match(segs, wildcardValues, accept)
 				if runObject != nil {
 					if params == nil {
 						params = make(map[string]string)
@@ -365,12 +418,12 @@ func (t *Tree) match(segments []string, wildcardValues []string) (runObject inte
 	// 如果: fixrouters匹配失败，那么转入: wildcard的匹配
 	if runObject == nil && t.wildcard != nil {
 		// append(wildcardValues, seg) 什么意思呢?
-		runObject, params = t.wildcard.match(segs, append(wildcardValues, seg))
+		runObject, params = t.wildcard.match(segs, append(wildcardValues, seg), accept)
 	}
 	if runObject == nil {
 		// 还是没有匹配，则进行: leaves的匹配（直接终止）
 		for _, l := range t.leaves {
-			if ok, pa := l.match(append(wildcardValues, segments...)); ok {
+			if ok, pa := l.match(append(wildcardValues, segments...)); ok && (accept == nil || accept(l.runObject)) {
 				return l.runObject, pa
 			}
 		}
@@ -543,30 +596,17 @@ func splitSegment(key string) (bool, []string, string) {
 			if start {
 				// 开始识别: param之后，解析来可能是类型
 				//:id:int and :name:string
+				// 也支持通过 AddRouterParamType 注册的类型, 例如 :id:uuid
 				if v == ':' {
-					if len(key) >= i+4 {
-						if key[i+1:i+4] == "int" {
-							out = append(out, []rune("([0-9]+)")...)
-							params = append(params, ":"+string(param))
-							start = false
-							startexp = false
-							skipnum = 3
-							param = make([]rune, 0)
-							paramsNum += 1
-							continue
-						}
-					}
-					if len(key) >= i+7 {
-						if key[i+1:i+7] == "string" {
-							out = append(out, []rune(`([\w]+)`)...)
-							params = append(params, ":"+string(param))
-							paramsNum += 1
-							start = false
-							startexp = false
-							skipnum = 6
-							param = make([]rune, 0)
-							continue
-						}
+					if typ, expr := matchParamType(key[i+1:]); typ != "" {
+						out = append(out, []rune(expr)...)
+						params = append(params, ":"+string(param))
+						paramsNum += 1
+						start = false
+						startexp = false
+						skipnum = len(typ)
+						param = make([]rune, 0)
+						continue
 					}
 				}
 				// params only support a-zA-Z0-9
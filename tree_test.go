@@ -14,7 +14,11 @@
 
 package beego
 
-import "testing"
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
 
 // Pattern, RequestUrl --> 解析出来的结果: params
 type testinfo struct {
@@ -272,3 +276,54 @@ func TestSplitSegment(t *testing.T) {
 		t.Fatal(":id_cms.html should return true, [:id :page], cms_(.+)_(.+).html")
 	}
 }
+
+func TestRouterParamType(t *testing.T) {
+	AddRouterParamType("slug", "[a-z0-9]+(?:-[a-z0-9]+)*")
+	tr := NewTree()
+	tr.AddRouter("/post/:id:int", "id")
+	tr.AddRouter("/post/:title:slug", "slug")
+	obj, param := tr.Match("/post/123")
+	if obj == nil || obj.(string) != "id" || param[":id"] != "123" {
+		t.Fatal("/post/:id:int can't match /post/123")
+	}
+	obj, param = tr.Match("/post/hello-beego")
+	if obj == nil || obj.(string) != "slug" || param[":title"] != "hello-beego" {
+		t.Fatal("/post/:title:slug can't match /post/hello-beego")
+	}
+	obj, _ = tr.Match("/post/Hello_Beego")
+	if obj != nil {
+		t.Fatal("/post/Hello_Beego should not be matched")
+	}
+}
+
+func TestRouterParamTypeConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			AddRouterParamType("hex"+strconv.Itoa(i), "[0-9a-f]+")
+		}(i)
+		go func() {
+			defer wg.Done()
+			tr := NewTree()
+			tr.AddRouter("/post/:id:int", "id")
+			if obj, _ := tr.Match("/post/123"); obj == nil {
+				t.Error("/post/:id:int can't match /post/123")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTreeMatchWith(t *testing.T) {
+	tr := NewTree()
+	tr.AddRouter("/user/:id", "v2")
+	tr.AddRouter("/user/:id", "v1")
+	obj, param := tr.MatchWith("/user/1", func(o interface{}) bool {
+		return o.(string) == "v1"
+	})
+	if obj == nil || obj.(string) != "v1" || param[":id"] != "1" {
+		t.Fatal("/user/:id should match v1")
+	}
+}
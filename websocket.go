@@ -0,0 +1,54 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/websocket"
+)
+
+// WebSocketHandler serves the upgraded websocket connection,
+// the connection is closed after the handler returns.
+type WebSocketHandler func(ctx *context.Context, conn *websocket.Conn)
+
+// add websocket router, it's a GET router so the filters and the session run before the upgrade.
+// the upgrader is websocket.DefaultUpgrader if it's not given.
+// usage:
+//
+//	WebSocket("/ws", func(ctx *context.Context, conn *websocket.Conn){
+//	      for {
+//	          t, msg, err := conn.ReadMessage()
+//	          if err != nil {
+//	              return
+//	          }
+//	          conn.WriteMessage(t, msg)
+//	      }
+//	})
+func (p *ControllerRegistor) WebSocket(pattern string, h WebSocketHandler, upgrader ...*websocket.Upgrader) *Route {
+	u := websocket.DefaultUpgrader
+	if len(upgrader) > 0 && upgrader[0] != nil {
+		u = upgrader[0]
+	}
+	return p.Get(pattern, func(ctx *context.Context) {
+		conn, err := u.Upgrade(ctx.ResponseWriter, ctx.Request, nil)
+		if err != nil {
+			// the error response is written by the upgrader
+			Debug("websocket upgrade of", ctx.Request.URL.Path, "failed:", err)
+			return
+		}
+		defer conn.Close()
+		h(ctx, conn)
+	})
+}
@@ -0,0 +1,488 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket implements the WebSocket protocol (RFC 6455)
+// with ping/pong, permessage-deflate compression, origin checking and a broadcast hub.
+//
+// It's used by the WebSocket routes of beego:
+//
+//	hub := websocket.NewHub()
+//	beego.WebSocket("/ws/chat", func(ctx *context.Context, conn *websocket.Conn) {
+//		hub.Add(conn)
+//		defer hub.Remove(conn)
+//		conn.KeepAlive(30 * time.Second)
+//		for {
+//			_, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			hub.Broadcast(websocket.TextMessage, msg)
+//		}
+//	})
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// close codes
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+const (
+	finalBit = 1 << 7
+	rsv1Bit  = 1 << 6
+	maskBit  = 1 << 7
+
+	maxControlPayload = 125
+	defaultWriteWait  = 10 * time.Second
+)
+
+var (
+	// ErrReadLimit is returned when the message is larger than the read limit.
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+	// ErrClosed is returned when writing to a closed connection.
+	ErrClosed = errors.New("websocket: use of closed connection")
+
+	// the tail of a deflate block flushed by Flush, it's removed from the compressed messages
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+)
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// Conn is a WebSocket connection,
+// one goroutine can read and several goroutines can write concurrently.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+	compress bool // permessage-deflate is negotiated
+	subproto string
+	request  *http.Request
+
+	readLimit   int64
+	pingHandler func(data string) error
+	pongHandler func(data string) error
+
+	wmu    sync.Mutex // serializes the writes
+	closed bool
+	stop   chan struct{}
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	c := &Conn{conn: conn, br: br, isServer: isServer, stop: make(chan struct{})}
+	c.pingHandler = func(data string) error {
+		return c.WriteControl(PongMessage, []byte(data), time.Now().Add(defaultWriteWait))
+	}
+	c.pongHandler = func(string) error { return nil }
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subproto
+}
+
+// Request returns the upgraded request, it's nil for the client connection.
+func (c *Conn) Request() *http.Request {
+	return c.request
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the max size of a message, ReadMessage returns ErrReadLimit for a larger one.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetReadDeadline sets the deadline of reading the next message.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the writes.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler of the ping messages, a pong is sent by default.
+func (c *Conn) SetPingHandler(h func(data string) error) {
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the handler of the pong messages.
+func (c *Conn) SetPongHandler(h func(data string) error) {
+	c.pongHandler = h
+}
+
+// KeepAlive pings the peer every interval, the connection is closed if no message
+// or pong is received in two intervals. It's stopped when the connection is closed.
+func (c *Conn) KeepAlive(interval time.Duration) {
+	c.SetReadDeadline(time.Now().Add(2 * interval))
+	c.pongHandler = func(string) error {
+		return c.SetReadDeadline(time.Now().Add(2 * interval))
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.WriteControl(PingMessage, nil, time.Now().Add(defaultWriteWait)); err != nil {
+					return
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// ReadMessage reads the next text or binary message,
+// the control messages are handled by the ping and pong handlers.
+// *CloseError is returned after the peer closes the connection.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	var buf bytes.Buffer
+	compressed := false
+	for {
+		fin, rsv1, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.pingHandler(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.pongHandler(string(payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			ce := &CloseError{Code: CloseNoStatusReceived}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Text = string(payload[2:])
+			}
+			reply := payload
+			if len(reply) > 2 {
+				reply = reply[:2]
+			}
+			c.WriteControl(CloseMessage, reply, time.Now().Add(defaultWriteWait))
+			c.Close()
+			return 0, nil, ce
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail("unexpected data frame")
+			}
+			messageType = opcode
+			compressed = rsv1
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail("unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(fmt.Sprintf("unknown opcode %d", opcode))
+		}
+		if c.readLimit > 0 && int64(buf.Len()+len(payload)) > c.readLimit {
+			c.WriteControl(CloseMessage, closePayload(CloseMessageTooBig, ""), time.Now().Add(defaultWriteWait))
+			c.Close()
+			return 0, nil, ErrReadLimit
+		}
+		buf.Write(payload)
+		if fin {
+			break
+		}
+	}
+	data = buf.Bytes()
+	if compressed {
+		r := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail), bytes.NewReader([]byte{0x01, 0x00, 0x00, 0xff, 0xff})))
+		defer r.Close()
+		if c.readLimit > 0 {
+			data, err = ioutil.ReadAll(io.LimitReader(r, c.readLimit+1))
+			if err == nil && int64(len(data)) > c.readLimit {
+				return 0, nil, ErrReadLimit
+			}
+		} else {
+			data, err = ioutil.ReadAll(r)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	return messageType, data, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage writes a text or binary message, it's compressed if permessage-deflate is negotiated.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return c.WriteControl(messageType, data, time.Now().Add(defaultWriteWait))
+	}
+	rsv1 := false
+	if c.compress && len(data) > 0 {
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+		fw.Write(data)
+		fw.Flush()
+		data = bytes.TrimSuffix(buf.Bytes(), deflateTail)
+		rsv1 = true
+	}
+	return c.writeFrame(messageType, rsv1, data)
+}
+
+// WriteJSON writes v as a JSON text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// WriteControl writes a ping, pong or close message with the deadline.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: control message is too long")
+	}
+	c.wmu.Lock()
+	c.conn.SetWriteDeadline(deadline)
+	c.wmu.Unlock()
+	err := c.writeFrame(messageType, false, data)
+	c.wmu.Lock()
+	c.conn.SetWriteDeadline(time.Time{})
+	c.wmu.Unlock()
+	return err
+}
+
+// CloseWithReason sends the close message to the peer and closes the connection.
+func (c *Conn) CloseWithReason(code int, text string) error {
+	c.WriteControl(CloseMessage, closePayload(code, text), time.Now().Add(defaultWriteWait))
+	return c.Close()
+}
+
+// Close closes the underlying connection without the close message.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.stop)
+	return c.conn.Close()
+}
+
+// fail closes the connection for the protocol error.
+func (c *Conn) fail(msg string) error {
+	c.CloseWithReason(CloseProtocolError, msg)
+	return errors.New("websocket: " + msg)
+}
+
+func (c *Conn) readFrame() (fin, rsv1 bool, opcode int, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+	fin = h[0]&finalBit != 0
+	rsv1 = h[0]&rsv1Bit != 0
+	opcode = int(h[0] & 0x0f)
+	masked := h[1]&maskBit != 0
+	if masked != c.isServer {
+		err = c.fail("bad frame mask")
+		return
+	}
+	if rsv1 && !c.compress {
+		err = c.fail("unexpected rsv1")
+		return
+	}
+	n := int64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if opcode >= CloseMessage && (n > maxControlPayload || !fin) {
+		err = c.fail("bad control frame")
+		return
+	}
+	if n < 0 || c.readLimit > 0 && n > c.readLimit {
+		c.WriteControl(CloseMessage, closePayload(CloseMessageTooBig, ""), time.Now().Add(defaultWriteWait))
+		c.Close()
+		err = ErrReadLimit
+		return
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return
+}
+
+func (c *Conn) writeFrame(opcode int, rsv1 bool, payload []byte) error {
+	buf := make([]byte, 0, len(payload)+14)
+	b0 := byte(opcode) | finalBit
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	buf = append(buf, b0)
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, b1|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, b1|126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, b1|127)
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(n))
+	}
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		// the client frames are masked
+		var key [4]byte
+		binary.BigEndian.PutUint32(key[:], rand.Uint32())
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+func closePayload(code int, text string) []byte {
+	b := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	return append(b, text...)
+}
+
+// IsCloseError checks if err is the close of the peer with one of the codes.
+func IsCloseError(err error, codes ...int) bool {
+	ce, ok := err.(*CloseError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return len(codes) == 0
+}
+
+// the header contains the token, like "Connection: keep-alive, Upgrade"
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
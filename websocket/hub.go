@@ -0,0 +1,155 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Hub keeps the connections and broadcasts the messages to them or to the rooms.
+// usage:
+//
+//	hub := websocket.NewHub()
+//	hub.Add(conn)
+//	hub.Join("room1", conn)
+//	hub.BroadcastTo("room1", websocket.TextMessage, []byte("hello"))
+type Hub struct {
+	// WriteTimeout is the deadline of writing to a connection,
+	// a slow connection failing to write in time is closed and removed.
+	WriteTimeout time.Duration
+
+	mu    sync.RWMutex
+	conns map[*Conn]map[string]bool
+	rooms map[string]map[*Conn]bool
+}
+
+// NewHub returns a Hub.
+func NewHub() *Hub {
+	return &Hub{
+		WriteTimeout: defaultWriteWait,
+		conns:        make(map[*Conn]map[string]bool),
+		rooms:        make(map[string]map[*Conn]bool),
+	}
+}
+
+// Add adds the connection to the hub.
+func (h *Hub) Add(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; !ok {
+		h.conns[c] = make(map[string]bool)
+	}
+}
+
+// Remove removes the connection from the hub and all its rooms.
+func (h *Hub) Remove(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for room := range h.conns[c] {
+		h.leave(room, c)
+	}
+	delete(h.conns, c)
+}
+
+// Join adds the connection to the room, it's added to the hub if not yet.
+func (h *Hub) Join(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; !ok {
+		h.conns[c] = make(map[string]bool)
+	}
+	h.conns[c][room] = true
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Conn]bool)
+	}
+	h.rooms[room][c] = true
+}
+
+// Leave removes the connection from the room.
+func (h *Hub) Leave(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leave(room, c)
+}
+
+func (h *Hub) leave(room string, c *Conn) {
+	if rooms, ok := h.conns[c]; ok {
+		delete(rooms, room)
+	}
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Len returns the number of the connections in the hub.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// RoomLen returns the number of the connections in the room.
+func (h *Hub) RoomLen(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Broadcast writes the message to all the connections.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	h.send(conns, messageType, data)
+}
+
+// BroadcastTo writes the message to the connections in the room.
+func (h *Hub) BroadcastTo(room string, messageType int, data []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	h.send(conns, messageType, data)
+}
+
+// send writes to the connections concurrently, so a slow connection doesn't block the others.
+func (h *Hub) send(conns []*Conn, messageType int, data []byte) {
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *Conn) {
+			defer wg.Done()
+			if h.WriteTimeout > 0 {
+				c.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+			}
+			if err := c.WriteMessage(messageType, data); err != nil {
+				h.Remove(c)
+				c.Close()
+				return
+			}
+			if h.WriteTimeout > 0 {
+				c.SetWriteDeadline(time.Time{})
+			}
+		}(c)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,294 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// the GUID of the Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// HandshakeError is returned when the request isn't a valid WebSocket handshake.
+type HandshakeError struct {
+	Status  int
+	Message string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: " + e.Message
+}
+
+// Upgrader upgrades the http requests to WebSocket connections.
+type Upgrader struct {
+	// CheckOrigin returns true if the Origin of the request is allowed,
+	// the requests without Origin or from the same host are allowed by default.
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression negotiates permessage-deflate with the client.
+	EnableCompression bool
+	// ReadLimit is the max size of a message, 0 means no limit.
+	ReadLimit int64
+	// Subprotocols are the supported subprotocols in order of preference.
+	Subprotocols []string
+	// HandshakeTimeout is the deadline of writing the handshake response.
+	HandshakeTimeout time.Duration
+}
+
+// DefaultUpgrader is used by the WebSocket routes without their own Upgrader.
+var DefaultUpgrader = &Upgrader{ReadLimit: 32 << 20}
+
+// IsWebSocketUpgrade checks if the request asks for the WebSocket upgrade.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade hijacks the connection and writes the 101 response with the headers of w and responseHeader,
+// so the cookies set before the upgrade such as the session id are sent to the client.
+// An error response is written if the handshake fails.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	if r.Method != "GET" {
+		return u.fail(w, http.StatusMethodNotAllowed, "the method of the handshake isn't GET")
+	}
+	if !IsWebSocketUpgrade(r) {
+		return u.fail(w, http.StatusBadRequest, "the request isn't a WebSocket upgrade")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return u.fail(w, http.StatusUpgradeRequired, "unsupported version")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		return u.fail(w, http.StatusForbidden, "the origin isn't allowed")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		return u.fail(w, http.StatusBadRequest, "missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return u.fail(w, http.StatusInternalServerError, "the response doesn't support hijacking")
+	}
+
+	subproto := ""
+	if len(u.Subprotocols) > 0 {
+		offered := tokens(r.Header, "Sec-Websocket-Protocol")
+	found:
+		for _, p := range u.Subprotocols {
+			for _, o := range offered {
+				if p == o {
+					subproto = p
+					break found
+				}
+			}
+		}
+	}
+	compress := u.EnableCompression && offersDeflate(r.Header)
+
+	netConn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: the client sent data before the handshake")
+	}
+
+	h := make(http.Header)
+	for k, v := range w.Header() {
+		h[k] = v
+	}
+	for k, v := range responseHeader {
+		h[k] = v
+	}
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", acceptKey(key))
+	if subproto != "" {
+		h.Set("Sec-WebSocket-Protocol", subproto)
+	}
+	if compress {
+		h.Set("Sec-WebSocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(u.HandshakeTimeout))
+	}
+	bw := bufio.NewWriter(netConn)
+	bw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(bw)
+	bw.WriteString("\r\n")
+	if err := bw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetWriteDeadline(time.Time{})
+	// the deadlines set by http.Server are kept after hijacking
+	netConn.SetReadDeadline(time.Time{})
+
+	c := newConn(netConn, brw.Reader, true)
+	c.compress = compress
+	c.subproto = subproto
+	c.request = r
+	c.readLimit = u.ReadLimit
+	return c, nil
+}
+
+func (u *Upgrader) fail(w http.ResponseWriter, status int, msg string) (*Conn, error) {
+	err := &HandshakeError{Status: status, Message: msg}
+	http.Error(w, http.StatusText(status), status)
+	return nil, err
+}
+
+// SameOrigin allows the requests without Origin or with the Origin of the same host.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// AllowOrigins returns a CheckOrigin allowing the origins like "https://example.com",
+// "*" allows all the origins.
+func AllowOrigins(origins ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range origins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Dial connects to the WebSocket server of the url like "ws://127.0.0.1:8080/ws",
+// the header is sent with the handshake, it's used by the clients and the tests.
+func Dial(rawurl string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := u.Host
+	var netConn net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host += ":80"
+		}
+		netConn, err = net.Dial("tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host += ":443"
+		}
+		netConn, err = tls.Dial("tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, nil, errors.New("websocket: bad scheme " + u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	key := base64.StdEncoding.EncodeToString(b)
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-Websocket-Accept") != acceptKey(key) {
+		netConn.Close()
+		return nil, resp, &HandshakeError{Status: resp.StatusCode, Message: "bad handshake"}
+	}
+	c := newConn(netConn, br, false)
+	c.subproto = resp.Header.Get("Sec-Websocket-Protocol")
+	c.compress = offersDeflate(resp.Header)
+	return c, resp, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// tokens returns the comma separated values of the header
+func tokens(h http.Header, name string) []string {
+	var ts []string
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
+
+// offersDeflate checks if permessage-deflate is in Sec-WebSocket-Extensions,
+// the context takeover is always disabled so its parameters are ignored.
+func offersDeflate(h http.Header) bool {
+	for _, ext := range tokens(h, "Sec-Websocket-Extensions") {
+		if strings.TrimSpace(strings.Split(ext, ";")[0]) == "permessage-deflate" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoServer(u *Upgrader) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			t, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(t, msg)
+		}
+	}))
+}
+
+func wsURL(s *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func TestEcho(t *testing.T) {
+	s := echoServer(&Upgrader{EnableCompression: true, Subprotocols: []string{"chat"}})
+	defer s.Close()
+
+	for _, compress := range []bool{false, true} {
+		h := http.Header{"Sec-WebSocket-Protocol": {"other, chat"}}
+		if compress {
+			h.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits")
+		}
+		conn, _, err := Dial(wsURL(s), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Subprotocol() != "chat" || conn.compress != compress {
+			t.Errorf("negotiated %q compress %v", conn.Subprotocol(), conn.compress)
+		}
+		msgs := [][]byte{[]byte("hello"), bytes.Repeat([]byte("beego "), 20000), {}}
+		for _, msg := range msgs {
+			if err := conn.WriteMessage(BinaryMessage, msg); err != nil {
+				t.Fatal(err)
+			}
+			mt, got, err := conn.ReadMessage()
+			if err != nil || mt != BinaryMessage || !bytes.Equal(got, msg) {
+				t.Fatalf("echo of %d bytes get %d %d bytes %v", len(msg), mt, len(got), err)
+			}
+		}
+
+		var v struct{ Name string }
+		conn.WriteJSON(map[string]string{"name": "beego"})
+		if err := conn.ReadJSON(&v); err != nil || v.Name != "beego" {
+			t.Errorf("ReadJSON get %+v %v", v, err)
+		}
+
+		pong := make(chan string, 1)
+		conn.SetPongHandler(func(data string) error {
+			pong <- data
+			return nil
+		})
+		conn.WriteControl(PingMessage, []byte("ping"), time.Now().Add(time.Second))
+		conn.WriteMessage(TextMessage, []byte("after ping"))
+		if _, msg, _ := conn.ReadMessage(); string(msg) != "after ping" {
+			t.Errorf("get %q after ping", msg)
+		}
+		select {
+		case data := <-pong:
+			if data != "ping" {
+				t.Errorf("pong get %q", data)
+			}
+		default:
+			t.Errorf("no pong")
+		}
+
+		conn.CloseWithReason(CloseNormalClosure, "bye")
+	}
+}
+
+func TestCloseAndReadLimit(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&Upgrader{ReadLimit: 10}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(TextMessage, msg)
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	conn, _, err := Dial(wsURL(s), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(TextMessage, []byte("short"))
+	conn.ReadMessage()
+	conn.WriteMessage(TextMessage, []byte("longer than the limit"))
+	_, _, err = conn.ReadMessage()
+	if !IsCloseError(err, CloseMessageTooBig) {
+		t.Errorf("get %v, want the close of message too big", err)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	s := echoServer(&Upgrader{})
+	defer s.Close()
+	if _, resp, err := Dial(wsURL(s), http.Header{"Origin": {"http://evil.com"}}); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("the cross origin request is upgraded: %v", err)
+	}
+	conn, _, err := Dial(wsURL(s), http.Header{"Origin": {s.URL}})
+	if err != nil {
+		t.Fatalf("the same origin request failed: %v", err)
+	}
+	conn.Close()
+
+	s2 := echoServer(&Upgrader{CheckOrigin: AllowOrigins("http://example.com")})
+	defer s2.Close()
+	conn, _, err = Dial(wsURL(s2), http.Header{"Origin": {"http://example.com"}})
+	if err != nil {
+		t.Fatalf("the allowed origin failed: %v", err)
+	}
+	conn.Close()
+
+	resp, err := http.Get(s.URL)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("the plain request get %v %v", resp, err)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	joined := make(chan bool)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Add(conn)
+		if room := r.URL.Query().Get("room"); room != "" {
+			hub.Join(room, conn)
+		}
+		joined <- true
+		defer hub.Remove(conn)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	a, _, err := Dial(wsURL(s)+"?room=go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-joined
+	b, _, err := Dial(wsURL(s), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-joined
+	if hub.Len() != 2 || hub.RoomLen("go") != 1 {
+		t.Fatalf("hub has %d conns, %d in room", hub.Len(), hub.RoomLen("go"))
+	}
+
+	hub.BroadcastTo("go", TextMessage, []byte("room"))
+	hub.Broadcast(TextMessage, []byte("all"))
+	for _, want := range []string{"room", "all"} {
+		if _, msg, _ := a.ReadMessage(); string(msg) != want {
+			t.Errorf("a get %q, want %q", msg, want)
+		}
+	}
+	if _, msg, _ := b.ReadMessage(); string(msg) != "all" {
+		t.Errorf("b get %q, want all", msg)
+	}
+
+	a.Close()
+	for i := 0; i < 100 && hub.Len() != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Len() != 1 || hub.RoomLen("go") != 0 {
+		t.Errorf("the closed conn isn't removed: %d conns, %d in room", hub.Len(), hub.RoomLen("go"))
+	}
+	b.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/websocket"
+)
+
+func TestWebSocketRoute(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.InsertFilter("/ws/*", BeforeRouter, func(ctx *context.Context) {
+		if ctx.Input.Query("token") != "secret" {
+			ctx.Output.SetStatus(401)
+			ctx.Output.Body([]byte("unauthorized"))
+			return
+		}
+		ctx.Output.Header("X-Filter", "passed")
+	})
+	handler.WebSocket("/ws/echo/:name", func(ctx *context.Context, conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello "+ctx.Input.Param(":name")))
+		for {
+			t, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(t, msg)
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	if _, resp, err := websocket.Dial(url+"/ws/echo/beego", nil); err == nil || resp.StatusCode != 401 {
+		t.Errorf("the filter doesn't stop the upgrade: %v", err)
+	}
+
+	conn, resp, err := websocket.Dial(url+"/ws/echo/beego?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.Header.Get("X-Filter") != "passed" {
+		t.Errorf("the header set by the filter isn't in the handshake response")
+	}
+	if _, msg, _ := conn.ReadMessage(); string(msg) != "hello beego" {
+		t.Errorf("get %q, want hello beego", msg)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("echo"))
+	if _, msg, _ := conn.ReadMessage(); string(msg) != "echo" {
+		t.Errorf("get %q, want echo", msg)
+	}
+
+	r, _ := http.NewRequest("GET", "/ws/echo/beego?token=secret", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("the plain request get %d, want 400", w.Code)
+	}
+}
+
+func TestNamespaceWebSocket(t *testing.T) {
+	ns := NewNamespace("/v1ws",
+		NSWebSocket("/ws", func(ctx *context.Context, conn *websocket.Conn) {
+			conn.WriteMessage(websocket.TextMessage, []byte("v1_ws"))
+		}),
+	)
+	AddNamespace(ns)
+	s := httptest.NewServer(BeeApp.Handlers)
+	defer s.Close()
+
+	conn, _, err := websocket.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/v1ws/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, msg, _ := conn.ReadMessage(); string(msg) != "v1_ws" {
+		t.Errorf("get %q, want v1_ws", msg)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Errorf("the connection isn't closed after the handler returns")
+	}
+}